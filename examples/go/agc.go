@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// AGC 参数
+const (
+	// DEFAULT_AGC_TARGET_RMS agc_target_rms 未设置时的目标 RMS, 约为满幅的 -20 dBFS
+	DEFAULT_AGC_TARGET_RMS = 3276.0
+	// AGC_MAX_GAIN 最大放大倍数, 避免把静音或底噪放大成"语音"
+	AGC_MAX_GAIN = 10.0
+)
+
+// normalize 将采样整体缩放到目标 RMS, 返回新切片
+//
+// 增益不超过 AGC_MAX_GAIN, 缩放后超出 int16 范围的采样被截断。
+// 输入为全零 (RMS 为 0) 时原样复制。
+func normalize(samples []int16, targetRMS float64) []int16 {
+	out := make([]int16, len(samples))
+	if len(samples) == 0 {
+		return out
+	}
+
+	var sum float64
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	rms := math.Sqrt(sum / float64(len(samples)))
+	if rms == 0 || targetRMS <= 0 {
+		copy(out, samples)
+		return out
+	}
+
+	gain := math.Min(targetRMS/rms, AGC_MAX_GAIN)
+	for i, s := range samples {
+		v := math.Round(float64(s) * gain)
+		out[i] = int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, v)))
+	}
+	return out
+}
+
+// normalizePCM 对 16-bit Little-Endian PCM 做 normalize
+func normalizePCM(pcm []byte, targetRMS float64) []byte {
+	samples := normalize(pcmSamples(pcm), targetRMS)
+	out := make([]byte, len(samples)*2)
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(out[2*i:], uint16(s))
+	}
+	return out
+}
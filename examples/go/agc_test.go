@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// rms 计算采样的均方根
+func rms(samples []int16) float64 {
+	var sum float64
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+// sineSamples 生成 n 个幅度为 amplitude 的 440Hz 正弦采样 (8kHz)
+func sineSamples(n int, amplitude float64) []int16 {
+	samples := make([]int16, n)
+	for i := range samples {
+		samples[i] = int16(amplitude * math.Sin(2*math.Pi*440*float64(i)/8000))
+	}
+	return samples
+}
+
+func TestNormalizeReachesTargetRMS(t *testing.T) {
+	for _, amplitude := range []float64{1000, 4000, 20000} {
+		out := normalize(sineSamples(8000, amplitude), DEFAULT_AGC_TARGET_RMS)
+		if got := rms(out); math.Abs(got-DEFAULT_AGC_TARGET_RMS) > DEFAULT_AGC_TARGET_RMS*0.01 {
+			t.Errorf("amplitude %.0f: RMS = %.1f, want about %.1f", amplitude, got, DEFAULT_AGC_TARGET_RMS)
+		}
+	}
+}
+
+func TestNormalizeNoOverflow(t *testing.T) {
+	// 峰值远高于 RMS 的输入: 放大到目标 RMS 时峰值须截断在 int16 范围内而不是回绕
+	samples := make([]int16, 1000)
+	samples[0], samples[1] = 4000, -4000
+	out := normalize(samples, 1500) // 增益约 8.4
+	if out[0] != math.MaxInt16 || out[1] != math.MinInt16 {
+		t.Fatalf("peaks = %d, %d, want %d, %d", out[0], out[1], math.MaxInt16, math.MinInt16)
+	}
+
+	// 满幅正弦放大后每个采样的符号应与输入一致 (溢出回绕会翻转符号)
+	in := sineSamples(8000, 30000)
+	out = normalize(in, 30000)
+	for i := range in {
+		if (in[i] > 0 && out[i] < 0) || (in[i] < 0 && out[i] > 0) {
+			t.Fatalf("sample %d wrapped around: %d -> %d", i, in[i], out[i])
+		}
+	}
+}
+
+func TestNormalizeGainLimit(t *testing.T) {
+	out := normalize(sineSamples(8000, 10), DEFAULT_AGC_TARGET_RMS)
+	want := rms(sineSamples(8000, 10)) * AGC_MAX_GAIN
+	if got := rms(out); math.Abs(got-want) > 1 {
+		t.Fatalf("RMS = %.2f, want %.2f (gain limited to %g)", got, want, AGC_MAX_GAIN)
+	}
+}
+
+func TestNormalizeSilence(t *testing.T) {
+	out := normalize(make([]int16, 100), DEFAULT_AGC_TARGET_RMS)
+	for _, s := range out {
+		if s != 0 {
+			t.Fatalf("normalize(silence) = %v, want silence", out)
+		}
+	}
+	if len(normalize(nil, DEFAULT_AGC_TARGET_RMS)) != 0 {
+		t.Fatal("normalize(nil) returned samples")
+	}
+}
+
+func TestNormalizePCM(t *testing.T) {
+	in := sineSamples(800, 1000)
+	pcm := make([]byte, len(in)*2)
+	for i, s := range in {
+		binary.LittleEndian.PutUint16(pcm[2*i:], uint16(s))
+	}
+	out := normalizePCM(pcm, DEFAULT_AGC_TARGET_RMS)
+	if len(out) != len(pcm) {
+		t.Fatalf("len = %d, want %d", len(out), len(pcm))
+	}
+	if got := rms(pcmSamples(out)); math.Abs(got-DEFAULT_AGC_TARGET_RMS) > DEFAULT_AGC_TARGET_RMS*0.01 {
+		t.Fatalf("RMS = %.1f, want about %.1f", got, DEFAULT_AGC_TARGET_RMS)
+	}
+}
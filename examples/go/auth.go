@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Authenticator 校验客户端凭证, 通过时返回用户标识
+//
+// 自定义实现 (如 JWT、调用鉴权服务) 在 main 中赋值给 authenticator 即可。
+type Authenticator interface {
+	Authenticate(token string) (user string, ok bool)
+}
+
+// staticTokens 按静态令牌列表校验, 用户标识为令牌在列表中的序号
+type staticTokens []string
+
+// Authenticate 常量时间比较, 避免通过响应时间推测令牌
+func (t staticTokens) Authenticate(token string) (string, bool) {
+	for i, want := range t {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(want)) == 1 {
+			return fmt.Sprintf("token-%d", i+1), true
+		}
+	}
+	return "", false
+}
+
+// newAuthenticator 按配置构建鉴权器, 未配置令牌时返回 nil (不鉴权)
+func newAuthenticator(c *Config) Authenticator {
+	if len(c.AuthTokens) == 0 {
+		return nil
+	}
+	return staticTokens(c.AuthTokens)
+}
+
+// authenticator 当前生效的鉴权器, nil 表示不鉴权
+var authenticator Authenticator
+
+// requestToken 取请求携带的令牌: Authorization: Bearer 优先, 其次 ?token= 查询参数
+//
+// 浏览器 WebSocket API 无法设置请求头, 只能通过查询参数传递。
+func requestToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); h != "" {
+		scheme, token, found := strings.Cut(h, " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	return r.URL.Query().Get("token")
+}
+
+// authenticate 校验请求, 未启用鉴权时总是通过且用户标识为空
+func authenticate(r *http.Request) (string, bool) {
+	if authenticator == nil {
+		return "", true
+	}
+	token := requestToken(r)
+	if token == "" {
+		return "", false
+	}
+	return authenticator.Authenticate(token)
+}
+
+// rejectUnauthorized 在升级前以 401 拒绝连接
+func rejectUnauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="websocket-server"`)
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// 熔断器状态, 由 /stats 报告
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// 熔断的默认阈值 (连续故障次数) 与冷却时间
+const (
+	BREAKER_THRESHOLD = 5
+	BREAKER_COOLDOWN  = 30 * time.Second
+)
+
+// BREAKER_PROBE_RETRY 半开状态下探测请求进行中时, 其他请求建议的重试等待时间
+const BREAKER_PROBE_RETRY = time.Second
+
+// 熔断器指标, engine 标签为 tts、asr 或 tts/<route>、asr/<route>
+var (
+	breakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "backend_circuit_state",
+		Help: "Backend circuit breaker state: 0 closed, 1 open, 2 half-open.",
+	}, []string{"engine"})
+
+	breakerOpenedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_circuit_opened_total",
+		Help: "Total number of times the backend circuit breaker opened.",
+	}, []string{"engine"})
+
+	breakerRejectedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_circuit_rejected_total",
+		Help: "Total requests fast-failed by an open backend circuit breaker.",
+	}, []string{"engine"})
+)
+
+// breakerStateValues backend_circuit_state 的取值
+var breakerStateValues = map[string]float64{BreakerClosed: 0, BreakerOpen: 1, BreakerHalfOpen: 2}
+
+// circuitOpenError 熔断打开时快速失败的错误, 视为 errBackendUnavailable
+type circuitOpenError struct {
+	engine     string
+	retryAfter time.Duration
+}
+
+func (e *circuitOpenError) Error() string {
+	return fmt.Sprintf("circuit open for %s engine", e.engine)
+}
+
+func (e *circuitOpenError) Unwrap() error {
+	return errBackendUnavailable
+}
+
+// circuitBreaker 单个引擎实例的熔断器
+//
+// 连续 breaker_threshold 次后端故障后打开, breaker_cooldown 内的调用直接失败; 冷却结束后半开,
+// 只放行一次探测调用, 成功则关闭, 失败则重新打开。阈值与冷却时间按每次调用所在连接的配置。
+type circuitBreaker struct {
+	name string
+
+	mu       sync.Mutex
+	state    string
+	failures int // 连续故障次数
+	openedAt time.Time
+	probing  bool // 半开状态下已放行探测调用
+}
+
+func newCircuitBreaker(name string) *circuitBreaker {
+	b := &circuitBreaker{name: name, state: BreakerClosed}
+	breakerState.WithLabelValues(name).Set(breakerStateValues[BreakerClosed])
+	return b
+}
+
+// breakers 各引擎实例的熔断器, main 中创建引擎时注册, 之后只读
+var breakers = map[interface{}]*circuitBreaker{}
+
+// registerBreaker 为引擎实例 engine 注册名为 name 的熔断器, engine 须为可比较类型 (通常为指针)
+//
+// 注册的应为实际调用后端的引擎, 而非缓存包装, 使缓存命中不受熔断影响。
+func registerBreaker(name string, engine interface{}) {
+	breakers[engine] = newCircuitBreaker(name)
+}
+
+// breakerFor 返回 engine 的熔断器, 未注册时返回 nil
+func breakerFor(engine interface{}) *circuitBreaker {
+	return breakers[engine]
+}
+
+// setState 切换状态并更新指标, 须持有 mu
+func (b *circuitBreaker) setState(state string) {
+	b.state = state
+	breakerState.WithLabelValues(b.name).Set(breakerStateValues[state])
+}
+
+// allow 按配置 c 判断是否放行一次调用, 熔断打开时返回 *circuitOpenError; b 为 nil 或未启用熔断时总是放行
+func (b *circuitBreaker) allow(c *Config) error {
+	if b == nil {
+		return nil
+	}
+	if c.BreakerThreshold == 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if elapsed := time.Since(b.openedAt); elapsed < c.BreakerCooldown {
+			breakerRejectedTotal.WithLabelValues(b.name).Inc()
+			return &circuitOpenError{engine: b.name, retryAfter: c.BreakerCooldown - elapsed}
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+		slog.Info("后端熔断半开, 放行探测请求", "engine", b.name)
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			breakerRejectedTotal.WithLabelValues(b.name).Inc()
+			return &circuitOpenError{engine: b.name, retryAfter: BREAKER_PROBE_RETRY}
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record 记录一次放行调用的结果: err 为 nil 时成功, failed 时计为后端故障, 其他错误 (如被打断) 不影响计数
+func (b *circuitBreaker) record(err error, failed bool, c *Config) {
+	if b == nil {
+		return
+	}
+	if c.BreakerThreshold == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	wasProbe := b.state == BreakerHalfOpen && b.probing
+	switch {
+	case err == nil:
+		b.failures = 0
+		if b.state != BreakerClosed {
+			b.setState(BreakerClosed)
+			slog.Info("后端熔断关闭, 恢复正常", "engine", b.name)
+		}
+	case failed:
+		b.failures++
+		if wasProbe || (b.state == BreakerClosed && b.failures >= c.BreakerThreshold) {
+			b.setState(BreakerOpen)
+			b.openedAt = time.Now()
+			breakerOpenedTotal.WithLabelValues(b.name).Inc()
+			slog.Warn("后端熔断打开", "engine", b.name, "consecutive_failures", b.failures,
+				"cooldown", c.BreakerCooldown, "error", err)
+		}
+	}
+	if wasProbe {
+		b.probing = false
+	}
+}
+
+// BreakerStats /stats 中的一个熔断器
+type BreakerStats struct {
+	Engine              string `json:"engine"`
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+}
+
+// breakerStats 返回各熔断器的当前状态, 按名称排序
+func breakerStats() []BreakerStats {
+	out := make([]BreakerStats, 0, len(breakers))
+	for _, b := range breakers {
+		b.mu.Lock()
+		out = append(out, BreakerStats{Engine: b.name, State: b.state, ConsecutiveFailures: b.failures})
+		b.mu.Unlock()
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Engine < out[j].Engine })
+	return out
+}
+
+// isSynthesisFailure 判断合成错误是否计为后端故障: 后端不可用与合成失败计入,
+// 客户端打断、请求本身的问题 (如录音不存在) 与 synthesis_timeout 超时不计入
+//
+// 超时包含服务端按实时节奏发送的时间 (以及慢速客户端), 不能说明后端故障; 后端无响应由引擎按其自身的期限
+// (如 gRPC 后端的 GRPC_CHUNK_TIMEOUT) 报告为 errBackendUnavailable, 照常计入。
+func isSynthesisFailure(err error) bool {
+	return errors.Is(err, errBackendUnavailable) || errors.Is(err, errSynthesisFailed)
+}
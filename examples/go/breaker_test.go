@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	setTestConfig(t, func(c *Config) {
+		c.BreakerThreshold = 3
+		c.BreakerCooldown = 50 * time.Millisecond
+	})
+	cfg := currentConfig()
+	b := newCircuitBreaker("test/threshold")
+	failure := fmt.Errorf("%w: connection refused", errBackendUnavailable)
+
+	for i := 0; i < 3; i++ {
+		if err := b.allow(cfg); err != nil {
+			t.Fatalf("allow() before threshold = %v", err)
+		}
+		b.record(failure, isSynthesisFailure(failure), cfg)
+	}
+	err := b.allow(cfg)
+	var open *circuitOpenError
+	if !errors.As(err, &open) || !errors.Is(err, errBackendUnavailable) {
+		t.Fatalf("allow() after threshold = %v, want *circuitOpenError", err)
+	}
+	if open.retryAfter <= 0 || open.retryAfter > 50*time.Millisecond {
+		t.Fatalf("retryAfter = %s", open.retryAfter)
+	}
+
+	// 冷却后半开: 只放行一次探测, 成功后关闭
+	time.Sleep(60 * time.Millisecond)
+	if err := b.allow(cfg); err != nil {
+		t.Fatalf("allow() after cooldown = %v, want probe", err)
+	}
+	if b.state != BreakerHalfOpen {
+		t.Fatalf("state = %s, want %s", b.state, BreakerHalfOpen)
+	}
+	if err := b.allow(cfg); !errors.As(err, &open) || open.retryAfter != BREAKER_PROBE_RETRY {
+		t.Fatalf("second allow() while probing = %v, want probe retry", err)
+	}
+	b.record(nil, false, cfg)
+	if b.state != BreakerClosed || b.failures != 0 {
+		t.Fatalf("after successful probe state = %s failures = %d", b.state, b.failures)
+	}
+}
+
+func TestCircuitBreakerFailedProbeReopens(t *testing.T) {
+	setTestConfig(t, func(c *Config) {
+		c.BreakerThreshold = 1
+		c.BreakerCooldown = 10 * time.Millisecond
+	})
+	cfg := currentConfig()
+	b := newCircuitBreaker("test/probe")
+	b.allow(cfg)
+	b.record(errSynthesisFailed, true, cfg)
+	time.Sleep(20 * time.Millisecond)
+	if err := b.allow(cfg); err != nil {
+		t.Fatalf("allow() after cooldown = %v", err)
+	}
+	b.record(errSynthesisFailed, true, cfg)
+	if b.state != BreakerOpen {
+		t.Fatalf("state after failed probe = %s, want %s", b.state, BreakerOpen)
+	}
+}
+
+func TestCircuitBreakerTimeoutsAndInterrupts(t *testing.T) {
+	setTestConfig(t, func(c *Config) { c.BreakerThreshold = 2 })
+	cfg := currentConfig()
+	b := newCircuitBreaker("test/timeouts")
+	for _, err := range []error{
+		&synthesisTimeoutError{timeout: time.Minute},
+		context.DeadlineExceeded,
+		context.Canceled,
+		errPromptNotFound,
+	} {
+		for i := 0; i < 5; i++ {
+			if allowErr := b.allow(cfg); allowErr != nil {
+				t.Fatalf("allow() after %v = %v", err, allowErr)
+			}
+			b.record(err, isSynthesisFailure(err), cfg)
+		}
+	}
+	if b.state != BreakerClosed || b.failures != 0 {
+		t.Fatalf("state = %s failures = %d, want closed with no failures", b.state, b.failures)
+	}
+
+	// 后端接受调用但不返回音频: 由引擎自身的期限报告为后端不可用, 计入故障
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(grpc.UnknownServiceHandler(func(_ any, stream grpc.ServerStream) error {
+		<-stream.Context().Done()
+		return nil
+	}))
+	go srv.Serve(lis)
+	defer srv.Stop()
+	engine, err := NewGRPCTTSEngine(lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.chunkTimeout = 50 * time.Millisecond
+	for i := 0; i < 2; i++ {
+		if allowErr := b.allow(cfg); allowErr != nil {
+			t.Fatalf("allow() = %v before threshold", allowErr)
+		}
+		err := engine.SynthesizeContext(context.Background(), TTSRequest{Text: "你好"}, func([]byte) {}, nil)
+		if !errors.Is(err, errBackendUnavailable) {
+			t.Fatalf("hung backend err = %v, want errBackendUnavailable", err)
+		}
+		b.record(err, isSynthesisFailure(err), cfg)
+	}
+	if b.state != BreakerOpen {
+		t.Fatalf("state = %s after hung backend, want open", b.state)
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	setTestConfig(t, func(c *Config) { c.BreakerThreshold = 0 })
+	cfg := currentConfig()
+	b := newCircuitBreaker("test/disabled")
+	for i := 0; i < 10; i++ {
+		if err := b.allow(cfg); err != nil {
+			t.Fatalf("allow() = %v with breaker disabled", err)
+		}
+		b.record(errSynthesisFailed, true, cfg)
+	}
+	var nilBreaker *circuitBreaker
+	if err := nilBreaker.allow(cfg); err != nil {
+		t.Fatalf("nil breaker allow() = %v", err)
+	}
+	nilBreaker.record(errSynthesisFailed, true, cfg)
+}
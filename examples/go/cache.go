@@ -0,0 +1,201 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TTS_CACHE_MAX_ENTRY_BYTES 单条缓存的音频字节数上限, 超过时不缓存 (长文本很少重复)
+const TTS_CACHE_MAX_ENTRY_BYTES = 1 << 20
+
+// cachedItem 缓存的一帧音频或一个事件, 按发送顺序保存
+type cachedItem struct {
+	frame []byte
+	event interface{}
+}
+
+// audioCache 合成结果的 LRU 缓存
+type audioCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // 最近使用的在前, 元素为 *cacheEntry
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key   string
+	items []cachedItem
+}
+
+func newAudioCache(size int) *audioCache {
+	return &audioCache{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// get 取缓存并标记为最近使用
+func (c *audioCache) get(key string) ([]cachedItem, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*cacheEntry).items, true
+}
+
+// put 写入缓存, 超过容量时淘汰最久未使用的条目
+func (c *audioCache) put(key string, items []cachedItem) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*cacheEntry).items = items
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, items: items})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// ttsCacheKey 由影响合成音频的参数计算缓存键, req 须已应用默认值
+//
+// realtime 只影响发送节奏, 不参与计算; fade_in 时计入 c 的 fade_ms。
+func ttsCacheKey(req TTSRequest, c *Config) string {
+	fadeInMs := 0
+	if req.FadeIn {
+		fadeInMs = c.FadeMs
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%q|%q|%g|%g|%g|%d|%q|%q|%d|%d|%t|%t|%t|%d|%d|%d",
+		req.Text, req.Voice, req.Speed, req.Pitch, req.Volume,
+		req.SampleRate, req.Encoding, req.Endian, req.Channels, req.FrameMs, req.Marks, req.FrameMeta, req.Progress,
+		req.LeadSilenceMs, req.TrailSilenceMs, fadeInMs)
+	for _, s := range req.Segments {
+		fmt.Fprintf(h, "|%q:%q", s.Text, s.Prompt)
+	}
+	for _, e := range req.Lexicon {
+		fmt.Fprintf(h, "|%q=%q", e.Word, e.Pron)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cachingSynthesizer 为任意引擎加上合成结果缓存
+//
+// 未命中时调用内部引擎并记录帧与事件, 合成成功后写入缓存; 命中时按原顺序重放,
+// 实时模式下按帧时长发送。帧数据复制后保存, 不引用引擎复用的缓冲。
+// 缓存保存引擎的原始输出, 软限幅由外层的 runSynthesizer 在发送时进行。
+type cachingSynthesizer struct {
+	inner Synthesizer
+	cache *audioCache
+}
+
+func newCachingSynthesizer(inner Synthesizer, size int) *cachingSynthesizer {
+	return &cachingSynthesizer{inner: inner, cache: newAudioCache(size)}
+}
+
+// Synthesize 合成语音
+func (s *cachingSynthesizer) Synthesize(req TTSRequest, sendFrame func([]byte), onComplete func()) {
+	if s.SynthesizeContext(context.Background(), req, sendFrame, nil) == nil {
+		onComplete()
+	}
+}
+
+// SynthesizeContext 合成语音, 命中缓存时直接重放
+func (s *cachingSynthesizer) SynthesizeContext(ctx context.Context, req TTSRequest,
+	sendFrame func([]byte), sendEvent func(interface{})) error {
+	// 调试用的发送扰动每次合成都不同, 不读写缓存
+	if req.hasDebugTiming() {
+		return callWithBreaker(ctx, s.inner, req, sendFrame, sendEvent)
+	}
+	cfg := configFrom(ctx)
+	keyReq := req
+	applyTTSDefaults(&keyReq, cfg)
+	key := ttsCacheKey(keyReq, cfg)
+
+	if items, ok := s.cache.get(key); ok {
+		ttsCacheHits.Inc()
+		loggerFrom(ctx).Info("TTS 缓存命中", "text", req.Text)
+		return replayCached(ctx, items, keyReq, sendFrame, sendEvent)
+	}
+	ttsCacheMisses.Inc()
+
+	// 续传时缺少已跳过的帧, 结果不完整, 不写入缓存
+	record := req.ResumeFrame == 0
+	var items []cachedItem
+	size := 0
+	err := callWithBreaker(ctx, s.inner, req,
+		func(frame []byte) {
+			if record {
+				size += len(frame)
+				items = append(items, cachedItem{frame: append([]byte(nil), frame...)})
+			}
+			sendFrame(frame)
+		},
+		func(event interface{}) {
+			if record {
+				items = append(items, cachedItem{event: event})
+			}
+			if sendEvent != nil {
+				sendEvent(event)
+			}
+		},
+	)
+	if err == nil && record && size <= TTS_CACHE_MAX_ENTRY_BYTES {
+		s.cache.put(key, items)
+	}
+	return err
+}
+
+// replayCached 按原顺序发送缓存的帧与事件, req.ResumeFrame 之前的帧被跳过
+func replayCached(ctx context.Context, items []cachedItem, req TTSRequest,
+	sendFrame func([]byte), sendEvent func(interface{})) error {
+	var ticker *time.Ticker
+	if req.Realtime == nil || *req.Realtime {
+		ticker = time.NewTicker(time.Duration(req.FrameMs) * time.Millisecond)
+		defer ticker.Stop()
+	}
+
+	start := time.Now()
+	frames := 0
+	for _, item := range items {
+		if item.frame == nil {
+			// 续传时 audio_start 照常发送, 已跳过部分的时间标记不再发送
+			_, isStart := item.event.(AudioStart)
+			if sendEvent != nil && (isStart || frames >= req.ResumeFrame) {
+				event := item.event
+				if p, ok := event.(ProgressEvent); ok {
+					// 进度的耗时按本次重放计算
+					p.ElapsedMs = time.Since(start).Milliseconds()
+					event = p
+				}
+				sendEvent(event)
+			}
+			continue
+		}
+		if frames < req.ResumeFrame {
+			frames++
+			continue
+		}
+		if ticker != nil && frames > req.ResumeFrame {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		sendFrame(item.frame)
+		audioBytesSent.Add(float64(len(item.frame)))
+		frames++
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestAudioCacheLRU(t *testing.T) {
+	c := newAudioCache(2)
+	item := func(b byte) []cachedItem { return []cachedItem{{frame: []byte{b}}} }
+	c.put("a", item(1))
+	c.put("b", item(2))
+	if _, ok := c.get("a"); !ok { // a 变为最近使用
+		t.Fatal("a missing")
+	}
+	c.put("c", item(3))
+	if _, ok := c.get("b"); ok {
+		t.Fatal("b not evicted as least recently used")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.get(key); !ok {
+			t.Fatalf("%s evicted", key)
+		}
+	}
+
+	c.put("a", item(9))
+	if items, _ := c.get("a"); items[0].frame[0] != 9 {
+		t.Fatalf("put did not replace the existing entry: %v", items)
+	}
+	if c.order.Len() != 2 || len(c.entries) != 2 {
+		t.Fatalf("cache holds %d/%d entries, want 2", c.order.Len(), len(c.entries))
+	}
+}
+
+func TestTTSCacheKey(t *testing.T) {
+	cfg := DefaultConfig()
+	base := TTSRequest{Text: "你好", Voice: "xiaoyun"}
+	applyTTSDefaults(&base, cfg)
+	key := ttsCacheKey(base, cfg)
+
+	realtime := false
+	same := base
+	same.Realtime = &realtime
+	if ttsCacheKey(same, cfg) != key {
+		t.Error("realtime changed the cache key")
+	}
+	for name, edit := range map[string]func(*TTSRequest){
+		"text":        func(r *TTSRequest) { r.Text = "再见" },
+		"speed":       func(r *TTSRequest) { r.Speed = 1.5 },
+		"sample_rate": func(r *TTSRequest) { r.SampleRate = 16000 },
+		"encoding":    func(r *TTSRequest) { r.Encoding = EncodingULaw },
+		"lead":        func(r *TTSRequest) { r.LeadSilenceMs = 100 },
+		"lexicon":     func(r *TTSRequest) { r.Lexicon = []LexiconEntry{{Word: "你好", Pron: "ni3 hao3"}} },
+		"fade_in":     func(r *TTSRequest) { r.FadeIn = true },
+	} {
+		req := base
+		edit(&req)
+		if ttsCacheKey(req, cfg) == key {
+			t.Errorf("%s did not change the cache key", name)
+		}
+	}
+}
+
+// countingSynthesizer 记录调用次数的演示引擎, fail 时合成失败
+type countingSynthesizer struct {
+	TTSEngine
+	calls int
+	fail  bool
+}
+
+func (s *countingSynthesizer) SynthesizeContext(ctx context.Context, req TTSRequest,
+	sendFrame func([]byte), sendEvent func(interface{})) error {
+	s.calls++
+	if s.fail {
+		return errSynthesisFailed
+	}
+	return s.TTSEngine.SynthesizeContext(ctx, req, sendFrame, sendEvent)
+}
+
+// recordSynthesis 合成并记录帧 (复制) 与事件
+func recordSynthesis(t *testing.T, s Synthesizer, req TTSRequest) ([][]byte, []interface{}, error) {
+	t.Helper()
+	var frames [][]byte
+	var events []interface{}
+	ctx := withLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	err := callSynthesizer(ctx, s, req,
+		func(frame []byte) { frames = append(frames, append([]byte(nil), frame...)) },
+		func(event interface{}) { events = append(events, event) })
+	return frames, events, err
+}
+
+func TestCachingSynthesizerReplays(t *testing.T) {
+	setTestConfig(t, nil)
+	inner := &countingSynthesizer{}
+	engine := newCachingSynthesizer(inner, 4)
+	realtime := false
+	req := TTSRequest{Text: `<speak>你好<mark name="m"/>再见</speak>`, Voice: "xiaoyun", Realtime: &realtime}
+
+	frames, events, err := recordSynthesis(t, engine, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cachedFrames, cachedEvents, err := recordSynthesis(t, engine, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inner.calls != 1 {
+		t.Fatalf("inner engine called %d times, want 1", inner.calls)
+	}
+	// 引擎复用帧缓冲, 缓存须保存副本, 重放的内容与首次合成一致
+	if len(cachedFrames) != len(frames) || len(frames) == 0 {
+		t.Fatalf("replayed %d frames, want %d", len(cachedFrames), len(frames))
+	}
+	for i := range frames {
+		if !bytes.Equal(cachedFrames[i], frames[i]) {
+			t.Fatalf("replayed frame %d differs", i)
+		}
+	}
+	if len(cachedEvents) != len(events) || len(events) == 0 || cachedEvents[0] != events[0] {
+		t.Fatalf("replayed events %v, want %v", cachedEvents, events)
+	}
+
+	// 不同的参数不命中
+	other := req
+	other.Speed = 1.5
+	if _, _, err := recordSynthesis(t, engine, other); err != nil {
+		t.Fatal(err)
+	}
+	if inner.calls != 2 {
+		t.Fatalf("inner engine called %d times, want 2", inner.calls)
+	}
+}
+
+func TestCachingSynthesizerResume(t *testing.T) {
+	setTestConfig(t, nil)
+	inner := &countingSynthesizer{}
+	engine := newCachingSynthesizer(inner, 4)
+	realtime := false
+	req := TTSRequest{Text: "你好", Voice: "xiaoyun", Realtime: &realtime}
+	frames, _, err := recordSynthesis(t, engine, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 续传从缓存中跳过已发送的帧
+	req.ResumeFrame = 5
+	resumed, _, err := recordSynthesis(t, engine, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inner.calls != 1 || len(resumed) != len(frames)-5 || !bytes.Equal(resumed[0], frames[5]) {
+		t.Fatalf("resume: calls=%d, %d frames, want 1 call and %d frames from frame 5", inner.calls, len(resumed), len(frames)-5)
+	}
+}
+
+func TestCachingSynthesizerSkipsFailuresAndPartialResults(t *testing.T) {
+	setTestConfig(t, nil)
+	inner := &countingSynthesizer{fail: true}
+	engine := newCachingSynthesizer(inner, 4)
+	realtime := false
+	req := TTSRequest{Text: "你好", Voice: "xiaoyun", Realtime: &realtime}
+	if _, _, err := recordSynthesis(t, engine, req); !errors.Is(err, errSynthesisFailed) {
+		t.Fatalf("err = %v, want errSynthesisFailed", err)
+	}
+	inner.fail = false
+	if _, _, err := recordSynthesis(t, engine, req); err != nil {
+		t.Fatal(err)
+	}
+	if inner.calls != 2 {
+		t.Fatalf("failed synthesis was cached: inner engine called %d times, want 2", inner.calls)
+	}
+
+	// 续传的结果不完整, 不写入缓存
+	partial := TTSRequest{Text: "再见", Voice: "xiaoyun", Realtime: &realtime, ResumeFrame: 3}
+	for i := 0; i < 2; i++ {
+		if _, _, err := recordSynthesis(t, engine, partial); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if inner.calls != 4 {
+		t.Fatalf("resumed synthesis was cached: inner engine called %d times, want 4", inner.calls)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CalibrationPoint 置信度校准曲线上的一点: 引擎给出的 Raw 映射为 Calibrated
+type CalibrationPoint struct {
+	Raw        float64 `yaml:"raw"`
+	Calibrated float64 `yaml:"calibrated"`
+}
+
+// parseCalibration 解析 WS_CONFIDENCE_CALIBRATION, 格式为 "raw:calibrated,...", 如 "0:0,0.6:0.4,1:1"
+func parseCalibration(s string) ([]CalibrationPoint, error) {
+	var points []CalibrationPoint
+	for _, item := range strings.Split(s, ",") {
+		raw, calibrated, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid calibration point '%s'", item)
+		}
+		r, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid calibration point '%s'", item)
+		}
+		c, err := strconv.ParseFloat(calibrated, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid calibration point '%s'", item)
+		}
+		points = append(points, CalibrationPoint{Raw: r, Calibrated: c})
+	}
+	return points, nil
+}
+
+// checkCalibration 校验校准曲线: 为空表示不校准, 否则至少两点, 取值在 [0, 1],
+// raw 严格递增且 calibrated 不递减, 保证映射单调, 候选的排序不变
+func checkCalibration(points []CalibrationPoint) error {
+	if len(points) == 0 {
+		return nil
+	}
+	if len(points) < 2 {
+		return fmt.Errorf("confidence_calibration needs at least 2 points")
+	}
+	for i, p := range points {
+		if p.Raw < 0 || p.Raw > 1 || p.Calibrated < 0 || p.Calibrated > 1 {
+			return fmt.Errorf("confidence_calibration point %d out of range [0, 1]", i)
+		}
+		if i > 0 && (p.Raw <= points[i-1].Raw || p.Calibrated < points[i-1].Calibrated) {
+			return fmt.Errorf("confidence_calibration must be monotonic (point %d)", i)
+		}
+	}
+	return nil
+}
+
+// interpolateCalibration 按分段线性曲线映射 raw, 曲线范围之外取端点的值; points 为空时原样返回
+func interpolateCalibration(points []CalibrationPoint, raw float64) float64 {
+	if len(points) == 0 {
+		return raw
+	}
+	if raw <= points[0].Raw {
+		return points[0].Calibrated
+	}
+	for i := 1; i < len(points); i++ {
+		lo, hi := points[i-1], points[i]
+		if raw <= hi.Raw {
+			return lo.Calibrated + (raw-lo.Raw)/(hi.Raw-lo.Raw)*(hi.Calibrated-lo.Calibrated)
+		}
+	}
+	return points[len(points)-1].Calibrated
+}
+
+// calibrateConfidence 按 c 的 confidence_calibration 校准置信度
+func calibrateConfidence(raw float64, c *Config) float64 {
+	return interpolateCalibration(c.ConfidenceCalibration, raw)
+}
+
+// calibrateNLSML 按 c 校准每个 <interpretation> 的 confidence, 供之后的过滤与格式转换使用
+//
+// 未配置校准或结果无法解析时按原样返回; 无法解析的 confidence 保持不变。
+func calibrateNLSML(nlsml string, c *Config) string {
+	if len(c.ConfidenceCalibration) == 0 {
+		return nlsml
+	}
+
+	decoder := xml.NewDecoder(strings.NewReader(nlsml))
+	var b strings.Builder
+	last := 0
+	for {
+		start := int(decoder.InputOffset())
+		tok, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nlsml
+		}
+		t, ok := tok.(xml.StartElement)
+		if !ok || t.Name.Local != "interpretation" {
+			continue
+		}
+		end := int(decoder.InputOffset())
+		for i, a := range t.Attr {
+			if a.Name.Space != "" || a.Name.Local != "confidence" {
+				continue
+			}
+			if raw, err := strconv.ParseFloat(a.Value, 64); err == nil {
+				t.Attr[i].Value = strconv.FormatFloat(calibrateConfidence(raw, c), 'f', 2, 64)
+			}
+		}
+		b.WriteString(nlsml[last:start])
+		writeStartTag(&b, t, strings.HasSuffix(nlsml[start:end], "/>"))
+		last = end
+	}
+	b.WriteString(nlsml[last:])
+	return b.String()
+}
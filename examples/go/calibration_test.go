@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/xml"
+	"math"
+	"testing"
+)
+
+func TestInterpolateCalibration(t *testing.T) {
+	points := []CalibrationPoint{{0.2, 0}, {0.6, 0.4}, {0.9, 0.95}}
+	tests := []struct{ raw, want float64 }{
+		{0, 0},        // 低于首点取首点的值
+		{0.2, 0},      // 端点
+		{0.4, 0.2},    // 第一段中点
+		{0.6, 0.4},    // 中间点
+		{0.75, 0.675}, // 第二段中点
+		{0.9, 0.95},   // 末点
+		{1, 0.95},     // 高于末点取末点的值
+	}
+	for _, tt := range tests {
+		if got := interpolateCalibration(points, tt.raw); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("interpolateCalibration(%g) = %g, want %g", tt.raw, got, tt.want)
+		}
+	}
+	if got := interpolateCalibration(nil, 0.37); got != 0.37 {
+		t.Errorf("interpolateCalibration without points = %g, want 0.37", got)
+	}
+}
+
+func TestInterpolateCalibrationMonotonic(t *testing.T) {
+	points := []CalibrationPoint{{0, 0}, {0.5, 0.5}, {0.6, 0.5}, {1, 1}}
+	prev := -1.0
+	for raw := 0.0; raw <= 1; raw += 0.01 {
+		got := interpolateCalibration(points, raw)
+		if got < prev {
+			t.Fatalf("interpolateCalibration(%g) = %g, lower than %g", raw, got, prev)
+		}
+		prev = got
+	}
+}
+
+func TestParseCalibration(t *testing.T) {
+	points, err := parseCalibration("0:0, 0.6:0.4,1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 3 || points[1] != (CalibrationPoint{0.6, 0.4}) {
+		t.Fatalf("parseCalibration = %+v", points)
+	}
+	for _, s := range []string{"0.5", "a:0", "0:b", ""} {
+		if _, err := parseCalibration(s); err == nil {
+			t.Errorf("parseCalibration(%q) succeeded", s)
+		}
+	}
+}
+
+func TestCheckCalibration(t *testing.T) {
+	tests := []struct {
+		points []CalibrationPoint
+		ok     bool
+	}{
+		{nil, true},
+		{[]CalibrationPoint{{0, 0}, {1, 1}}, true},
+		{[]CalibrationPoint{{0, 0}, {0.5, 0.5}, {1, 0.5}}, true},
+		{[]CalibrationPoint{{0.5, 0.5}}, false},
+		{[]CalibrationPoint{{0, 0}, {1.2, 1}}, false},
+		{[]CalibrationPoint{{0, 0}, {0.5, -0.1}}, false},
+		{[]CalibrationPoint{{0.5, 0}, {0.5, 1}}, false},
+		{[]CalibrationPoint{{0, 0.6}, {1, 0.4}}, false},
+	}
+	for _, tt := range tests {
+		if err := checkCalibration(tt.points); (err == nil) != tt.ok {
+			t.Errorf("checkCalibration(%+v) = %v, want ok=%v", tt.points, err, tt.ok)
+		}
+	}
+}
+
+func TestCalibrateNLSML(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ConfidenceCalibration = []CalibrationPoint{{0, 0}, {0.8, 0.4}, {1, 1}}
+	engine := &ASREngine{}
+	out := calibrateNLSML(engine.GenerateNBestNLSML(engine.demoCandidates(), 0), cfg)
+	var r parsedNLSML
+	if err := xml.Unmarshal([]byte(out), &r); err != nil {
+		t.Fatalf("calibrated NLSML is not well-formed: %v\n%s", err, out)
+	}
+	// 0.95 -> 0.85, 0.81 -> 0.43, 0.62 -> 0.31
+	want := []string{"0.85", "0.43", "0.31"}
+	for i, in := range r.Interpretations {
+		if in.Confidence != want[i] {
+			t.Errorf("interpretation %d confidence = %s, want %s", i, in.Confidence, want[i])
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+// 服务端主动关闭连接时 Close 帧的关闭码
+//
+// 4000-4999 为应用自定义的关闭码, 表示服务端按策略断开 (客户端可据此区分服务端崩溃或网络中断的 1006);
+// 关机、连续解析失败 (违反协议) 与音频超长沿用标准的 1001 / 1008 / 1009。原因为对应的 CLOSE_REASON_*。
+const (
+	CLOSE_READ_TIMEOUT  = 4000 // READ_TIMEOUT 内未收到任何数据或 Pong
+	CLOSE_SLOW_CONSUMER = 4001 // 客户端读取过慢, 发送队列持续满或写入超时
+)
+
+// Close 帧的原因, 与关闭码一一对应, 便于日志与客户端按字符串匹配
+const (
+	CLOSE_REASON_READ_TIMEOUT   = "READ_TIMEOUT"
+	CLOSE_REASON_SLOW_CONSUMER  = "SLOW_CONSUMER"
+	CLOSE_REASON_PARSE_ERRORS   = "TOO_MANY_PARSE_ERRORS"
+	CLOSE_REASON_SHUTDOWN       = "SERVER_SHUTDOWN"
+	CLOSE_REASON_AUDIO_TOO_LONG = "AUDIO_TOO_LONG"
+)
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// readUntilClose 读取消息直到连接关闭, 返回 Close 帧的关闭码与原因
+func readUntilClose(t *testing.T, conn *websocket.Conn) (int, string) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			var ce *websocket.CloseError
+			if !errors.As(err, &ce) {
+				t.Fatalf("connection ended without a close frame: %v", err)
+			}
+			return ce.Code, ce.Text
+		}
+	}
+}
+
+func TestTTSClosesAfterRepeatedParseErrors(t *testing.T) {
+	setTestConfig(t, nil)
+	conn := dialTestWS(t, handleTTS)
+	for i := 0; i < MAX_PARSE_ERRORS; i++ {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte("\x00\x01 not json")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	code, reason := readUntilClose(t, conn)
+	if code != websocket.ClosePolicyViolation || reason != CLOSE_REASON_PARSE_ERRORS {
+		t.Fatalf("close = %d %q, want %d %q", code, reason, websocket.ClosePolicyViolation, CLOSE_REASON_PARSE_ERRORS)
+	}
+}
+
+func TestTTSParseErrorCountResetsOnValidMessage(t *testing.T) {
+	setTestConfig(t, nil)
+	conn := dialTestWS(t, handleTTS)
+	send := func(message string) {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < MAX_PARSE_ERRORS-1; i++ {
+		send("not json")
+	}
+	send(`{"action":"validate","text":"你好"}`)
+	for i := 0; i < MAX_PARSE_ERRORS-1; i++ {
+		send("not json")
+	}
+	send(`{"action":"validate","text":"你好"}`)
+
+	// 两次有效消息各自清零计数, 连接仍然可用
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	valid := 0
+	for valid < 2 {
+		var resp map[string]interface{}
+		if err := conn.ReadJSON(&resp); err != nil {
+			t.Fatalf("connection closed: %v", err)
+		}
+		if resp["status"] == "valid" {
+			valid++
+		}
+	}
+}
+
+func TestReadTimeoutCloseCode(t *testing.T) {
+	prev := readTimeout
+	readTimeout = 200 * time.Millisecond
+	t.Cleanup(func() { readTimeout = prev })
+
+	for _, h := range []struct {
+		name    string
+		handler func(http.ResponseWriter, *http.Request)
+	}{
+		{"tts", handleTTS},
+		{"asr", handleASR},
+	} {
+		t.Run(h.name, func(t *testing.T) {
+			setTestConfig(t, nil)
+			conn := dialTestWS(t, h.handler)
+			// 不发送任何数据, 也不回应 Ping (Ping 间隔远大于读超时)
+			start := time.Now()
+			code, reason := readUntilClose(t, conn)
+			if code != CLOSE_READ_TIMEOUT || reason != CLOSE_REASON_READ_TIMEOUT {
+				t.Fatalf("close = %d %q, want %d %q", code, reason, CLOSE_READ_TIMEOUT, CLOSE_REASON_READ_TIMEOUT)
+			}
+			if elapsed := time.Since(start); elapsed < readTimeout {
+				t.Fatalf("closed after %s, before the %s read timeout", elapsed, readTimeout)
+			}
+		})
+	}
+}
+
+func TestOversizedMessageCloseCode(t *testing.T) {
+	for _, h := range []struct {
+		name        string
+		handler     func(http.ResponseWriter, *http.Request)
+		messageType int
+	}{
+		{"tts", handleTTS, websocket.TextMessage},
+		{"asr", handleASR, websocket.BinaryMessage},
+	} {
+		t.Run(h.name, func(t *testing.T) {
+			setTestConfig(t, func(c *Config) { c.MaxMessageSize = 1024 })
+			conn := dialTestWS(t, h.handler)
+
+			// 恰好等于上限的消息不触发关闭, 超出 1 字节即以 1009 关闭
+			if err := conn.WriteMessage(h.messageType, make([]byte, 1024)); err != nil {
+				t.Fatal(err)
+			}
+			if err := conn.WriteMessage(h.messageType, make([]byte, 1025)); err != nil {
+				t.Fatal(err)
+			}
+			code, _ := readUntilClose(t, conn)
+			if code != websocket.CloseMessageTooBig {
+				t.Fatalf("close code = %d, want %d", code, websocket.CloseMessageTooBig)
+			}
+		})
+	}
+}
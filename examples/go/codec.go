@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ASR 输入音频编码
+const (
+	CodecPCM16 = "pcm16"
+	CodecULaw  = "ulaw"
+	CodecALaw  = "alaw"
+	CodecOpus  = "opus"
+)
+
+func init() {
+	RegisterDecoder(CodecULaw, newG711Decoder(ulawToPCM))
+	RegisterDecoder(CodecALaw, newG711Decoder(alawToPCM))
+}
+
+// Decoder 将客户端发送的压缩音频帧解码为 16-bit 小端 PCM
+//
+// 每个连接创建独立实例, 实现可以保存解码状态。
+type Decoder interface {
+	Decode(frame []byte) ([]byte, error)
+}
+
+// DecoderFactory 按采样率创建解码器, 采样率不支持时返回错误
+type DecoderFactory func(sampleRate int) (Decoder, error)
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[string]DecoderFactory{}
+)
+
+// RegisterDecoder 注册编码对应的解码器
+//
+// 示例服务不内置 Opus 解码, 接入真实编解码库时在 init 中调用:
+//
+//	RegisterDecoder(CodecOpus, newOpusDecoder)
+func RegisterDecoder(codec string, factory DecoderFactory) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	decoders[codec] = factory
+}
+
+// newDecoder 创建 codec 对应的解码器
+//
+// pcm16 (或空) 无需解码, 返回 nil。
+func newDecoder(codec string, sampleRate int) (Decoder, error) {
+	if codec == "" || codec == CodecPCM16 {
+		return nil, nil
+	}
+
+	decodersMu.RLock()
+	factory, ok := decoders[codec]
+	decodersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Unsupported codec '%s'", codec)
+	}
+	return factory(sampleRate)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// offersDeflate 判断客户端握手是否请求了 permessage-deflate 扩展
+//
+// 与 Upgrader 的协商规则一致: enable_compression 开启且客户端请求时即启用压缩。
+func offersDeflate(h http.Header) bool {
+	for _, v := range h.Values("Sec-WebSocket-Extensions") {
+		for _, ext := range strings.Split(v, ",") {
+			name, _, _ := strings.Cut(ext, ";")
+			if strings.EqualFold(strings.TrimSpace(name), "permessage-deflate") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setupCompression 升级后确认压缩协商结果, 已协商时设置压缩级别并返回 true
+//
+// 未协商时 connWriter 对压缩的开关调用均为空操作, 消息照常不压缩发送。
+func setupCompression(conn *websocket.Conn, r *http.Request, c *Config) bool {
+	if !c.EnableCompression || !offersDeflate(r.Header) {
+		return false
+	}
+	conn.SetCompressionLevel(c.CompressionLevel)
+	return true
+}
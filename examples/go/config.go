@@ -0,0 +1,731 @@
+package main
+
+import (
+	"compress/flate"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config 服务配置
+//
+// 先取默认值, 再由 YAML 文件覆盖, 最后由环境变量覆盖。
+type Config struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+
+	// AllowedOrigins 允许的浏览器 Origin 列表, 支持 "*.example.com" 通配
+	AllowedOrigins []string `yaml:"allowed_origins"`
+
+	// AllowAllOrigins 允许所有来源, 仅用于本地开发
+	AllowAllOrigins bool `yaml:"allow_all"`
+
+	// DefaultSampleRate 请求未指定采样率时使用的默认值
+	DefaultSampleRate int `yaml:"default_sample_rate"`
+
+	// MaxMessageSize 单条 WebSocket 消息 (及 HTTP TTS 请求体) 的最大字节数, 超过时以 1009 关闭连接; 0 表示不限制
+	MaxMessageSize int64 `yaml:"max_message_size"`
+
+	// MaxAudioBytes 单次 ASR 识别累积音频的最大字节数, 0 表示不限制
+	MaxAudioBytes int `yaml:"max_audio_bytes"`
+
+	// MaxTextRunes 单次 TTS 请求文本的最大字符数 (含 SSML 标记), 0 表示不限制
+	MaxTextRunes int `yaml:"max_text_runes"`
+
+	// MaxConnections/MaxConnectionsPerIP 总连接数与单 IP 连接数上限, 0 表示不限制
+	MaxConnections      int `yaml:"max_connections"`
+	MaxConnectionsPerIP int `yaml:"max_connections_per_ip"`
+
+	// ShutdownGrace 优雅关闭时等待活动连接结束的最长时间
+	ShutdownGrace time.Duration `yaml:"shutdown_grace"`
+
+	// SynthesisTimeout 单次合成 (流式为每段文本) 的最长时间, 实时发送时不短于预计音频时长的 SYNTHESIS_TIMEOUT_FACTOR 倍; 0 表示不限制
+	SynthesisTimeout time.Duration `yaml:"synthesis_timeout"`
+
+	// TTSEngine TTS 引擎实现, 默认 sine (演示用正弦波)
+	TTSEngine string `yaml:"tts_engine"`
+
+	// GRPCTTSTarget tts_engine 为 grpc 时的后端地址, 如 "tts-backend:50051"
+	GRPCTTSTarget string `yaml:"grpc_tts_target"`
+
+	// ASREngine ASR 引擎实现, 默认 demo (返回固定结果)
+	ASREngine string `yaml:"asr_engine"`
+
+	// TTSRoutes/ASRRoutes 按名称路由的附加引擎, 通过 /tts/<name>、/asr/<name> 访问; 仅能在配置文件中设置
+	TTSRoutes map[string]TTSRoute `yaml:"tts_routes"`
+	ASRRoutes map[string]ASRRoute `yaml:"asr_routes"`
+
+	// StrictASRProtocol 按 idle/recognizing/finalizing 状态校验 ASR 消息顺序, 乱序时返回 PROTOCOL_ERROR
+	StrictASRProtocol bool `yaml:"strict_asr_protocol"`
+	// AudioStart 合成时在首个音频帧前发送 audio_start 格式信息
+	AudioStart bool `yaml:"audio_start"`
+
+	// TLSCert/TLSKey 证书与私钥文件路径, 均设置时启用 wss://
+	TLSCert string `yaml:"tls_cert"`
+	TLSKey  string `yaml:"tls_key"`
+
+	// TLSCertPEM/TLSKeyPEM PEM 内容, 优先于文件路径, 便于容器部署
+	TLSCertPEM string `yaml:"tls_cert_pem"`
+	TLSKeyPEM  string `yaml:"tls_key_pem"`
+
+	// NLSMLFormat 识别结果的 NLSML 格式: simple (默认, 不带命名空间)、v1 (MRCPv1) 或 mrcpv2
+	NLSMLFormat string `yaml:"nlsml_format"`
+
+	// ConfidenceCalibration 识别置信度的校准曲线 (分段线性, 单调), 在按 confidence_threshold 过滤
+	// 与生成 NLSML 之前应用于每个候选; 为空表示不校准
+	ConfidenceCalibration []CalibrationPoint `yaml:"confidence_calibration"`
+
+	// LogFormat 日志格式: json (默认) 或 text
+	LogFormat string `yaml:"log_format"`
+
+	// TTSRateLimit/TTSRateBurst TTS 请求令牌桶的补充速率 (个/秒) 与容量, 速率为 0 表示不限流
+	// 容量为 0 时取 max(1, 速率)
+	TTSRateLimit float64 `yaml:"tts_rate_limit"`
+	TTSRateBurst int     `yaml:"tts_rate_burst"`
+
+	// TTSRatePerUser 已鉴权连接按用户共享令牌桶, 否则每个连接独立计算
+	TTSRatePerUser bool `yaml:"tts_rate_per_user"`
+
+	// DefaultLanguage ASR 未指定 language/languages 时的语种提示 (BCP 47), 空表示不提示
+	DefaultLanguage string `yaml:"default_language"`
+
+	// DefaultVoice 请求未指定音色 (或为 "default") 时使用的音色, 须在音色列表中
+	DefaultVoice string `yaml:"default_voice"`
+
+	// VoiceSampleRatePolicy 请求的采样率不在音色 sample_rates 中时的策略: resample (默认) 或 strict
+	VoiceSampleRatePolicy string `yaml:"voice_sample_rate_policy"`
+
+	// Profiles 命名的合成参数预设, 请求通过 profile 字段引用; 仅能在配置文件中设置
+	Profiles map[string]TTSProfile `yaml:"profiles"`
+
+	// TTSCacheSize 合成结果 LRU 缓存的条目数, 0 表示不缓存
+	TTSCacheSize int `yaml:"tts_cache_size"`
+
+	// SessionTTL 断线会话的保留时间, 期间携带相同 session_id 重连可恢复; 0 表示不保留
+	SessionTTL time.Duration `yaml:"session_ttl"`
+
+	// EnableCompression/CompressionLevel 客户端请求时协商 permessage-deflate 压缩文本消息, 会增加 CPU 开销
+	// 压缩级别为 -2 (仅 Huffman) ~ 9, 默认 1 (最快)
+	EnableCompression bool `yaml:"enable_compression"`
+	CompressionLevel  int  `yaml:"compression_level"`
+
+	// ReadBufferSize/WriteBufferSize 连接的读写缓冲区大小 (字节), 0 表示 gorilla 默认的 4096;
+	// 大于单帧音频时每帧只需一次系统调用。WriteBufferPool 开启时写缓冲在连接间复用
+	ReadBufferSize  int  `yaml:"read_buffer_size"`
+	WriteBufferSize int  `yaml:"write_buffer_size"`
+	WriteBufferPool bool `yaml:"write_buffer_pool"`
+
+	// Subprotocols 支持的 WebSocket 子协议, 按优先顺序与客户端的 Sec-WebSocket-Protocol 协商;
+	// 客户端提供了子协议但均不在列表中时拒绝升级。空表示不协商
+	Subprotocols []string `yaml:"subprotocols"`
+
+	// StreamQueueSize 流式合成每个连接排队的文本段数上限, 队列满时返回 QUEUE_FULL
+	StreamQueueSize int `yaml:"stream_queue_size"`
+
+	// SendQueueSize 每个连接发送队列的容量 (消息数), 合成速度超过客户端读取速度时在此缓冲
+	SendQueueSize int `yaml:"send_queue_size"`
+
+	// SlowConsumerTimeout 发送队列持续满或单次写入超过该时间时以 SLOW_CONSUMER 关闭连接, 0 表示不限制
+	SlowConsumerTimeout time.Duration `yaml:"slow_consumer_timeout"`
+
+	// AdminToken /stats 等调试接口的令牌, 空表示与主接口使用相同的鉴权 (主接口也不鉴权时只允许本机访问)
+	AdminToken string `yaml:"admin_token"`
+
+	// FetchAllowedHosts recognize_url 允许拉取的主机, 匹配规则同 allowed_origins; 空表示禁止拉取
+	FetchAllowedHosts []string `yaml:"fetch_allowed_hosts"`
+
+	// 每个用户 (鉴权身份, 未启用鉴权时所有客户端共用) 每个自然月 (UTC) 的用量额度, 超出后返回 QUOTA_EXCEEDED;
+	// QuotaMonthlyChars 为接受合成的字符数, QuotaMonthlyASRBytes 为接受识别的音频字节数; 0 表示不限制
+	QuotaMonthlyChars    int64 `yaml:"quota_monthly_chars"`
+	QuotaMonthlyASRBytes int64 `yaml:"quota_monthly_asr_bytes"`
+
+	// DebugMode 调试模式, 开启后 TTS 请求才接受 jitter_ms / drop_frame_every_n 等测试用的扰动; 生产环境不应开启
+	DebugMode bool `yaml:"debug_mode"`
+
+	// NormalizeText 合成前按音色语种将数字、金额、日期与常见缩写展开为朗读形式, 请求可用 normalize_text 覆盖
+	NormalizeText bool `yaml:"normalize_text"`
+
+	// BreakerThreshold 引擎连续故障多少次后熔断, 熔断期间请求直接返回 BACKEND_UNAVAILABLE; 0 表示不熔断
+	// BreakerCooldown 熔断后等待多久放行一次探测请求
+	BreakerThreshold int           `yaml:"breaker_threshold"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`
+
+	// FadeMs 打断合成时末尾淡出 (及请求 fade_in 时首帧淡入) 的时长, 0 表示不做淡入淡出
+	FadeMs int `yaml:"fade_ms"`
+
+	// Limiter 对合成输出做软限幅, 幅度超过 LimiterThreshold × 满幅的峰值被平滑压缩, 而不是在满幅处削波
+	Limiter          bool    `yaml:"limiter"`
+	LimiterThreshold float64 `yaml:"limiter_threshold"`
+
+	// RecordAudio 将每个 ASR 连接收到的音频在连接结束时写为 WAV, 用于复现识别问题; 默认关闭
+	// 文件为 record_dir 下的 <session_id>-<开始时间>.wav, 按 record_max_files / record_max_age 清理 (0 表示不限制)
+	RecordAudio    bool          `yaml:"record_audio"`
+	RecordDir      string        `yaml:"record_dir"`
+	RecordMaxFiles int           `yaml:"record_max_files"`
+	RecordMaxAge   time.Duration `yaml:"record_max_age"`
+
+	// PrivacyMode 隐私模式, 开启时无论 record_audio 如何都不落盘音频
+	PrivacyMode bool `yaml:"privacy_mode"`
+
+	// PromptDir 拼接播放的录音目录, 录音 ID 对应其中的 <id>.wav; 空表示不支持录音片段
+	PromptDir string `yaml:"prompt_dir"`
+	// AuthTokens 允许的 Bearer 令牌列表, 非空时 /tts、/asr 等接口须携带其中之一; 空表示不鉴权
+	AuthTokens []string `yaml:"auth_tokens"`
+}
+
+// activeConfig 当前生效的配置, main 中从配置文件加载, POST /admin/reload 时整体替换
+var activeConfig atomic.Pointer[Config]
+
+func init() {
+	activeConfig.Store(DefaultConfig())
+}
+
+// currentConfig 返回当前生效的配置, 替换后不再修改, 可在函数内持有
+//
+// 连接在建立时取一次, 之后重新加载的配置只对新连接生效。
+func currentConfig() *Config {
+	return activeConfig.Load()
+}
+
+type configKey struct{}
+
+// withConfig 将连接的配置放入 ctx, 引擎与熔断器等按同一份配置处理该连接的请求
+func withConfig(ctx context.Context, c *Config) context.Context {
+	return context.WithValue(ctx, configKey{}, c)
+}
+
+// configFrom 取 ctx 中的配置, 没有时 (如直接调用引擎) 返回当前生效的配置
+func configFrom(ctx context.Context) *Config {
+	if c, ok := ctx.Value(configKey{}).(*Config); ok {
+		return c
+	}
+	return currentConfig()
+}
+
+// DefaultConfig 返回默认配置
+//
+// 默认不允许任何浏览器来源, 不携带 Origin 的客户端不受影响。
+func DefaultConfig() *Config {
+	return &Config{
+		Host:                  HOST,
+		Port:                  PORT,
+		DefaultSampleRate:     8000,
+		MaxMessageSize:        MAX_MESSAGE_SIZE,
+		MaxAudioBytes:         10 * 1024 * 1024,
+		MaxTextRunes:          5000,
+		ShutdownGrace:         10 * time.Second,
+		SynthesisTimeout:      2 * time.Minute,
+		TTSEngine:             TTSEngineSine,
+		ASREngine:             ASREngineDemo,
+		AudioStart:            true,
+		LogFormat:             LogFormatJSON,
+		NLSMLFormat:           NLSMLFormatSimple,
+		SessionTTL:            30 * time.Second,
+		DefaultVoice:          "xiaoyun",
+		DefaultLanguage:       "zh-CN",
+		CompressionLevel:      flate.BestSpeed,
+		SendQueueSize:         256,
+		StreamQueueSize:       STREAM_QUEUE_SIZE,
+		FadeMs:                FADE_MS,
+		LimiterThreshold:      LIMITER_THRESHOLD,
+		BreakerThreshold:      BREAKER_THRESHOLD,
+		BreakerCooldown:       BREAKER_COOLDOWN,
+		SlowConsumerTimeout:   10 * time.Second,
+		VoiceSampleRatePolicy: SampleRatePolicyResample,
+		RecordMaxFiles:        1000,
+		RecordMaxAge:          7 * 24 * time.Hour,
+	}
+}
+
+// LoadConfig 加载配置文件 (path 为空时跳过) 并应用环境变量
+func LoadConfig(path string) (*Config, error) {
+	cfg := DefaultConfig()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read config: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("parse config %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyEnv 使用 WS_ 前缀的环境变量覆盖配置
+func (c *Config) applyEnv() error {
+	if v := os.Getenv("WS_HOST"); v != "" {
+		c.Host = v
+	}
+	if v := os.Getenv("WS_PORT"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_PORT '%s'", v)
+		}
+		c.Port = port
+	}
+	if v := os.Getenv("WS_ALLOWED_ORIGINS"); v != "" {
+		c.AllowedOrigins = splitList(v)
+	}
+	if v := os.Getenv("WS_ALLOW_ALL_ORIGINS"); v != "" {
+		allow, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_ALLOW_ALL_ORIGINS '%s'", v)
+		}
+		c.AllowAllOrigins = allow
+	}
+	if v := os.Getenv("WS_DEFAULT_SAMPLE_RATE"); v != "" {
+		rate, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_DEFAULT_SAMPLE_RATE '%s'", v)
+		}
+		c.DefaultSampleRate = rate
+	}
+	if v := os.Getenv("WS_MAX_MESSAGE_SIZE"); v != "" {
+		size, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid WS_MAX_MESSAGE_SIZE '%s'", v)
+		}
+		c.MaxMessageSize = size
+	}
+	if v := os.Getenv("WS_MAX_AUDIO_BYTES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_MAX_AUDIO_BYTES '%s'", v)
+		}
+		c.MaxAudioBytes = n
+	}
+	if v := os.Getenv("WS_MAX_TEXT_RUNES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_MAX_TEXT_RUNES '%s'", v)
+		}
+		c.MaxTextRunes = n
+	}
+	if v := os.Getenv("WS_MAX_CONNECTIONS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_MAX_CONNECTIONS '%s'", v)
+		}
+		c.MaxConnections = n
+	}
+	if v := os.Getenv("WS_MAX_CONNECTIONS_PER_IP"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_MAX_CONNECTIONS_PER_IP '%s'", v)
+		}
+		c.MaxConnectionsPerIP = n
+	}
+	if v := os.Getenv("WS_SHUTDOWN_GRACE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_SHUTDOWN_GRACE '%s'", v)
+		}
+		c.ShutdownGrace = d
+	}
+	if v := os.Getenv("WS_SYNTHESIS_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_SYNTHESIS_TIMEOUT '%s'", v)
+		}
+		c.SynthesisTimeout = d
+	}
+	if v := os.Getenv("WS_TTS_ENGINE"); v != "" {
+		c.TTSEngine = v
+	}
+	if v := os.Getenv("WS_GRPC_TTS_TARGET"); v != "" {
+		c.GRPCTTSTarget = v
+	}
+	if v := os.Getenv("WS_ASR_ENGINE"); v != "" {
+		c.ASREngine = v
+	}
+	if v := os.Getenv("WS_AUDIO_START"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_AUDIO_START '%s'", v)
+		}
+		c.AudioStart = enabled
+	}
+	if v := os.Getenv("WS_STRICT_ASR_PROTOCOL"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_STRICT_ASR_PROTOCOL '%s'", v)
+		}
+		c.StrictASRProtocol = enabled
+	}
+	if v := os.Getenv("WS_TLS_CERT"); v != "" {
+		c.TLSCert = v
+	}
+	if v := os.Getenv("WS_TLS_KEY"); v != "" {
+		c.TLSKey = v
+	}
+	if v := os.Getenv("WS_TLS_CERT_PEM"); v != "" {
+		c.TLSCertPEM = v
+	}
+	if v := os.Getenv("WS_TLS_KEY_PEM"); v != "" {
+		c.TLSKeyPEM = v
+	}
+	if v := os.Getenv("WS_LOG_FORMAT"); v != "" {
+		c.LogFormat = v
+	}
+	if v := os.Getenv("WS_NLSML_FORMAT"); v != "" {
+		c.NLSMLFormat = v
+	}
+	if v := os.Getenv("WS_CONFIDENCE_CALIBRATION"); v != "" {
+		points, err := parseCalibration(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_CONFIDENCE_CALIBRATION: %v", err)
+		}
+		c.ConfidenceCalibration = points
+	}
+	if v := os.Getenv("WS_TTS_RATE_LIMIT"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid WS_TTS_RATE_LIMIT '%s'", v)
+		}
+		c.TTSRateLimit = rate
+	}
+	if v := os.Getenv("WS_TTS_RATE_BURST"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_TTS_RATE_BURST '%s'", v)
+		}
+		c.TTSRateBurst = n
+	}
+	if v := os.Getenv("WS_TTS_RATE_PER_USER"); v != "" {
+		perUser, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_TTS_RATE_PER_USER '%s'", v)
+		}
+		c.TTSRatePerUser = perUser
+	}
+	if v := os.Getenv("WS_DEFAULT_VOICE"); v != "" {
+		c.DefaultVoice = v
+	}
+	if v := os.Getenv("WS_VOICE_SAMPLE_RATE_POLICY"); v != "" {
+		c.VoiceSampleRatePolicy = v
+	}
+	if v := os.Getenv("WS_DEFAULT_LANGUAGE"); v != "" {
+		c.DefaultLanguage = v
+	}
+	if v := os.Getenv("WS_TTS_CACHE_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_TTS_CACHE_SIZE '%s'", v)
+		}
+		c.TTSCacheSize = n
+	}
+	if v := os.Getenv("WS_SESSION_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_SESSION_TTL '%s'", v)
+		}
+		c.SessionTTL = d
+	}
+	if v := os.Getenv("WS_ENABLE_COMPRESSION"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_ENABLE_COMPRESSION '%s'", v)
+		}
+		c.EnableCompression = enabled
+	}
+	if v := os.Getenv("WS_READ_BUFFER_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_READ_BUFFER_SIZE '%s'", v)
+		}
+		c.ReadBufferSize = n
+	}
+	if v := os.Getenv("WS_WRITE_BUFFER_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_WRITE_BUFFER_SIZE '%s'", v)
+		}
+		c.WriteBufferSize = n
+	}
+	if v := os.Getenv("WS_WRITE_BUFFER_POOL"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_WRITE_BUFFER_POOL '%s'", v)
+		}
+		c.WriteBufferPool = enabled
+	}
+	if v := os.Getenv("WS_SUBPROTOCOLS"); v != "" {
+		c.Subprotocols = splitList(v)
+	}
+	if v := os.Getenv("WS_COMPRESSION_LEVEL"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_COMPRESSION_LEVEL '%s'", v)
+		}
+		c.CompressionLevel = n
+	}
+	if v := os.Getenv("WS_SEND_QUEUE_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_SEND_QUEUE_SIZE '%s'", v)
+		}
+		c.SendQueueSize = n
+	}
+	if v := os.Getenv("WS_STREAM_QUEUE_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_STREAM_QUEUE_SIZE '%s'", v)
+		}
+		c.StreamQueueSize = n
+	}
+	if v := os.Getenv("WS_SLOW_CONSUMER_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_SLOW_CONSUMER_TIMEOUT '%s'", v)
+		}
+		c.SlowConsumerTimeout = d
+	}
+	if v := os.Getenv("WS_ADMIN_TOKEN"); v != "" {
+		c.AdminToken = v
+	}
+	if v := os.Getenv("WS_AUTH_TOKENS"); v != "" {
+		c.AuthTokens = splitList(v)
+	}
+	if v := os.Getenv("WS_FETCH_ALLOWED_HOSTS"); v != "" {
+		c.FetchAllowedHosts = splitList(v)
+	}
+	if v := os.Getenv("WS_PROMPT_DIR"); v != "" {
+		c.PromptDir = v
+	}
+	if v := os.Getenv("WS_QUOTA_MONTHLY_CHARS"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid WS_QUOTA_MONTHLY_CHARS '%s'", v)
+		}
+		c.QuotaMonthlyChars = n
+	}
+	if v := os.Getenv("WS_QUOTA_MONTHLY_ASR_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid WS_QUOTA_MONTHLY_ASR_BYTES '%s'", v)
+		}
+		c.QuotaMonthlyASRBytes = n
+	}
+	if v := os.Getenv("WS_DEBUG_MODE"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_DEBUG_MODE '%s'", v)
+		}
+		c.DebugMode = enabled
+	}
+	if v := os.Getenv("WS_NORMALIZE_TEXT"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_NORMALIZE_TEXT '%s'", v)
+		}
+		c.NormalizeText = enabled
+	}
+	if v := os.Getenv("WS_BREAKER_THRESHOLD"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_BREAKER_THRESHOLD '%s'", v)
+		}
+		c.BreakerThreshold = n
+	}
+	if v := os.Getenv("WS_BREAKER_COOLDOWN"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_BREAKER_COOLDOWN '%s'", v)
+		}
+		c.BreakerCooldown = d
+	}
+	if v := os.Getenv("WS_FADE_MS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_FADE_MS '%s'", v)
+		}
+		c.FadeMs = n
+	}
+	if v := os.Getenv("WS_LIMITER"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_LIMITER '%s'", v)
+		}
+		c.Limiter = enabled
+	}
+	if v := os.Getenv("WS_LIMITER_THRESHOLD"); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid WS_LIMITER_THRESHOLD '%s'", v)
+		}
+		c.LimiterThreshold = t
+	}
+	if v := os.Getenv("WS_RECORD_AUDIO"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_RECORD_AUDIO '%s'", v)
+		}
+		c.RecordAudio = enabled
+	}
+	if v := os.Getenv("WS_RECORD_DIR"); v != "" {
+		c.RecordDir = v
+	}
+	if v := os.Getenv("WS_RECORD_MAX_FILES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_RECORD_MAX_FILES '%s'", v)
+		}
+		c.RecordMaxFiles = n
+	}
+	if v := os.Getenv("WS_RECORD_MAX_AGE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_RECORD_MAX_AGE '%s'", v)
+		}
+		c.RecordMaxAge = d
+	}
+	if v := os.Getenv("WS_PRIVACY_MODE"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid WS_PRIVACY_MODE '%s'", v)
+		}
+		c.PrivacyMode = enabled
+	}
+	if c.LogFormat != LogFormatJSON && c.LogFormat != LogFormatText {
+		return fmt.Errorf("invalid log_format '%s'", c.LogFormat)
+	}
+	if !isSupportedNLSMLFormat(c.NLSMLFormat) {
+		return fmt.Errorf("invalid nlsml_format '%s'", c.NLSMLFormat)
+	}
+	if err := checkCalibration(c.ConfidenceCalibration); err != nil {
+		return err
+	}
+	if err := checkRoutes(c); err != nil {
+		return err
+	}
+	if !isSupportedSampleRatePolicy(c.VoiceSampleRatePolicy) {
+		return fmt.Errorf("invalid voice_sample_rate_policy '%s'", c.VoiceSampleRatePolicy)
+	}
+	if c.CompressionLevel < flate.HuffmanOnly || c.CompressionLevel > flate.BestCompression {
+		return fmt.Errorf("invalid compression_level %d", c.CompressionLevel)
+	}
+	if c.StreamQueueSize < 1 {
+		return fmt.Errorf("invalid stream_queue_size %d", c.StreamQueueSize)
+	}
+	if c.RecordAudio && c.RecordDir == "" {
+		return fmt.Errorf("record_dir is required when record_audio is enabled")
+	}
+	if c.QuotaMonthlyChars < 0 || c.QuotaMonthlyASRBytes < 0 {
+		return fmt.Errorf("quota_monthly_chars and quota_monthly_asr_bytes must be >= 0")
+	}
+	if c.RecordMaxFiles < 0 || c.RecordMaxAge < 0 {
+		return fmt.Errorf("record_max_files and record_max_age must be >= 0")
+	}
+	if c.MaxMessageSize < 0 {
+		return fmt.Errorf("max_message_size must be >= 0")
+	}
+	if c.BreakerThreshold < 0 {
+		return fmt.Errorf("breaker_threshold must be >= 0")
+	}
+	if c.BreakerThreshold > 0 && c.BreakerCooldown <= 0 {
+		return fmt.Errorf("breaker_cooldown must be > 0 when breaker_threshold is set")
+	}
+	// 同时是 TTS 请求与 ASR 输入的默认采样率, 须两者都接受, 否则 render 的帧长与时长计算无意义
+	if !isSupportedASRSampleRate(c.DefaultSampleRate) {
+		return fmt.Errorf("invalid default_sample_rate %d (supported: %v)", c.DefaultSampleRate, asrSampleRates)
+	}
+	if c.FadeMs < 0 || c.FadeMs > MAX_FADE_MS {
+		return fmt.Errorf("invalid fade_ms %d (0~%d)", c.FadeMs, MAX_FADE_MS)
+	}
+	if c.LimiterThreshold <= 0 || c.LimiterThreshold >= 1 {
+		return fmt.Errorf("invalid limiter_threshold %g (must be between 0 and 1)", c.LimiterThreshold)
+	}
+	if c.ReadBufferSize < 0 || c.WriteBufferSize < 0 {
+		return fmt.Errorf("invalid buffer size (read %d, write %d)", c.ReadBufferSize, c.WriteBufferSize)
+	}
+	return nil
+}
+
+// TLSConfig 按配置加载证书, 未配置 TLS 时返回 nil
+func (c *Config) TLSConfig() (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+
+	switch {
+	case c.TLSCertPEM != "" && c.TLSKeyPEM != "":
+		cert, err = tls.X509KeyPair([]byte(c.TLSCertPEM), []byte(c.TLSKeyPEM))
+	case c.TLSCert != "" && c.TLSKey != "":
+		cert, err = tls.LoadX509KeyPair(c.TLSCert, c.TLSKey)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// Addr 监听地址
+func (c *Config) Addr() string {
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
+}
+
+// splitList 解析逗号分隔的列表
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// logConfig 打印生效的配置
+func logConfig(c *Config) {
+	slog.Info("配置", "addr", c.Addr(), "allowed_origins", c.AllowedOrigins,
+		"allow_all", c.AllowAllOrigins, "default_sample_rate", c.DefaultSampleRate,
+		"max_message_size", c.MaxMessageSize, "max_audio_bytes", c.MaxAudioBytes,
+		"max_text_runes", c.MaxTextRunes, "max_connections", c.MaxConnections,
+		"max_connections_per_ip", c.MaxConnectionsPerIP, "shutdown_grace", c.ShutdownGrace,
+		"synthesis_timeout", c.SynthesisTimeout, "tts_engine", c.TTSEngine, "grpc_tts_target", c.GRPCTTSTarget,
+		"asr_engine", c.ASREngine, "tts_routes", routeNames(c.TTSRoutes), "asr_routes", routeNames(c.ASRRoutes), "default_language", c.DefaultLanguage, "nlsml_format", c.NLSMLFormat,
+		"confidence_calibration", c.ConfidenceCalibration,
+		"strict_asr_protocol", c.StrictASRProtocol,
+		"audio_start", c.AudioStart,
+		"tts_rate_limit", c.TTSRateLimit, "tts_rate_burst", c.TTSRateBurst, "tts_rate_per_user", c.TTSRatePerUser,
+		"default_voice", c.DefaultVoice, "voice_sample_rate_policy", c.VoiceSampleRatePolicy, "profiles", profileNames(c.Profiles), "tts_cache_size", c.TTSCacheSize, "session_ttl", c.SessionTTL,
+		"enable_compression", c.EnableCompression, "compression_level", c.CompressionLevel,
+		"subprotocols", c.Subprotocols, "read_buffer_size", c.ReadBufferSize,
+		"write_buffer_size", c.WriteBufferSize, "write_buffer_pool", c.WriteBufferPool,
+		"send_queue_size", c.SendQueueSize, "stream_queue_size", c.StreamQueueSize, "slow_consumer_timeout", c.SlowConsumerTimeout,
+		"log_format", c.LogFormat, "auth_tokens", len(c.AuthTokens),
+		"fetch_allowed_hosts", c.FetchAllowedHosts, "prompt_dir", c.PromptDir, "normalize_text", c.NormalizeText, "fade_ms", c.FadeMs, "limiter", c.Limiter, "limiter_threshold", c.LimiterThreshold, "breaker_threshold", c.BreakerThreshold, "breaker_cooldown", c.BreakerCooldown, "debug_mode", c.DebugMode,
+		"quota_monthly_chars", c.QuotaMonthlyChars, "quota_monthly_asr_bytes", c.QuotaMonthlyASRBytes,
+		"record_audio", c.RecordAudio, "record_dir", c.RecordDir, "record_max_files", c.RecordMaxFiles,
+		"record_max_age", c.RecordMaxAge, "privacy_mode", c.PrivacyMode, "admin_token", c.AdminToken != "")
+	if c.AllowAllOrigins {
+		slog.Warn("allow_all 已开启, 允许任意来源连接")
+	}
+	if c.DebugMode {
+		slog.Warn("debug_mode 已开启, TTS 请求可注入发送抖动与丢帧, 生产环境不应开启")
+	}
+	if c.RecordAudio && c.PrivacyMode {
+		slog.Warn("privacy_mode 已开启, 忽略 record_audio")
+	} else if c.RecordAudio {
+		slog.Warn("record_audio 已开启, ASR 音频将写入磁盘", "record_dir", c.RecordDir)
+	}
+}
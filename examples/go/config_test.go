@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyEnvRejectsInvalidDefaultSampleRate(t *testing.T) {
+	for _, rate := range []string{"0", "-8000", "12345", "96000"} {
+		t.Setenv("WS_DEFAULT_SAMPLE_RATE", rate)
+		err := DefaultConfig().applyEnv()
+		if err == nil || !strings.Contains(err.Error(), "default_sample_rate") {
+			t.Errorf("WS_DEFAULT_SAMPLE_RATE=%s: err = %v, want default_sample_rate error", rate, err)
+		}
+	}
+	for _, rate := range []string{"8000", "16000"} {
+		t.Setenv("WS_DEFAULT_SAMPLE_RATE", rate)
+		if err := DefaultConfig().applyEnv(); err != nil {
+			t.Errorf("WS_DEFAULT_SAMPLE_RATE=%s: err = %v", rate, err)
+		}
+	}
+}
+
+func TestLoadConfigRejectsInvalidDefaultSampleRate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("default_sample_rate: 0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "default_sample_rate") {
+		t.Fatalf("LoadConfig(default_sample_rate: 0) err = %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// VoiceConverter 支持变声的 Synthesizer: 将源音频转换为 req.Voice 的音色
+//
+// source 为 sourceRate 的 16-bit 小端单声道 PCM; 转换结果与合成一样按 req 的编码、采样率、
+// 声道与帧长通过 sendFrame 逐帧发送, ctx 被取消时应尽快返回 ctx.Err()。
+type VoiceConverter interface {
+	Synthesizer
+	ConvertVoice(ctx context.Context, req TTSRequest, source []byte, sourceRate int,
+		sendFrame func([]byte), sendEvent func(interface{})) error
+}
+
+// voiceConverterOf 返回 s (或其缓存包装内的引擎) 实现的 VoiceConverter, 变声结果不经过缓存
+func voiceConverterOf(s Synthesizer) (VoiceConverter, bool) {
+	if c, ok := s.(*cachingSynthesizer); ok {
+		s = c.inner
+	}
+	vc, ok := s.(VoiceConverter)
+	return vc, ok
+}
+
+// runVoiceConverter 使用 s 将 req.SourceAudio 转换为 req.Voice 的音色, 与合成共用熔断器
+func runVoiceConverter(ctx context.Context, s Synthesizer, req TTSRequest,
+	sendFrame func([]byte), sendEvent func(interface{})) error {
+	vc, ok := voiceConverterOf(s)
+	if !ok {
+		return errSynthesisFailed
+	}
+	cfg := configFrom(ctx)
+	b := breakerFor(vc)
+	if err := b.allow(cfg); err != nil {
+		return err
+	}
+	err := vc.ConvertVoice(ctx, req, req.SourceAudio, req.InputSampleRate, limitSendFrame(req, cfg, sendFrame), sendEvent)
+	b.record(err, isSynthesisFailure(err), cfg)
+	return err
+}
+
+// checkConvertRequest 校验 convert 请求: 源音频随后以二进制消息发送, 不接受文本与流式、续传
+func checkConvertRequest(req TTSRequest) *ErrorResponse {
+	if req.Text != "" || len(req.Segments) > 0 {
+		return &ErrorResponse{Status: "error", Code: "INVALID_REQUEST",
+			Message: "convert does not accept text or segments"}
+	}
+	if req.Stream || req.Resume {
+		return &ErrorResponse{Status: "error", Code: "INVALID_REQUEST",
+			Message: "convert does not support stream or resume"}
+	}
+	if !isSupportedASRSampleRate(req.InputSampleRate) {
+		return &ErrorResponse{Status: "error", Code: "SAMPLE_RATE_UNSUPPORTED",
+			Message: fmt.Sprintf("Unsupported input_sample_rate %d", req.InputSampleRate)}
+	}
+	return nil
+}
+
+// ConvertVoice 演示: 不做变声, 源音频重采样后按请求的格式与节奏原样发送
+func (e *TTSEngine) ConvertVoice(ctx context.Context, req TTSRequest, source []byte, sourceRate int,
+	sendFrame func([]byte), sendEvent func(interface{})) error {
+	loggerFrom(ctx).Info("TTS 变声", "voice", req.Voice, "bytes", len(source),
+		"input_sample_rate", sourceRate, "sample_rate", req.SampleRate)
+
+	applyTTSDefaults(&req, configFrom(ctx))
+	samples := resample(pcmSamples(source), sourceRate, e.nativeRate(req))
+	return e.render(ctx, []ssmlSegment{{Audio: samples}}, req, sendFrame, sendEvent)
+}
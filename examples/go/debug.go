@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// MAX_JITTER_MS jitter_ms 的上限
+const MAX_JITTER_MS = 1000
+
+// hasDebugTiming 判断请求是否设置了调试用的发送扰动
+func (req TTSRequest) hasDebugTiming() bool {
+	return req.JitterMs != 0 || req.DropFrameEveryN != 0
+}
+
+// checkDebugTiming 校验 jitter_ms / drop_frame_every_n: 只在 debug_mode 下接受, 通过时返回 nil
+func checkDebugTiming(req TTSRequest, c *Config) *ErrorResponse {
+	if !req.hasDebugTiming() {
+		return nil
+	}
+	if !c.DebugMode {
+		return &ErrorResponse{
+			Status:  "error",
+			Code:    "INVALID_REQUEST",
+			Message: "jitter_ms and drop_frame_every_n require debug_mode",
+		}
+	}
+	if req.JitterMs < 0 || req.JitterMs > MAX_JITTER_MS {
+		return &ErrorResponse{
+			Status:  "error",
+			Code:    "PARAMETER_OUT_OF_RANGE",
+			Message: fmt.Sprintf("jitter_ms %d out of range [0, %d]", req.JitterMs, MAX_JITTER_MS),
+		}
+	}
+	if req.DropFrameEveryN < 0 || req.DropFrameEveryN == 1 {
+		return &ErrorResponse{
+			Status:  "error",
+			Code:    "PARAMETER_OUT_OF_RANGE",
+			Message: fmt.Sprintf("drop_frame_every_n %d must be 0 or >= 2", req.DropFrameEveryN),
+		}
+	}
+	return nil
+}
+
+// jitteredInterval 返回在 frame ± jitter 内均匀分布的帧间隔, 不小于 0
+func jitteredInterval(frame, jitter time.Duration) time.Duration {
+	d := frame - jitter + time.Duration(rand.Int63n(int64(2*jitter)+1))
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// dropFrame 判断 drop_frame_every_n 下是否丢弃第 frame 帧 (从 0 起), 即每 n 帧中的最后一帧
+func dropFrame(req TTSRequest, frame int) bool {
+	return req.DropFrameEveryN > 0 && (frame+1)%req.DropFrameEveryN == 0
+}
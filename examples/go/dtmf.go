@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DTMF_DIGITS 合法的 DTMF 按键
+const DTMF_DIGITS = "0123456789*#ABCD"
+
+// isDTMFDigit 判断是否为单个合法的 DTMF 按键
+func isDTMFDigit(s string) bool {
+	return len(s) == 1 && strings.Contains(DTMF_DIGITS, s)
+}
+
+// dtmfCollector 收集一次识别中的 DTMF 按键
+//
+// 收到结束符或按键间隔超时即完成; 完成后 (或被 take 取走后) 不再接收按键,
+// 直到下一次 start 创建新的收集器。
+type dtmfCollector struct {
+	termChar  string
+	timeout   time.Duration
+	onTimeout func(digits string)
+
+	mu     sync.Mutex
+	digits []byte
+	timer  *time.Timer
+	done   bool
+}
+
+// newDTMFCollector termChar 为空表示没有结束符, timeout 为 0 表示不限制按键间隔
+func newDTMFCollector(termChar string, timeout time.Duration, onTimeout func(digits string)) *dtmfCollector {
+	return &dtmfCollector{termChar: termChar, timeout: timeout, onTimeout: onTimeout}
+}
+
+// add 追加一个按键, 收到结束符时完成并返回已收集的按键 (不含结束符)
+func (c *dtmfCollector) add(digit string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done {
+		return "", false
+	}
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	if digit == c.termChar {
+		c.done = true
+		return string(c.digits), true
+	}
+	c.digits = append(c.digits, digit[0])
+	if c.timeout > 0 {
+		c.timer = time.AfterFunc(c.timeout, func() {
+			if digits, ok := c.take(); ok {
+				c.onTimeout(digits)
+			}
+		})
+	}
+	return "", false
+}
+
+// take 结束收集并取走已收集的按键, 没有按键或已完成时返回 false
+func (c *dtmfCollector) take() (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done || len(c.digits) == 0 {
+		return "", false
+	}
+	c.done = true
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	return string(c.digits), true
+}
+
+// end 处理 end 消息: 结束收集, 返回待发送的按键与本次识别是否按 DTMF 结束
+//
+// 已因结束符或超时返回过结果时返回 ("", true); 没有收到按键时返回 ("", false), 按语音识别。
+func (c *dtmfCollector) end() (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	if c.done {
+		return "", true
+	}
+	c.done = true
+	if len(c.digits) == 0 {
+		return "", false
+	}
+	return string(c.digits), true
+}
+
+// finished 是否已完成 (结束符、超时或已被取走)
+func (c *dtmfCollector) finished() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.done
+}
+
+// stop 停止按键间隔计时
+func (c *dtmfCollector) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+}
+
+// dtmfNLSML 生成 mode="dtmf" 的 NLSML
+func dtmfNLSML(digits, grammarURI string) string {
+	return fmt.Sprintf(`<?xml version="1.0"?>
+<result>
+  <interpretation grammar="%s" confidence="1.00">
+    <instance>%s</instance>
+    <input mode="dtmf">%s</input>
+  </interpretation>
+</result>`, xmlEscape(grammarURI), digits, digits)
+}
+
+// pcmSamples 将 16-bit Little-Endian PCM 转换为采样
+func pcmSamples(pcm []byte) []int16 {
+	samples := make([]int16, len(pcm)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(pcm[2*i:]))
+	}
+	return samples
+}
+
+// DTMF 行/列频率 (Hz) 与按键布局
+var (
+	dtmfRowFreqs = [4]float64{697, 770, 852, 941}
+	dtmfColFreqs = [4]float64{1209, 1336, 1477, 1633}
+	dtmfKeys     = [4]string{"123A", "456B", "789C", "*0#D"}
+)
+
+const (
+	// dtmfMinRMS 低于该能量的音频不做检测
+	dtmfMinRMS = 200
+	// dtmfMinToneRatio 行/列单音能量占总能量的最小比例, 纯双音时约为 0.25
+	dtmfMinToneRatio = 0.1
+)
+
+// goertzel 计算 samples 在 freq 处的能量
+func goertzel(samples []int16, rate int, freq float64) float64 {
+	coeff := 2 * math.Cos(2*math.Pi*freq/float64(rate))
+	var s1, s2 float64
+	for _, x := range samples {
+		s := float64(x) + coeff*s1 - s2
+		s2, s1 = s1, s
+	}
+	return s1*s1 + s2*s2 - coeff*s1*s2
+}
+
+// detectDTMF 以 Goertzel 算法检测一帧音频中的 DTMF 按键, 未检测到时返回 ""
+//
+// 帧长建议不少于 20ms, 过短时相邻频率无法区分。
+func detectDTMF(samples []int16, rate int) string {
+	if len(samples) == 0 {
+		return ""
+	}
+	var energy float64
+	for _, x := range samples {
+		energy += float64(x) * float64(x)
+	}
+	if math.Sqrt(energy/float64(len(samples))) < dtmfMinRMS {
+		return ""
+	}
+
+	strongest := func(freqs [4]float64) (int, float64) {
+		best, bestPower := 0, 0.0
+		for i, f := range freqs {
+			if p := goertzel(samples, rate, f); p > bestPower {
+				best, bestPower = i, p
+			}
+		}
+		return best, bestPower
+	}
+	row, rowPower := strongest(dtmfRowFreqs)
+	col, colPower := strongest(dtmfColFreqs)
+
+	// 单音的 Goertzel 能量约为 总能量 * N / 2, 按比例排除语音等非双音信号
+	norm := energy * float64(len(samples))
+	if rowPower/norm < dtmfMinToneRatio || colPower/norm < dtmfMinToneRatio {
+		return ""
+	}
+	return string(dtmfKeys[row][col])
+}
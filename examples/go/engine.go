@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Synthesizer TTS 引擎接口
+//
+// Synthesize 在合成结束后返回; sendFrame 依次接收编码后的音频帧,
+// 合成成功后调用 onComplete, 失败时不调用。frame 仅在 sendFrame 调用期间有效,
+// 实现可复用其内存, 调用方需要保留时应复制。
+type Synthesizer interface {
+	Synthesize(req TTSRequest, sendFrame func([]byte), onComplete func())
+}
+
+// ContextSynthesizer 支持取消与事件的 Synthesizer
+//
+// 打断、合成超时和词级时间标记依赖该接口, 只实现 Synthesizer 的引擎
+// 在被取消后丢弃剩余音频帧, 但仍要等合成调用返回。
+type ContextSynthesizer interface {
+	Synthesizer
+	SynthesizeContext(ctx context.Context, req TTSRequest,
+		sendFrame func([]byte), sendEvent func(interface{})) error
+}
+
+// errSynthesisFailed 引擎返回时未调用 onComplete
+var errSynthesisFailed = errors.New("synthesis failed")
+
+// errBackendUnavailable 外部 TTS 后端不可用或中途断开
+var errBackendUnavailable = errors.New("backend unavailable")
+
+// errSegmentsUnsupported 引擎不支持拼接播放 (segments)
+var errSegmentsUnsupported = errors.New("segments not supported")
+
+// TTS 引擎名称
+const (
+	TTSEngineSine = "sine"
+	TTSEngineGRPC = "grpc"
+)
+
+// newSynthesizer 按配置选择 TTS 引擎实现
+func newSynthesizer(c *Config) (Synthesizer, error) {
+	switch c.TTSEngine {
+	case "", TTSEngineSine:
+		return &TTSEngine{NativeSampleRate: TTS_NATIVE_SAMPLE_RATE}, nil
+	case TTSEngineGRPC:
+		return NewGRPCTTSEngine(c.GRPCTTSTarget)
+	}
+	return nil, fmt.Errorf("unknown tts_engine '%s'", c.TTSEngine)
+}
+
+// SYNTHESIS_TIMEOUT_FACTOR 实时发送时单次合成的超时至少为预计音频时长的倍数
+const SYNTHESIS_TIMEOUT_FACTOR = 2
+
+// synthesisTimeoutError 单次合成超过期限, 视为 context.DeadlineExceeded
+type synthesisTimeoutError struct {
+	timeout time.Duration
+}
+
+func (e *synthesisTimeoutError) Error() string {
+	return fmt.Sprintf("synthesis exceeded %s", e.timeout)
+}
+
+func (e *synthesisTimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// withSynthesisTimeout 按 synthesisTimeout 为 s 的单次合成设置超时, 超时后 context.Cause 为 *synthesisTimeoutError
+func withSynthesisTimeout(ctx context.Context, s Synthesizer, req TTSRequest) (context.Context, context.CancelFunc) {
+	if timeout := synthesisTimeout(s, req, configFrom(ctx)); timeout > 0 {
+		return context.WithTimeoutCause(ctx, timeout, &synthesisTimeoutError{timeout: timeout})
+	}
+	return context.WithCancel(ctx)
+}
+
+// synthesisTimeout 单次合成的期限, 0 表示不限制
+//
+// 实时发送时帧按音频时长逐帧发出, 合成至少要花预计的音频时长, 因此期限取 synthesis_timeout
+// 与预计音频时长的 SYNTHESIS_TIMEOUT_FACTOR 倍中的较大者, 长文本不会因发送节奏本身超时。
+func synthesisTimeout(s Synthesizer, req TTSRequest, c *Config) time.Duration {
+	if c.SynthesisTimeout <= 0 {
+		return 0
+	}
+	timeout := c.SynthesisTimeout
+	if req.Realtime == nil || *req.Realtime {
+		if d := SYNTHESIS_TIMEOUT_FACTOR * estimatedAudioDuration(s, req, c); d > timeout {
+			timeout = d
+		}
+	}
+	return timeout
+}
+
+// estimatedAudioDuration 按合成计划与 durationModelOf(s) 的时长模型 (segmentSamples) 估算请求的音频时长
+//
+// 与合成相同地解析 SSML: 停顿与首尾静音计入时长, 标记不计为字符; 拼接播放的录音与变声的源音频按其实际时长计入。
+func estimatedAudioDuration(s Synthesizer, req TTSRequest, c *Config) time.Duration {
+	model := durationModelOf(s)
+	applyTTSDefaults(&req, c)
+	var segments []ssmlSegment
+	if req.Action == "convert" && req.InputSampleRate > 0 {
+		// 变声的输出与源音频 (pcm16) 等长
+		segments = []ssmlSegment{{BreakMs: len(req.SourceAudio) / 2 * 1000 / req.InputSampleRate}}
+	} else if len(req.Segments) > 0 {
+		for _, seg := range req.Segments {
+			if seg.Prompt != "" {
+				if samples, rate, err := loadPrompt(c.PromptDir, seg.Prompt); err == nil {
+					segments = append(segments, ssmlSegment{BreakMs: len(samples) * 1000 / rate})
+				}
+				continue
+			}
+			part := req
+			part.Text = seg.Text
+			segments = append(segments, textPlan(part)...)
+		}
+	} else {
+		segments = textPlan(req)
+	}
+	segments = padSilence(segments, req)
+	samples := 0
+	for _, seg := range segments {
+		samples += model.segmentSamples(seg, req.SampleRate)
+	}
+	return time.Duration(samples) * time.Second / time.Duration(req.SampleRate)
+}
+
+// textPlan 与合成相同地将 req.Text 解析为片段, SSML 解析失败时按纯文本
+func textPlan(req TTSRequest) []ssmlSegment {
+	if isSSML(req.Text) {
+		if parsed, err := parseSSML(req.Text, req.Speed, req.Pitch, req.Volume); err == nil {
+			return parsed
+		}
+	}
+	return plainSegments(req)
+}
+
+// durationModelOf 返回估算时长所用的演示引擎: s 为 (缓存包装的) *TTSEngine 时按其 CharDurationMs, 其他引擎按默认时长模型
+func durationModelOf(s Synthesizer) *TTSEngine {
+	if c, ok := s.(*cachingSynthesizer); ok {
+		s = c.inner
+	}
+	if e, ok := s.(*TTSEngine); ok {
+		return e
+	}
+	return &TTSEngine{}
+}
+
+// timeoutCause 将 ctx 超时产生的 context.DeadlineExceeded 替换为 withSynthesisTimeout 设置的原因
+func timeoutCause(ctx context.Context, err error) error {
+	var timeout *synthesisTimeoutError
+	if errors.Is(err, context.DeadlineExceeded) && errors.As(context.Cause(ctx), &timeout) {
+		return timeout
+	}
+	return err
+}
+
+// synthesisError 将合成错误映射为错误响应, 成功或被打断 (context.Canceled) 时返回 nil
+func synthesisError(err error, c *Config) *ErrorResponse {
+	var code, message string
+	var open *circuitOpenError
+	var timeout *synthesisTimeoutError
+	switch {
+	case err == nil, errors.Is(err, context.Canceled):
+		return nil
+	case errors.As(err, &timeout):
+		code, message = "SYNTHESIS_TIMEOUT", fmt.Sprintf("Synthesis exceeded %s", timeout.timeout)
+	case errors.Is(err, context.DeadlineExceeded):
+		// 仅单次合成的超时返回 DeadlineExceeded
+		code, message = "SYNTHESIS_TIMEOUT", fmt.Sprintf("Synthesis exceeded %s", c.SynthesisTimeout)
+	case errors.As(err, &open):
+		return circuitOpenResponse(open)
+	case errors.Is(err, errBackendUnavailable):
+		code, message = "BACKEND_UNAVAILABLE", "TTS backend unavailable"
+	case errors.Is(err, errPromptNotFound):
+		// 校验之后录音被删除
+		code, message = "PROMPT_NOT_FOUND", "Prompt not found"
+	case errors.Is(err, errSegmentsUnsupported):
+		code, message = "INVALID_REQUEST", fmt.Sprintf("segments not supported by tts_engine '%s'", c.TTSEngine)
+	default:
+		code, message = "SYNTHESIS_FAILED", "Synthesis failed"
+	}
+	return &ErrorResponse{Status: "error", Code: code, Message: message}
+}
+
+// runSynthesizer 使用 s 合成并对发出的帧做软限幅, 统一返回 ctx.Err()、errSynthesisFailed 或 nil
+//
+// s 注册了熔断器时, 熔断打开期间直接返回 *circuitOpenError, 不调用引擎。
+// 只应在发往客户端的最外层调用, 包装其他引擎的实现 (如缓存) 改用 callWithBreaker, 避免重复限幅。
+func runSynthesizer(ctx context.Context, s Synthesizer, req TTSRequest,
+	sendFrame func([]byte), sendEvent func(interface{})) error {
+	return callWithBreaker(ctx, s, req, limitSendFrame(req, configFrom(ctx), sendFrame), sendEvent)
+}
+
+// callWithBreaker 经 s 的熔断器 (如有) 调用 callSynthesizer, 帧原样交给 sendFrame
+func callWithBreaker(ctx context.Context, s Synthesizer, req TTSRequest,
+	sendFrame func([]byte), sendEvent func(interface{})) error {
+	cfg := configFrom(ctx)
+	b := breakerFor(s)
+	if err := b.allow(cfg); err != nil {
+		return err
+	}
+	err := callSynthesizer(ctx, s, req, sendFrame, sendEvent)
+	b.record(err, isSynthesisFailure(err), cfg)
+	return err
+}
+
+// callSynthesizer 调用引擎合成, 只实现 Synthesizer 的引擎被取消后丢弃剩余帧
+func callSynthesizer(ctx context.Context, s Synthesizer, req TTSRequest,
+	sendFrame func([]byte), sendEvent func(interface{})) error {
+	if cs, ok := s.(ContextSynthesizer); ok {
+		return cs.SynthesizeContext(ctx, req, sendFrame, sendEvent)
+	}
+
+	completed := false
+	s.Synthesize(req,
+		func(frame []byte) {
+			if ctx.Err() == nil {
+				sendFrame(frame)
+			}
+		},
+		func() { completed = true },
+	)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !completed {
+		return errSynthesisFailed
+	}
+	return nil
+}
+
+// Warmer 支持预热的引擎 (Synthesizer 或 Recognizer)
+//
+// warmup action 调用, 实现在此加载模型或建立连接, 使客户端在首个请求前承担冷启动延迟。
+// 未实现的引擎视为无需预热。
+type Warmer interface {
+	Warmup() error
+}
+
+// warmupEngine 预热引擎, 未实现 Warmer 时直接返回 nil
+func warmupEngine(engine interface{}) error {
+	if w, ok := engine.(Warmer); ok {
+		return w.Warmup()
+	}
+	return nil
+}
+
+// Recognizer ASR 引擎接口
+//
+// audio 为 16-bit 小端 PCM, 返回 NLSML 格式的识别结果。
+type Recognizer interface {
+	Recognize(audio []byte, sampleRate int) (string, error)
+}
+
+// NBestRecognizer 支持返回多个候选的 Recognizer
+type NBestRecognizer interface {
+	Recognizer
+	RecognizeNBest(audio []byte, sampleRate int, alternatives int) (string, error)
+}
+
+// GrammarRecognizer 支持语法约束的 Recognizer
+type GrammarRecognizer interface {
+	Recognizer
+	RecognizeWithGrammar(audio []byte, sampleRate int, grammar *Grammar) (string, error)
+}
+
+// MultiGrammarRecognizer 支持同时激活多个语法的 GrammarRecognizer
+//
+// grammars 为激活的语法 (至少一个), 结果中 <interpretation> 的 grammar 属性为命中语法的 URI。
+type MultiGrammarRecognizer interface {
+	GrammarRecognizer
+	RecognizeWithGrammars(audio []byte, sampleRate int, grammars []*Grammar) (string, error)
+}
+
+// PartialRecognizer 支持中间结果的 Recognizer, 返回当前识别文本
+type PartialRecognizer interface {
+	Recognizer
+	RecognizePartial(audio []byte, sampleRate int) (string, error)
+}
+
+// ContextPartialRecognizer 可中止的 PartialRecognizer, 客户端发送 cancel 时 ctx 被取消, 应尽快返回
+type ContextPartialRecognizer interface {
+	PartialRecognizer
+	RecognizePartialContext(ctx context.Context, audio []byte, sampleRate int) (string, error)
+}
+
+// recognizePartial 中间识别, 引擎实现 ContextPartialRecognizer 时传入 ctx
+func recognizePartial(ctx context.Context, p PartialRecognizer, audio []byte, sampleRate int) (string, error) {
+	if cp, ok := p.(ContextPartialRecognizer); ok {
+		return cp.RecognizePartialContext(ctx, audio, sampleRate)
+	}
+	return p.RecognizePartial(audio, sampleRate)
+}
+
+// LanguageDetector 支持语种识别的 Recognizer
+//
+// languages 为候选语种 (BCP 47, 按优先级排列, 至少一个), 返回音频的语种。
+type LanguageDetector interface {
+	Recognizer
+	DetectLanguage(audio []byte, sampleRate int, languages []string) (string, error)
+}
+
+// SpeechSpan 语音在识别音频中的起止位置 (ms), 相对于本次识别音频的开头
+type SpeechSpan struct {
+	StartMs int64 `json:"speech_start_ms"`
+	EndMs   int64 `json:"speech_end_ms"`
+}
+
+// SpeechSpanDetector 能给出语音起止位置的 Recognizer, 供调用方裁剪音频或与其他模态对齐
+type SpeechSpanDetector interface {
+	Recognizer
+	DetectSpeechSpan(audio []byte, sampleRate int) (SpeechSpan, error)
+}
+
+// detectSpeechSpan 引擎实现 SpeechSpanDetector 时返回语音起止位置, 否则返回 nil
+func detectSpeechSpan(r Recognizer, audio []byte, sampleRate int) (*SpeechSpan, error) {
+	sd, ok := r.(SpeechSpanDetector)
+	if !ok {
+		return nil, nil
+	}
+	span, err := sd.DetectSpeechSpan(audio, sampleRate)
+	if err != nil {
+		return nil, err
+	}
+	return &span, nil
+}
+
+// ASR 引擎名称
+const (
+	ASREngineDemo = "demo"
+)
+
+// newRecognizer 按配置选择 ASR 引擎实现
+func newRecognizer(c *Config) (Recognizer, error) {
+	switch c.ASREngine {
+	case "", ASREngineDemo:
+		return &ASREngine{}, nil
+	}
+	return nil, fmt.Errorf("unknown asr_engine '%s'", c.ASREngine)
+}
+
+// runRecognizer 使用 r 识别, 返回 NLSML 与识别出的语种
+//
+// 有激活的语法且引擎支持时按语法约束识别 (只返回最佳结果), 只支持单个语法的引擎
+// 使用其中权重最高的; 否则 alternatives > 1 且引擎支持时返回多个候选。
+// 引擎实现 LanguageDetector 时从 languages 中识别语种, 否则语种为空。
+// 结果按识别出的语种 (为空时取首选语种) 经 postprocessNLSML 后处理, 再按 c 的 confidence_calibration 校准置信度。
+// r 注册了熔断器时, 熔断打开期间直接返回 *circuitOpenError, 引擎的任何错误都计为后端故障。
+func runRecognizer(r Recognizer, audio []byte, sampleRate int, alternatives int,
+	grammars []*Grammar, languages []string, c *Config) (string, string, error) {
+	b := breakerFor(r)
+	if err := b.allow(c); err != nil {
+		return "", "", err
+	}
+	language := ""
+	if ld, ok := r.(LanguageDetector); ok && len(languages) > 0 {
+		lang, err := ld.DetectLanguage(audio, sampleRate, languages)
+		if err != nil {
+			b.record(err, true, c)
+			return "", "", err
+		}
+		language = lang
+	}
+
+	var result string
+	var err error
+	if mr, ok := r.(MultiGrammarRecognizer); ok && len(grammars) > 0 {
+		result, err = mr.RecognizeWithGrammars(audio, sampleRate, grammars)
+	} else if gr, ok := r.(GrammarRecognizer); ok && len(grammars) > 0 {
+		result, err = gr.RecognizeWithGrammar(audio, sampleRate, heaviestGrammar(grammars))
+	} else if nr, ok := r.(NBestRecognizer); ok && alternatives > 1 {
+		result, err = nr.RecognizeNBest(audio, sampleRate, alternatives)
+	} else {
+		result, err = r.Recognize(audio, sampleRate)
+	}
+	b.record(err, err != nil, c)
+	if err != nil {
+		return result, language, err
+	}
+
+	lang := language
+	if lang == "" && len(languages) > 0 {
+		lang = languages[0]
+	}
+	return calibrateNLSML(postprocessNLSML(result, lang), c), language, nil
+}
+
+// recognitionError 将识别错误映射为错误响应: 熔断打开时为 BACKEND_UNAVAILABLE, 否则为 RECOGNITION_FAILED
+func recognitionError(err error) ErrorResponse {
+	var open *circuitOpenError
+	if errors.As(err, &open) {
+		return *circuitOpenResponse(open)
+	}
+	return ErrorResponse{Status: "error", Code: "RECOGNITION_FAILED", Message: fmt.Sprintf("Recognition failed: %v", err)}
+}
+
+// circuitOpenResponse 熔断打开时的错误响应, retry_after_ms 为距离下次探测的时间
+func circuitOpenResponse(open *circuitOpenError) *ErrorResponse {
+	return &ErrorResponse{Status: "error", Code: "BACKEND_UNAVAILABLE",
+		Message:      fmt.Sprintf("Backend '%s' unavailable (circuit open)", open.engine),
+		RetryAfterMs: open.retryAfter.Milliseconds() + 1}
+}
+
+// asrLanguages 解析候选语种: languages 优先, 其次 language, 均未指定时使用 def
+func asrLanguages(language string, languages []string, def string) []string {
+	var out []string
+	for _, l := range languages {
+		if l = strings.TrimSpace(l); l != "" {
+			out = append(out, l)
+		}
+	}
+	if len(out) == 0 {
+		if l := strings.TrimSpace(language); l != "" {
+			out = []string{l}
+		}
+	}
+	if len(out) == 0 && def != "" {
+		out = []string{def}
+	}
+	return out
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSynthesisTimeoutCoversRealtimePlayback(t *testing.T) {
+	cfg := DefaultConfig()
+	engine := &TTSEngine{}
+	realtime, batch := true, false
+	long := TTSRequest{Text: strings.Repeat("字", 5000), Speed: 1.0}
+
+	// 5000 字 × 200ms = 1000s 的音频, 实时发送时期限为其 2 倍
+	if got, want := synthesisTimeout(engine, long, cfg), 2000*time.Second; got != want {
+		t.Fatalf("synthesisTimeout(long realtime) = %s, want %s", got, want)
+	}
+	long.Realtime = &realtime
+	if got := synthesisTimeout(engine, long, cfg); got != 2000*time.Second {
+		t.Fatalf("synthesisTimeout(long explicit realtime) = %s", got)
+	}
+	long.Realtime = &batch
+	if got := synthesisTimeout(engine, long, cfg); got != cfg.SynthesisTimeout {
+		t.Fatalf("synthesisTimeout(long batch) = %s, want %s", got, cfg.SynthesisTimeout)
+	}
+	short := TTSRequest{Text: "你好", Speed: 1.0}
+	if got := synthesisTimeout(engine, short, cfg); got != cfg.SynthesisTimeout {
+		t.Fatalf("synthesisTimeout(short) = %s, want %s", got, cfg.SynthesisTimeout)
+	}
+	fast := TTSRequest{Text: strings.Repeat("字", 1000), Speed: 2.0, LeadSilenceMs: 1000}
+	if got, want := synthesisTimeout(engine, fast, cfg), 2*101*time.Second; got != want {
+		t.Fatalf("synthesisTimeout(speed 2) = %s, want %s", got, want)
+	}
+	// SSML 标记不计为字符, 停顿计入时长
+	ssml := TTSRequest{Text: `<speak><prosody rate="1.0">` + strings.Repeat("字", 1000) +
+		`</prosody><break time="60s"/></speak>`}
+	if got, want := synthesisTimeout(engine, ssml, cfg), 2*260*time.Second; got != want {
+		t.Fatalf("synthesisTimeout(ssml) = %s, want %s", got, want)
+	}
+	// 拼接播放: 录音按实际时长计入
+	dir := t.TempDir()
+	prompt := append(wavHeader(8000*2*30, 8000, 1, EncodingPCM16), make([]byte, 8000*2*30)...)
+	if err := os.WriteFile(filepath.Join(dir, "welcome.wav"), prompt, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg.PromptDir = dir
+	segments := TTSRequest{Segments: []TTSSegment{{Text: strings.Repeat("字", 1000)}, {Prompt: "welcome"}}}
+	if got, want := synthesisTimeout(engine, segments, cfg), 2*230*time.Second; got != want {
+		t.Fatalf("synthesisTimeout(segments) = %s, want %s", got, want)
+	}
+
+	// 按引擎配置的每字符时长估算, 缓存包装不影响
+	slow := &TTSEngine{CharDurationMs: 400}
+	if got, want := synthesisTimeout(newCachingSynthesizer(slow, 1), fast, cfg), 2*201*time.Second; got != want {
+		t.Fatalf("synthesisTimeout(char_duration 400ms) = %s, want %s", got, want)
+	}
+
+	cfg.SynthesisTimeout = 0
+	long.Realtime = nil
+	if got := synthesisTimeout(engine, long, cfg); got != 0 {
+		t.Fatalf("synthesisTimeout with synthesis_timeout 0 = %s, want 0", got)
+	}
+}
+
+func TestSynthesisTimeoutError(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.SynthesisTimeout = 10 * time.Millisecond
+	ctx, cancel := withSynthesisTimeout(withConfig(context.Background(), cfg), &TTSEngine{}, TTSRequest{})
+	defer cancel()
+	<-ctx.Done()
+
+	err := timeoutCause(ctx, ctx.Err())
+	var timeout *synthesisTimeoutError
+	if !errors.As(err, &timeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("timeoutCause = %v, want *synthesisTimeoutError", err)
+	}
+	if isSynthesisFailure(err) {
+		t.Fatal("synthesis timeout counted as backend failure")
+	}
+	errResp := synthesisError(err, cfg)
+	if errResp == nil || errResp.Code != "SYNTHESIS_TIMEOUT" || errResp.Message != "Synthesis exceeded 10ms" {
+		t.Fatalf("synthesisError = %+v", errResp)
+	}
+
+	if err := timeoutCause(ctx, context.Canceled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("timeoutCause(Canceled) = %v", err)
+	}
+}
+
+func TestEstimatedAudioDurationConvert(t *testing.T) {
+	req := TTSRequest{Action: "convert", InputSampleRate: 8000, SourceAudio: make([]byte, 16000)}
+	if got := estimatedAudioDuration(&TTSEngine{}, req, DefaultConfig()); got != time.Second {
+		t.Fatalf("estimatedAudioDuration(1s of 8kHz pcm16) = %s", got)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+// TTS 控制消息的格式版本, 由 tts 请求的 protocol_version 选择
+const (
+	PROTOCOL_V1 = 1 // 以 status 区分消息, 默认
+	PROTOCOL_V2 = 2 // 以 type 区分消息, 与 audio_start、mark 等事件一致
+)
+
+// CompleteEvent protocol_version 2 的完成与打断消息
+type CompleteEvent struct {
+	Type       string `json:"type"` // complete 或 interrupted
+	DurationMs int64  `json:"duration_ms"`
+	Frames     int    `json:"frames"`
+}
+
+// ErrorEvent protocol_version 2 的错误消息, 附加字段与 ErrorResponse 相同
+type ErrorEvent struct {
+	Type         string   `json:"type"` // 固定 "error"
+	Code         string   `json:"code"`
+	Message      string   `json:"message"`
+	RetryAfterMs int64    `json:"retry_after_ms,omitempty"`
+	Field        string   `json:"field,omitempty"`
+	Supported    []string `json:"supported,omitempty"`
+}
+
+// StatusEvent protocol_version 2 的 StatusResponse
+type StatusEvent struct {
+	Type string `json:"type"` // valid 或 ready
+}
+
+// isSupportedProtocolVersion 判断 protocol_version 是否受支持
+func isSupportedProtocolVersion(version int) bool {
+	return version == PROTOCOL_V1 || version == PROTOCOL_V2
+}
+
+// ttsCompleteMessage 按协议版本构造完成消息, status 为 complete 或 interrupted
+func ttsCompleteMessage(version int, status string, durationMs int64, frames int) interface{} {
+	if version == PROTOCOL_V2 {
+		return CompleteEvent{Type: status, DurationMs: durationMs, Frames: frames}
+	}
+	return CompleteResponse{Status: status, DurationMs: durationMs, Frames: frames}
+}
+
+// ttsStatusMessage 按协议版本构造只有状态的消息, 如 validate 的 valid 与 warmup 的 ready
+func ttsStatusMessage(version int, status string) interface{} {
+	if version == PROTOCOL_V2 {
+		return StatusEvent{Type: status}
+	}
+	return StatusResponse{Status: status}
+}
+
+// sendTTSError 按协议版本发送 TTS 连接上的错误并计数
+func sendTTSError(w *connWriter, version int, resp ErrorResponse) {
+	errorsTotal.WithLabelValues(resp.Code).Inc()
+	if version == PROTOCOL_V2 {
+		sendJSON(w, ErrorEvent{Type: "error", Code: resp.Code, Message: resp.Message,
+			RetryAfterMs: resp.RetryAfterMs, Field: resp.Field, Supported: resp.Supported})
+		return
+	}
+	resp.Status = "error"
+	sendJSON(w, resp)
+}
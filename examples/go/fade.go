@@ -0,0 +1,36 @@
+package main
+
+// FADE_MS 淡入淡出的默认时长
+const FADE_MS = 5
+
+// MAX_FADE_MS fade_ms 的上限, 淡出只是为了消除爆音, 不应占用可感知的时长
+const MAX_FADE_MS = 50
+
+// fadeOutEnabled 打断时是否在末帧淡出, fade_out 未指定时默认开启
+func (req TTSRequest) fadeOutEnabled() bool {
+	return req.FadeOut == nil || *req.FadeOut
+}
+
+// applyFade 原地对 samples 的开头做线性淡入、对末尾做线性淡出, 各覆盖 fadeSamples 个采样
+//
+// 淡入的首个采样增益为 0, 淡出的末个采样增益为 0; samples 短于 fadeSamples 时覆盖全部采样。
+func applyFade(samples []int16, fadeIn, fadeOut bool, fadeSamples int) {
+	n := fadeSamples
+	if n > len(samples) {
+		n = len(samples)
+	}
+	if n <= 0 {
+		return
+	}
+	if fadeIn {
+		for i := 0; i < n; i++ {
+			samples[i] = int16(float64(samples[i]) * float64(i) / float64(n))
+		}
+	}
+	if fadeOut {
+		tail := samples[len(samples)-n:]
+		for i := range tail {
+			tail[i] = int16(float64(tail[i]) * float64(n-1-i) / float64(n))
+		}
+	}
+}
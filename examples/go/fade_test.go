@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+// constantSamples 返回 n 个值为 v 的采样
+func constantSamples(n int, v int16) []int16 {
+	samples := make([]int16, n)
+	for i := range samples {
+		samples[i] = v
+	}
+	return samples
+}
+
+func TestApplyFadeEnvelope(t *testing.T) {
+	tests := []struct {
+		name            string
+		in              []int16
+		fadeIn, fadeOut bool
+		fadeSamples     int
+		want            []int16
+	}{
+		{"fade in", constantSamples(6, 10000), true, false, 4, []int16{0, 2500, 5000, 7500, 10000, 10000}},
+		{"fade out", constantSamples(6, 10000), false, true, 4, []int16{10000, 10000, 7500, 5000, 2500, 0}},
+		{"both", constantSamples(8, -8000), true, true, 4, []int16{0, -2000, -4000, -6000, -6000, -4000, -2000, 0}},
+		{"shorter than fade", constantSamples(2, 10000), false, true, 4, []int16{5000, 0}},
+		{"no fade samples", constantSamples(3, 10000), true, true, 0, []int16{10000, 10000, 10000}},
+		{"disabled", constantSamples(3, 10000), false, false, 4, []int16{10000, 10000, 10000}},
+	}
+	for _, tt := range tests {
+		applyFade(tt.in, tt.fadeIn, tt.fadeOut, tt.fadeSamples)
+		for i := range tt.want {
+			if tt.in[i] != tt.want[i] {
+				t.Errorf("%s: applyFade = %v, want %v", tt.name, tt.in, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestApplyFadeFullScaleNoOverflow(t *testing.T) {
+	samples := []int16{-32768, 32767, -32768, 32767}
+	applyFade(samples, true, true, 2)
+	if samples[0] != 0 || samples[3] != 0 || samples[1] != 16383 || samples[2] != -16384 {
+		t.Fatalf("applyFade = %v", samples)
+	}
+}
+
+func TestSynthesizeFadeOutOnInterrupt(t *testing.T) {
+	setTestConfig(t, nil)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	fadeSamples := 8000 * FADE_MS / 1000
+	frameSamples := 8000 * DEFAULT_FRAME_MS / 1000
+
+	for _, fadeOut := range []bool{true, false} {
+		ctx, cancel := context.WithCancel(withLogger(context.Background(), logger))
+		realtime := false
+		req := TTSRequest{Text: "你好你好", Voice: "xiaoyun", SampleRate: 8000, Realtime: &realtime, FadeOut: &fadeOut}
+		var frames [][]int16
+		err := (&TTSEngine{}).SynthesizeContext(ctx, req, func(frame []byte) {
+			frames = append(frames, decodeFrameSamples(frame, EncodingPCM16, EndianLittle))
+			if len(frames) == 3 {
+				cancel() // 打断
+			}
+		}, nil)
+		cancel()
+		if err != context.Canceled {
+			t.Fatalf("fade_out=%v: err = %v, want context.Canceled", fadeOut, err)
+		}
+
+		if !fadeOut {
+			if len(frames) != 3 {
+				t.Fatalf("fade_out=false: got %d frames, want 3 (no fade tail)", len(frames))
+			}
+			continue
+		}
+		if len(frames) != 4 {
+			t.Fatalf("fade_out=true: got %d frames, want 3 + fade tail", len(frames))
+		}
+		tail := frames[3]
+		if len(tail) != fadeSamples {
+			t.Fatalf("fade tail has %d samples, want %d", len(tail), fadeSamples)
+		}
+		if tail[len(tail)-1] != 0 {
+			t.Fatalf("fade tail ends at %d, want 0", tail[len(tail)-1])
+		}
+		// 尾音接续被打断处的音频, 按线性增益淡出到 0 (允许取整误差)
+		_, full := synthesizeSamples(t, &TTSEngine{}, TTSRequest{Text: "你好你好", Voice: "xiaoyun", SampleRate: 8000})
+		for i, s := range tail {
+			orig := full[3*frameSamples+i]
+			want := int(float64(orig) * float64(fadeSamples-1-i) / float64(fadeSamples))
+			if d := int(s) - want; d > 1 || d < -1 {
+				t.Fatalf("fade tail sample %d = %d, want %d", i, s, want)
+			}
+		}
+	}
+}
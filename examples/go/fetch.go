@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recognize_url 拉取音频的限制
+const (
+	FETCH_TIMEOUT       = 10 * time.Second
+	FETCH_MAX_REDIRECTS = 5
+)
+
+// errAudioTooLarge 拉取的音频超过 max_audio_bytes
+var errAudioTooLarge = errors.New("audio too large")
+
+// fetchError 拉取音频失败, Status 为远端返回的 HTTP 状态码, 未收到响应时为 0
+type fetchError struct {
+	Status  int
+	Message string
+}
+
+func (e *fetchError) Error() string {
+	return e.Message
+}
+
+// fetchClient 拉取音频的 HTTP 客户端, 重定向目标同样须在 fetch_allowed_hosts 中
+var fetchClient = &http.Client{
+	Timeout: FETCH_TIMEOUT,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= FETCH_MAX_REDIRECTS {
+			return fmt.Errorf("too many redirects")
+		}
+		return checkFetchURL(req.URL, configFrom(req.Context()))
+	},
+}
+
+// checkFetchURL 校验拉取地址: 仅允许 http/https 且主机在 fetch_allowed_hosts 中, 防止 SSRF
+//
+// 匹配规则与 allowed_origins 相同; 列表为空时不允许拉取任何地址。
+func checkFetchURL(u *url.URL, c *Config) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme '%s'", u.Scheme)
+	}
+	for _, pattern := range c.FetchAllowedHosts {
+		if matchOrigin(pattern, u) {
+			return nil
+		}
+	}
+	return fmt.Errorf("host '%s' not allowed", u.Host)
+}
+
+// fetchAudio 按配置 c 拉取音频, 返回响应体与 Content-Type
+//
+// 响应体超过 max_audio_bytes 时返回 errAudioTooLarge, 其他失败返回 *fetchError。
+func fetchAudio(rawURL string, c *Config) ([]byte, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, "", &fetchError{Message: fmt.Sprintf("Invalid URL '%s'", rawURL)}
+	}
+	if err := checkFetchURL(u, c); err != nil {
+		return nil, "", &fetchError{Message: fmt.Sprintf("Fetch not allowed: %v", err)}
+	}
+
+	// 重定向目标按同一配置校验
+	req, err := http.NewRequestWithContext(withConfig(context.Background(), c), http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", &fetchError{Message: fmt.Sprintf("Fetch failed: %v", err)}
+	}
+	resp, err := fetchClient.Do(req)
+	if err != nil {
+		return nil, "", &fetchError{Message: fmt.Sprintf("Fetch failed: %v", err)}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", &fetchError{Status: resp.StatusCode,
+			Message: fmt.Sprintf("Fetch failed: HTTP %d", resp.StatusCode)}
+	}
+
+	body := io.Reader(resp.Body)
+	if c.MaxAudioBytes > 0 {
+		if resp.ContentLength > int64(c.MaxAudioBytes) {
+			return nil, "", errAudioTooLarge
+		}
+		body = io.LimitReader(resp.Body, int64(c.MaxAudioBytes)+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, "", &fetchError{Status: resp.StatusCode, Message: fmt.Sprintf("Fetch failed: %v", err)}
+	}
+	if c.MaxAudioBytes > 0 && len(data) > c.MaxAudioBytes {
+		return nil, "", errAudioTooLarge
+	}
+	return data, resp.Header.Get("Content-Type"), nil
+}
+
+// contentTypeCodecs Content-Type 对应的输入编码, WAV 另行按文件头解析
+var contentTypeCodecs = map[string]string{
+	"audio/basic": CodecULaw,
+	"audio/pcmu":  CodecULaw,
+	"audio/pcma":  CodecALaw,
+	"audio/l16":   CodecPCM16,
+}
+
+// decodeSubmittedAudio 将一次性提交的音频 (recognize_url 拉取或 recognize 内联) 解码为 16-bit 小端 PCM,
+// 返回 PCM 与采样率
+//
+// 编码优先取 codec, 其次取 Content-Type (内联音频为空); WAV 文件按文件头解析, 其他未知类型按 pcm16 处理。
+// audio/L16 按 RFC 3551 为网络字节序, 采样率取自其 rate 参数。sampleRate 为 0 时使用默认采样率。
+func decodeSubmittedAudio(data []byte, contentType, codec string, sampleRate int, c *Config) ([]byte, int, error) {
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	bigEndian := false
+	if codec == "" {
+		codec = contentTypeCodecs[mediaType]
+		if mediaType == "audio/l16" {
+			bigEndian = true
+			if rate, err := strconv.Atoi(params["rate"]); err == nil && sampleRate == 0 {
+				sampleRate = rate
+			}
+		}
+	}
+	if sampleRate == 0 {
+		sampleRate = c.DefaultSampleRate
+	}
+
+	if codec == "" || codec == CodecPCM16 {
+		pcm, rate, isWAV, err := parseWAV(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		if isWAV {
+			return pcm, rate, nil
+		}
+		switch {
+		case bigEndian:
+			swapPCM16(data)
+		case codec == "" && strings.HasPrefix(mediaType, "audio/"):
+			// 如 audio/mpeg, 不按 pcm16 误识别
+			return nil, 0, fmt.Errorf("unsupported audio data for Content-Type '%s'", mediaType)
+		}
+		return data, sampleRate, nil
+	}
+
+	decoder, err := newDecoder(codec, sampleRate)
+	if err != nil {
+		return nil, 0, err
+	}
+	pcm, err := decoder.Decode(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	return pcm, sampleRate, nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/rand"
+)
+
+// TTS 二进制帧格式
+const (
+	FramingRaw    = "raw"    // 仅音频数据 (默认)
+	FramingHeaded = "headed" // 12 字节头 + 音频数据
+	FramingRTP    = "rtp"    // 12 字节 RTP 固定头 (RFC 3550) + 音频数据
+)
+
+// FRAME_HEADER_SIZE headed 帧头长度: 4 字节序号 + 8 字节时间戳 (ms), 均为大端
+const FRAME_HEADER_SIZE = 12
+
+// RTP_HEADER_SIZE 不含 CSRC 与扩展的 RTP 固定头长度
+const RTP_HEADER_SIZE = 12
+
+// RTP 负载类型: PCMU/PCMA 为 RFC 3551 静态类型, pcm16 使用动态类型
+const (
+	RTP_PAYLOAD_TYPE_PCMU = 0
+	RTP_PAYLOAD_TYPE_PCMA = 8
+	RTP_PAYLOAD_TYPE_L16  = 96
+)
+
+// isSupportedFraming 判断是否为支持的帧格式, 空值等同 raw
+func isSupportedFraming(framing string) bool {
+	switch framing {
+	case "", FramingRaw, FramingHeaded, FramingRTP:
+		return true
+	}
+	return false
+}
+
+// frameHeaderWriter 为 headed 帧加上序号与时间戳头
+//
+// 序号在同一连接内单调递增 (跨请求不重置); 时间戳为帧首个采样相对本次合成开始的时长,
+// 每个请求 (流式为每个任务) 从 0 开始。由合成协程使用, 同一时刻至多一个合成任务。
+type frameHeaderWriter struct {
+	seq        uint32
+	ptsMs      float64
+	bytesPerMs float64
+	buf        []byte
+}
+
+// reset 开始新的合成任务, startMs 为首帧时间戳 (续传时为已跳过的时长)
+func (w *frameHeaderWriter) reset(startMs int) {
+	w.ptsMs = float64(startMs)
+}
+
+// setFormat 按请求的采样率/声道/编码计算每毫秒字节数, 用于推进时间戳
+func (w *frameHeaderWriter) setFormat(req TTSRequest, c *Config) {
+	w.bytesPerMs = audioBytesPerMs(req, c)
+}
+
+// audioBytesPerMs 请求的输出格式 (未设置的参数按 c 的默认值) 每毫秒音频的字节数
+func audioBytesPerMs(req TTSRequest, c *Config) float64 {
+	applyTTSDefaults(&req, c)
+	return float64(req.SampleRate*req.Channels*bitsPerSample(req.Encoding)/8) / 1000
+}
+
+// wrap 返回加上帧头的数据, 结果复用内部缓冲, 下次调用前有效
+func (w *frameHeaderWriter) wrap(payload []byte) []byte {
+	var header [FRAME_HEADER_SIZE]byte
+	w.buf = append(w.buf[:0], header[:]...)
+	binary.BigEndian.PutUint32(w.buf[0:4], w.seq)
+	binary.BigEndian.PutUint64(w.buf[4:12], uint64(w.ptsMs))
+	w.buf = append(w.buf, payload...)
+
+	w.seq++
+	if w.bytesPerMs > 0 {
+		w.ptsMs += float64(len(payload)) / w.bytesPerMs
+	}
+	return w.buf
+}
+
+// rtpHeaderWriter 为 rtp 帧加上 RTP 固定头
+//
+// SSRC 与初始序号/时间戳在连接建立时随机选取, 序号与时间戳 (采样数) 在连接内连续递增,
+// 每次合成的首帧置 marker 位。由合成协程使用, 同一时刻至多一个合成任务。
+type rtpHeaderWriter struct {
+	ssrc           uint32
+	seq            uint16
+	timestamp      uint32
+	payloadType    byte
+	bytesPerSample int // 每个采样时刻的字节数 (含全部声道)
+	marker         bool
+	buf            []byte
+}
+
+func newRTPHeaderWriter() *rtpHeaderWriter {
+	return &rtpHeaderWriter{
+		ssrc:      rand.Uint32(),
+		seq:       uint16(rand.Uint32()),
+		timestamp: rand.Uint32(),
+	}
+}
+
+// setFormat 按请求的编码选择负载类型, 下一帧置 marker 位
+func (w *rtpHeaderWriter) setFormat(req TTSRequest, c *Config) {
+	applyTTSDefaults(&req, c)
+	switch req.Encoding {
+	case EncodingULaw:
+		w.payloadType = RTP_PAYLOAD_TYPE_PCMU
+	case EncodingALaw:
+		w.payloadType = RTP_PAYLOAD_TYPE_PCMA
+	default:
+		w.payloadType = RTP_PAYLOAD_TYPE_L16
+	}
+	w.bytesPerSample = req.Channels * bitsPerSample(req.Encoding) / 8
+	w.marker = true
+}
+
+// wrap 返回加上 RTP 头的数据, 结果复用内部缓冲, 下次调用前有效
+func (w *rtpHeaderWriter) wrap(payload []byte) []byte {
+	var header [RTP_HEADER_SIZE]byte
+	w.buf = append(w.buf[:0], header[:]...)
+	w.buf[0] = 2 << 6 // V=2, 无填充/扩展/CSRC
+	w.buf[1] = w.payloadType
+	if w.marker {
+		w.buf[1] |= 0x80
+		w.marker = false
+	}
+	binary.BigEndian.PutUint16(w.buf[2:4], w.seq)
+	binary.BigEndian.PutUint32(w.buf[4:8], w.timestamp)
+	binary.BigEndian.PutUint32(w.buf[8:12], w.ssrc)
+	w.buf = append(w.buf, payload...)
+
+	w.seq++
+	if w.bytesPerSample > 0 {
+		w.timestamp += uint32(len(payload) / w.bytesPerSample)
+	}
+	return w.buf
+}
+
+// packetizer 将引擎输出的音频重新切分为等长的负载, 每个负载恰为 packetization_ms 的采样
+//
+// 引擎的帧长与负载相同时直接转发; 合成结束时不足一个负载的剩余音频以静音补齐。
+type packetizer struct {
+	size    int  // 每个负载的字节数
+	silence byte // 编码后的静音字节
+	buf     []byte
+}
+
+// newPacketizer 按请求的格式创建, 未设置 packetization_ms 时返回 nil
+func newPacketizer(req TTSRequest, c *Config) *packetizer {
+	if req.PacketizationMs == 0 {
+		return nil
+	}
+	applyTTSDefaults(&req, c)
+	p := &packetizer{
+		size: req.SampleRate * req.PacketizationMs / 1000 * req.Channels * bitsPerSample(req.Encoding) / 8,
+	}
+	switch req.Encoding {
+	case EncodingULaw:
+		p.silence = linearToULaw(0)
+	case EncodingALaw:
+		p.silence = linearToALaw(0)
+	}
+	return p
+}
+
+// write 追加音频, 每凑满一个负载调用一次 emit; emit 的参数仅在调用期间有效
+func (p *packetizer) write(data []byte, emit func([]byte)) {
+	if len(p.buf) == 0 && len(data) == p.size {
+		emit(data)
+		return
+	}
+	p.buf = append(p.buf, data...)
+	n := 0
+	for ; len(p.buf)-n >= p.size; n += p.size {
+		emit(p.buf[n : n+p.size])
+	}
+	p.buf = append(p.buf[:0], p.buf[n:]...)
+}
+
+// flush 以静音补齐并发送剩余音频
+func (p *packetizer) flush(emit func([]byte)) {
+	if len(p.buf) == 0 {
+		return
+	}
+	for len(p.buf) < p.size {
+		p.buf = append(p.buf, p.silence)
+	}
+	emit(p.buf)
+	p.buf = p.buf[:0]
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/binary"
+	"sync"
+)
+
+// 音频编码
+const (
+	EncodingPCM16 = "pcm16"
+	EncodingULaw  = "ulaw"
+	EncodingALaw  = "alaw"
+)
+
+// pcm16 字节序
+const (
+	EndianLittle = "little"
+	EndianBig    = "big"
+)
+
+// FormatPCM TTS 请求 format 字段唯一支持的值 (UniMRCP 插件发送), 表示无封装的原始音频
+const FormatPCM = "pcm"
+
+// isSupportedEndian 判断是否为支持的 pcm16 字节序
+func isSupportedEndian(endian string) bool {
+	return endian == EndianLittle || endian == EndianBig
+}
+
+// isSupportedEncoding 判断是否为支持的输出编码
+func isSupportedEncoding(encoding string) bool {
+	switch encoding {
+	case EncodingPCM16, EncodingULaw, EncodingALaw:
+		return true
+	}
+	return false
+}
+
+// bitsPerSample 编码的每采样位数
+func bitsPerSample(encoding string) int {
+	if encoding == EncodingULaw || encoding == EncodingALaw {
+		return 8
+	}
+	return 16
+}
+
+// interleaveStereo 将单声道采样复制为左右交错的双声道采样, 追加到 dst 后返回
+func interleaveStereo(dst, samples []int16) []int16 {
+	for _, s := range samples {
+		dst = append(dst, s, s)
+	}
+	return dst
+}
+
+// framePool 复用编码后的帧缓冲, 避免每 20ms 分配一次
+//
+// 缓冲随使用按需增长, 存放 *[]byte 以免 Put 时额外分配。
+var framePool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 640) // 16kHz pcm16 单声道 20ms
+		return &b
+	},
+}
+
+// encodeSamples 将 16-bit 采样编码为指定格式
+//
+// pcm16 每采样 2 字节, 按 endian 排列 (默认 Little-Endian); ulaw/alaw 每采样 1 字节。
+func encodeSamples(samples []int16, encoding, endian string) []byte {
+	return appendEncoded(nil, samples, encoding, endian)
+}
+
+// appendEncoded 将采样编码后追加到 dst, 返回追加后的切片
+func appendEncoded(dst []byte, samples []int16, encoding, endian string) []byte {
+	switch encoding {
+	case EncodingULaw:
+		for _, s := range samples {
+			dst = append(dst, linearToULaw(s))
+		}
+	case EncodingALaw:
+		for _, s := range samples {
+			dst = append(dst, linearToALaw(s))
+		}
+	default:
+		var order binary.AppendByteOrder = binary.LittleEndian
+		if endian == EndianBig {
+			order = binary.BigEndian
+		}
+		for _, s := range samples {
+			dst = order.AppendUint16(dst, uint16(s))
+		}
+	}
+	return dst
+}
+
+// swapPCM16 原地交换每个 16-bit 采样的两个字节, 用于 Little-Endian 与 Big-Endian 互转
+func swapPCM16(data []byte) {
+	for i := 0; i+1 < len(data); i += 2 {
+		data[i], data[i+1] = data[i+1], data[i]
+	}
+}
+
+// linearToULaw 16-bit PCM 转 G.711 μ-law
+func linearToULaw(sample int16) byte {
+	const bias = 0x84
+	const clip = 32635
+
+	s := int(sample)
+	sign := 0
+	if s < 0 {
+		s = -s
+		sign = 0x80
+	}
+	if s > clip {
+		s = clip
+	}
+	s += bias
+
+	exponent := 7
+	for mask := 0x4000; s&mask == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+	mantissa := (s >> (exponent + 3)) & 0x0F
+
+	return ^byte(sign | exponent<<4 | mantissa)
+}
+
+// linearToALaw 16-bit PCM 转 G.711 A-law
+func linearToALaw(sample int16) byte {
+	s := int(sample) >> 3 // 13-bit
+
+	mask := 0xD5
+	if s < 0 {
+		mask = 0x55
+		s = -s - 1
+	}
+
+	seg := 0
+	for end := 0x1F; seg < 8 && s > end; end = end<<1 | 1 {
+		seg++
+	}
+	if seg >= 8 {
+		return byte(0x7F ^ mask)
+	}
+
+	aval := seg << 4
+	if seg < 2 {
+		aval |= (s >> 1) & 0x0F
+	} else {
+		aval |= (s >> seg) & 0x0F
+	}
+	return byte(aval ^ mask)
+}
+
+// ulawTable / alawTable G.711 字节到 16-bit PCM 的解码表
+var ulawTable, alawTable [256]int16
+
+func init() {
+	for i := range ulawTable {
+		ulawTable[i] = decodeULaw(byte(i))
+		alawTable[i] = decodeALaw(byte(i))
+	}
+}
+
+// decodeULaw G.711 μ-law 转 16-bit PCM, 用于生成解码表
+func decodeULaw(b byte) int16 {
+	const bias = 0x84
+
+	u := ^b
+	exponent := int(u>>4) & 0x07
+	mantissa := int(u & 0x0F)
+	s := (mantissa<<3 + bias) << exponent
+	s -= bias
+	if u&0x80 != 0 {
+		return int16(-s)
+	}
+	return int16(s)
+}
+
+// decodeALaw G.711 A-law 转 16-bit PCM, 用于生成解码表
+func decodeALaw(b byte) int16 {
+	a := b ^ 0x55
+	seg := int(a>>4) & 0x07
+	s := int(a&0x0F) << 4
+	switch seg {
+	case 0:
+		s += 8
+	case 1:
+		s += 0x108
+	default:
+		s = (s + 0x108) << (seg - 1)
+	}
+	if a&0x80 == 0 {
+		return int16(-s)
+	}
+	return int16(s)
+}
+
+// ulawToPCM G.711 μ-law 转 16-bit PCM
+func ulawToPCM(b byte) int16 {
+	return ulawTable[b]
+}
+
+// alawToPCM G.711 A-law 转 16-bit PCM
+func alawToPCM(b byte) int16 {
+	return alawTable[b]
+}
+
+// g711Decoder 逐字节查表将 G.711 帧解码为 16-bit 小端 PCM, 无解码状态
+type g711Decoder struct {
+	decode func(byte) int16
+}
+
+// newG711Decoder 返回 G.711 解码器工厂, 任意采样率均可解码
+func newG711Decoder(decode func(byte) int16) DecoderFactory {
+	return func(sampleRate int) (Decoder, error) {
+		return &g711Decoder{decode: decode}, nil
+	}
+}
+
+func (d *g711Decoder) Decode(frame []byte) ([]byte, error) {
+	pcm := make([]byte, 0, len(frame)*2)
+	for _, b := range frame {
+		pcm = binary.LittleEndian.AppendUint16(pcm, uint16(d.decode(b)))
+	}
+	return pcm, nil
+}
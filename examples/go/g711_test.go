@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestG711DecodeKnownValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		decode func(byte) int16
+		in     byte
+		want   int16
+	}{
+		{"ulaw +0", ulawToPCM, 0xFF, 0},
+		{"ulaw -0", ulawToPCM, 0x7F, 0},
+		{"ulaw max", ulawToPCM, 0x80, 32124},
+		{"ulaw min", ulawToPCM, 0x00, -32124},
+		{"alaw smallest positive", alawToPCM, 0xD5, 8},
+		{"alaw smallest negative", alawToPCM, 0x55, -8},
+		{"alaw max", alawToPCM, 0xAA, 32256},
+		{"alaw min", alawToPCM, 0x2A, -32256},
+	}
+	for _, tt := range tests {
+		if got := tt.decode(tt.in); got != tt.want {
+			t.Errorf("%s: decode(%#02x) = %d, want %d", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestG711CodeRoundTrip(t *testing.T) {
+	// 每个码字解码后再编码应得到原码字 (μ-law 的 -0 编码为 +0)
+	for i := 0; i < 256; i++ {
+		b := byte(i)
+		if got := linearToULaw(ulawToPCM(b)); got != b && b != 0x7F {
+			t.Errorf("ulaw %#02x -> %d -> %#02x", b, ulawToPCM(b), got)
+		}
+		if got := linearToALaw(alawToPCM(b)); got != b {
+			t.Errorf("alaw %#02x -> %d -> %#02x", b, alawToPCM(b), got)
+		}
+	}
+}
+
+func TestG711SampleRoundTrip(t *testing.T) {
+	// 对数量化: 误差不超过所在段量化步长的一半, 约为幅度的 1/32, 小信号时有固定下限
+	samples := []int16{0, 1, -1, 7, -8, 100, -100, 1000, -1000, 4096, -4096, 12345, -12345, 32000, -32000, 32767, -32768}
+	for _, s := range samples {
+		for _, c := range []struct {
+			name   string
+			encode func(int16) byte
+			decode func(byte) int16
+		}{
+			{"ulaw", linearToULaw, ulawToPCM},
+			{"alaw", linearToALaw, alawToPCM},
+		} {
+			got := c.decode(c.encode(s))
+			limit := abs16(s)/32 + 16
+			if s > 32124 || s < -32124 {
+				limit = 1024 // 超出 G.711 最大幅度的部分被截断
+			}
+			if diff := int(got) - int(s); diff > limit || diff < -limit {
+				t.Errorf("%s: %d -> %d, error %d exceeds %d", c.name, s, got, diff, limit)
+			}
+			if (s > 16 && got <= 0) || (s < -16 && got >= 0) {
+				t.Errorf("%s: %d -> %d changed sign", c.name, s, got)
+			}
+		}
+	}
+}
+
+func TestG711Decoder(t *testing.T) {
+	decoder, err := newDecoder(CodecALaw, 8000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := []byte{0xD5, 0x55, 0xAA}
+	pcm, err := decoder.Decode(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pcm) != 2*len(frame) {
+		t.Fatalf("len = %d, want %d", len(pcm), 2*len(frame))
+	}
+	for i, b := range frame {
+		if got := int16(binary.LittleEndian.Uint16(pcm[2*i:])); got != alawToPCM(b) {
+			t.Errorf("sample %d = %d, want %d", i, got, alawToPCM(b))
+		}
+	}
+}
+
+func abs16(s int16) int {
+	if s < 0 {
+		return -int(s)
+	}
+	return int(s)
+}
+
+// benchmarkFrame 16kHz 20ms 的测试帧
+func benchmarkFrame() []int16 {
+	samples := make([]int16, 320)
+	for i := range samples {
+		samples[i] = int16(i*97 - 16000)
+	}
+	return samples
+}
+
+func BenchmarkEncodeSamples(b *testing.B) {
+	samples := benchmarkFrame()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		encodeSamples(samples, EncodingPCM16, EndianLittle)
+	}
+}
+
+func BenchmarkAppendEncodedPooled(b *testing.B) {
+	for _, encoding := range []string{EncodingPCM16, EncodingULaw, EncodingALaw} {
+		b.Run(encoding, func(b *testing.B) {
+			samples := benchmarkFrame()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				bufp := framePool.Get().(*[]byte)
+				*bufp = appendEncoded((*bufp)[:0], samples, encoding, EndianLittle)
+				framePool.Put(bufp)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DEFAULT_GRAMMAR_URI 未定义语法时 NLSML 中的 grammar 属性
+const DEFAULT_GRAMMAR_URI = "session:request"
+
+// MAX_GRAMMARS 单次 define_grammar 可定义的语法数上限
+const MAX_GRAMMARS = 32
+
+// Grammar 客户端通过 define_grammar 定义的识别语法
+type Grammar struct {
+	URI     string   // 写入 NLSML 的 grammar 属性
+	Phrases []string // 语法允许的短语
+	Weight  float64  // 同时激活多个语法时的权重, 默认 1.0
+}
+
+// GrammarSpec define_grammar 的 grammars 列表中的一项
+type GrammarSpec struct {
+	Grammar    string  `json:"grammar"`
+	GrammarURI string  `json:"grammar_uri"`
+	Weight     float64 `json:"weight"` // 0 表示默认 1.0
+}
+
+// parseGrammars 解析 define_grammar 定义的一组语法, grammar_uri 不能重复
+func parseGrammars(specs []GrammarSpec) ([]*Grammar, error) {
+	if len(specs) > MAX_GRAMMARS {
+		return nil, fmt.Errorf("too many grammars (%d > %d)", len(specs), MAX_GRAMMARS)
+	}
+
+	seen := make(map[string]bool, len(specs))
+	grammars := make([]*Grammar, 0, len(specs))
+	for _, spec := range specs {
+		if spec.Weight < 0 {
+			return nil, fmt.Errorf("invalid weight %g", spec.Weight)
+		}
+		g, err := parseGrammar(spec.Grammar, spec.GrammarURI)
+		if err != nil {
+			if len(specs) > 1 {
+				return nil, fmt.Errorf("grammar '%s': %v", spec.GrammarURI, err)
+			}
+			return nil, err
+		}
+		if seen[g.URI] {
+			return nil, fmt.Errorf("duplicate grammar_uri '%s'", g.URI)
+		}
+		seen[g.URI] = true
+		if spec.Weight > 0 {
+			g.Weight = spec.Weight
+		}
+		grammars = append(grammars, g)
+	}
+	return grammars, nil
+}
+
+// grammarSet 连接上定义的一组语法及各自的激活状态
+//
+// 方法对 nil 安全, nil 表示未定义语法。
+type grammarSet struct {
+	grammars []*Grammar
+	inactive map[string]bool // 已停用语法的 URI
+}
+
+func newGrammarSet(grammars []*Grammar) *grammarSet {
+	return &grammarSet{grammars: grammars, inactive: make(map[string]bool)}
+}
+
+// active 返回激活的语法, 按定义顺序; 全部停用时返回 nil, 识别不受约束
+func (s *grammarSet) active() []*Grammar {
+	if s == nil {
+		return nil
+	}
+	var active []*Grammar
+	for _, g := range s.grammars {
+		if !s.inactive[g.URI] {
+			active = append(active, g)
+		}
+	}
+	return active
+}
+
+// setActive 激活或停用 uri 对应的语法, 未定义该语法时返回 false
+func (s *grammarSet) setActive(uri string, active bool) bool {
+	if s == nil {
+		return false
+	}
+	for _, g := range s.grammars {
+		if g.URI == uri {
+			if active {
+				delete(s.inactive, uri)
+			} else {
+				s.inactive[uri] = true
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// uri 无结果的 NLSML 使用的 grammar 属性: 第一个激活的语法, 没有时为 DEFAULT_GRAMMAR_URI
+func (s *grammarSet) uri() string {
+	if active := s.active(); len(active) > 0 {
+		return active[0].URI
+	}
+	return DEFAULT_GRAMMAR_URI
+}
+
+// heaviestGrammar 返回权重最高的语法, 权重相同时取先定义的
+func heaviestGrammar(grammars []*Grammar) *Grammar {
+	best := grammars[0]
+	for _, g := range grammars[1:] {
+		if g.Weight > best.Weight {
+			best = g
+		}
+	}
+	return best
+}
+
+// parseGrammar 解析 SRGS XML 或简单词表
+//
+// 以 "<" 开头时按 SRGS 解析, 收集各 <item> 中的文本; 否则按换行或逗号分隔的词表解析。
+func parseGrammar(text, uri string) (*Grammar, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, errors.New("grammar is empty")
+	}
+	if uri == "" {
+		uri = DEFAULT_GRAMMAR_URI
+	}
+
+	var phrases []string
+	var err error
+	if strings.HasPrefix(text, "<") {
+		phrases, err = parseSRGS(text)
+	} else {
+		phrases = strings.FieldsFunc(text, func(r rune) bool {
+			return r == '\n' || r == ',' || r == '，'
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Grammar{URI: uri, Weight: 1.0}
+	for _, p := range phrases {
+		if p = strings.TrimSpace(p); p != "" {
+			g.Phrases = append(g.Phrases, p)
+		}
+	}
+	if len(g.Phrases) == 0 {
+		return nil, errors.New("grammar has no phrases")
+	}
+	return g, nil
+}
+
+// parseSRGS 收集 SRGS XML 中 <item> 直接包含的文本
+func parseSRGS(text string) ([]string, error) {
+	decoder := xml.NewDecoder(strings.NewReader(text))
+	decoder.Strict = true
+
+	var phrases []string
+	var items []*strings.Builder // 未闭合的 <item>
+	seenRoot := false
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if !seenRoot {
+				if t.Name.Local != "grammar" {
+					return nil, fmt.Errorf("root element must be <grammar>, got <%s>", t.Name.Local)
+				}
+				seenRoot = true
+			}
+			if t.Name.Local == "item" {
+				items = append(items, &strings.Builder{})
+			}
+		case xml.EndElement:
+			if t.Name.Local == "item" && len(items) > 0 {
+				phrases = append(phrases, items[len(items)-1].String())
+				items = items[:len(items)-1]
+			}
+		case xml.CharData:
+			if len(items) > 0 {
+				items[len(items)-1].Write(t)
+			}
+		}
+	}
+
+	if !seenRoot {
+		return nil, errors.New("missing <grammar> element")
+	}
+	return phrases, nil
+}
+
+// matches 判断识别文本是否为语法允许的短语
+func (g *Grammar) matches(text string) bool {
+	for _, p := range g.Phrases {
+		if p == text {
+			return true
+		}
+	}
+	return false
+}
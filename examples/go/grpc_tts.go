@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// GRPC_MAX_RETRIES 收到首个音频块前后端不可用时的重试次数
+	GRPC_MAX_RETRIES = 3
+	// GRPC_RETRY_BACKOFF 首次重试的等待时间, 之后每次翻倍
+	GRPC_RETRY_BACKOFF = 200 * time.Millisecond
+	// GRPC_WARMUP_TIMEOUT 预热时等待连接就绪的时间
+	GRPC_WARMUP_TIMEOUT = 5 * time.Second
+	// GRPC_CHUNK_TIMEOUT 等待后端首个及下一个音频块的最长时间, 超过时视为后端不可用
+	GRPC_CHUNK_TIMEOUT = 10 * time.Second
+)
+
+// grpcSynthesizeMethod proto/tts.proto 中的 Synthesize 方法
+const grpcSynthesizeMethod = "/tts.v1.Synthesizer/Synthesize"
+
+var grpcSynthesizeStream = &grpc.StreamDesc{
+	StreamName:    "Synthesize",
+	ServerStreams: true,
+}
+
+// GRPCTTSEngine 通过 gRPC 服务端流调用外部 TTS 服务
+//
+// 每次合成发起一个 Synthesize 调用, 收到的每个 AudioChunk 作为一个二进制帧转发。
+// 连接断开后由 gRPC 按退避自动重连。
+type GRPCTTSEngine struct {
+	conn *grpc.ClientConn
+	// chunkTimeout 等待下一个音频块的最长时间, 默认 GRPC_CHUNK_TIMEOUT
+	chunkTimeout time.Duration
+}
+
+// NewGRPCTTSEngine 创建连接到 target 的 gRPC TTS 引擎
+//
+// 连接是惰性建立的, 后端暂时不可用不影响服务启动。
+func NewGRPCTTSEngine(target string) (*GRPCTTSEngine, error) {
+	if target == "" {
+		return nil, errors.New("grpc_tts_target is empty")
+	}
+	conn, err := grpc.NewClient(target,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff: backoff.Config{
+				BaseDelay:  GRPC_RETRY_BACKOFF,
+				Multiplier: 1.6,
+				Jitter:     0.2,
+				MaxDelay:   5 * time.Second,
+			},
+			MinConnectTimeout: 5 * time.Second,
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("grpc tts: %w", err)
+	}
+	return &GRPCTTSEngine{conn: conn, chunkTimeout: GRPC_CHUNK_TIMEOUT}, nil
+}
+
+// Warmup 建立到后端的连接, GRPC_WARMUP_TIMEOUT 内未就绪时返回 errBackendUnavailable
+func (e *GRPCTTSEngine) Warmup() error {
+	ctx, cancel := context.WithTimeout(context.Background(), GRPC_WARMUP_TIMEOUT)
+	defer cancel()
+	e.conn.Connect()
+	for state := e.conn.GetState(); state != connectivity.Ready; state = e.conn.GetState() {
+		if !e.conn.WaitForStateChange(ctx, state) {
+			return errBackendUnavailable
+		}
+	}
+	return nil
+}
+
+// Synthesize 合成语音
+func (e *GRPCTTSEngine) Synthesize(req TTSRequest, sendFrame func([]byte), onComplete func()) {
+	if e.SynthesizeContext(context.Background(), req, sendFrame, nil) == nil {
+		onComplete()
+	}
+}
+
+// SynthesizeContext 合成语音, 后端断开或 chunkTimeout 内没有音频时返回 errBackendUnavailable
+//
+// 后端协议只有文本, 拼接播放 (segments) 返回 errSegmentsUnsupported。
+// 收到首个音频块之前的 Unavailable 错误按退避重试, 之后断开不再重试,
+// 以免重复发送已播放的音频。
+func (e *GRPCTTSEngine) SynthesizeContext(ctx context.Context, req TTSRequest,
+	sendFrame func([]byte), sendEvent func(interface{})) error {
+	if len(req.Segments) > 0 {
+		return errSegmentsUnsupported
+	}
+	logger := loggerFrom(ctx)
+	applyTTSDefaults(&req, configFrom(ctx))
+
+	start := time.Now()
+	defer func() {
+		synthesisDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	delay := GRPC_RETRY_BACKOFF
+	for attempt := 0; ; attempt++ {
+		received, err := e.stream(ctx, req, sendFrame, sendEvent)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if received || status.Code(err) != codes.Unavailable || attempt >= GRPC_MAX_RETRIES {
+			logger.Warn("gRPC TTS 后端不可用", "error", err, "attempts", attempt+1)
+			return fmt.Errorf("%w: %v", errBackendUnavailable, err)
+		}
+
+		logger.Info("gRPC TTS 后端不可用, 稍后重试", "error", err, "delay", delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// stream 发起一次 Synthesize 调用并转发音频块, received 表示是否已转发过音频
+//
+// 等待每个音频块不超过 chunkTimeout, 转发音频 (实时发送时按音频时长阻塞) 的时间不计入。
+func (e *GRPCTTSEngine) stream(ctx context.Context, req TTSRequest,
+	sendFrame func([]byte), sendEvent func(interface{})) (received bool, err error) {
+	cfg := configFrom(ctx)
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	stalled := fmt.Errorf("no audio from backend within %v", e.chunkTimeout)
+	idle := time.AfterFunc(e.chunkTimeout, func() { cancel(stalled) })
+	defer idle.Stop()
+
+	stream, err := e.conn.NewStream(ctx, grpcSynthesizeStream, grpcSynthesizeMethod,
+		grpc.ForceCodec(protoCodec{}))
+	if err != nil {
+		return false, err
+	}
+	if err := stream.SendMsg(newSynthesizeRequest(req)); err != nil {
+		return false, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return false, err
+	}
+
+	for {
+		var chunk audioChunk
+		if err := stream.RecvMsg(&chunk); err != nil {
+			if err == io.EOF {
+				return received, nil
+			}
+			if context.Cause(ctx) == stalled {
+				return received, stalled
+			}
+			return received, err
+		}
+		if len(chunk.Audio) == 0 {
+			continue
+		}
+		if !received && cfg.AudioStart && sendEvent != nil {
+			sendEvent(newAudioStart(req))
+		}
+		received = true
+		if req.Encoding == EncodingPCM16 && req.Endian == EndianBig {
+			// 后端按 Little-Endian 返回 pcm16
+			swapPCM16(chunk.Audio)
+		}
+		idle.Stop()
+		sendFrame(chunk.Audio)
+		audioBytesSent.Add(float64(len(chunk.Audio)))
+		idle.Reset(e.chunkTimeout)
+	}
+}
+
+// synthesizeRequest tts.v1.SynthesizeRequest
+type synthesizeRequest struct {
+	Text       string
+	Voice      string
+	Speed      float32
+	Pitch      float32
+	Volume     float32
+	SampleRate int32
+	Encoding   string
+	Channels   int32
+	Lexicon    []LexiconEntry
+}
+
+// newSynthesizeRequest 由 TTSRequest 构建 gRPC 请求
+func newSynthesizeRequest(req TTSRequest) *synthesizeRequest {
+	return &synthesizeRequest{
+		Text:       req.Text,
+		Voice:      req.Voice,
+		Speed:      float32(req.Speed),
+		Pitch:      float32(req.Pitch),
+		Volume:     float32(req.Volume),
+		SampleRate: int32(req.SampleRate),
+		Encoding:   req.Encoding,
+		Channels:   int32(req.Channels),
+		Lexicon:    req.Lexicon,
+	}
+}
+
+// marshal 按 proto3 规则编码, 零值字段省略
+func (m *synthesizeRequest) marshal() []byte {
+	var b []byte
+	appendString := func(num protowire.Number, s string) {
+		if s != "" {
+			b = protowire.AppendTag(b, num, protowire.BytesType)
+			b = protowire.AppendString(b, s)
+		}
+	}
+	appendFloat := func(num protowire.Number, f float32) {
+		if f != 0 {
+			b = protowire.AppendTag(b, num, protowire.Fixed32Type)
+			b = protowire.AppendFixed32(b, math.Float32bits(f))
+		}
+	}
+	appendInt := func(num protowire.Number, v int32) {
+		if v != 0 {
+			b = protowire.AppendTag(b, num, protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(v))
+		}
+	}
+
+	appendString(1, m.Text)
+	appendString(2, m.Voice)
+	appendFloat(3, m.Speed)
+	appendFloat(4, m.Pitch)
+	appendFloat(5, m.Volume)
+	appendInt(6, m.SampleRate)
+	appendString(7, m.Encoding)
+	appendInt(8, m.Channels)
+	for _, e := range m.Lexicon {
+		// tts.v1.LexiconEntry, 作为嵌套消息编码
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, e.Word)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendString(entry, e.Pron)
+		b = protowire.AppendTag(b, 9, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	return b
+}
+
+// audioChunk tts.v1.AudioChunk
+type audioChunk struct {
+	Audio []byte
+}
+
+// unmarshal 解码 AudioChunk, 忽略未知字段
+func (m *audioChunk) unmarshal(b []byte) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if num == 1 && typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			m.Audio = append(m.Audio[:0], v...)
+			b = b[n:]
+			continue
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// protoCodec 手写 protobuf 编解码, 省去 protoc 生成代码
+//
+// 名称为 proto, 与使用生成代码的服务端互通。
+type protoCodec struct{}
+
+func (protoCodec) Name() string { return "proto" }
+
+func (protoCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(interface{ marshal() []byte })
+	if !ok {
+		return nil, fmt.Errorf("protoCodec: cannot marshal %T", v)
+	}
+	return m.marshal(), nil
+}
+
+func (protoCodec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(interface{ unmarshal([]byte) error })
+	if !ok {
+		return fmt.Errorf("protoCodec: cannot unmarshal %T", v)
+	}
+	return m.unmarshal(data)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// startTime 进程启动时间, 用于计算运行时长
+var startTime = time.Now()
+
+// HealthResponse /health 响应结构
+type HealthResponse struct {
+	Status        string `json:"status"`
+	UptimeSeconds int64  `json:"uptime_seconds"`
+}
+
+// handleHealth 存活探针, 进程可响应即返回 200
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, HealthResponse{
+		Status:        "ok",
+		UptimeSeconds: int64(time.Since(startTime).Seconds()),
+	})
+}
+
+// handleReady 就绪探针, 优雅关闭开始后返回 503
+func handleReady(w http.ResponseWriter, r *http.Request) {
+	if connections.isClosing() {
+		writeJSON(w, http.StatusServiceUnavailable, HealthResponse{Status: "shutting_down"})
+		return
+	}
+	writeJSON(w, http.StatusOK, HealthResponse{Status: "ready"})
+}
+
+// writeJSON 写 JSON 响应
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// MAX_LEXICON_ENTRIES 单个连接发音词典的条目数上限
+const MAX_LEXICON_ENTRIES = 1000
+
+// LexiconEntry 发音词典条目, Pron 为 IPA 音标
+type LexiconEntry struct {
+	Word string `json:"word"`
+	Pron string `json:"pron"`
+}
+
+// ipaRanges IPA 音标允许的字符范围 (除 a-z 与分隔符外)
+var ipaRanges = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x00e6, Hi: 0x00e7, Stride: 1}, // æ ç
+		{Lo: 0x00f0, Hi: 0x00f0, Stride: 1}, // ð
+		{Lo: 0x00f8, Hi: 0x00f8, Stride: 1}, // ø
+		{Lo: 0x0127, Hi: 0x0127, Stride: 1}, // ħ
+		{Lo: 0x014b, Hi: 0x014b, Stride: 1}, // ŋ
+		{Lo: 0x0153, Hi: 0x0153, Stride: 1}, // œ
+		{Lo: 0x0250, Hi: 0x02ff, Stride: 1}, // IPA 扩展与修饰符 (ˈ ˌ ː 等)
+		{Lo: 0x0300, Hi: 0x036f, Stride: 1}, // 组合附加符号
+		{Lo: 0x03b2, Hi: 0x03b2, Stride: 1}, // β
+		{Lo: 0x03b8, Hi: 0x03b8, Stride: 1}, // θ
+		{Lo: 0x03c7, Hi: 0x03c7, Stride: 1}, // χ
+		{Lo: 0x1d00, Hi: 0x1dbf, Stride: 1}, // 音标扩展
+		{Lo: 0x2016, Hi: 0x2016, Stride: 1}, // ‖ 语调群边界
+		{Lo: 0x203f, Hi: 0x203f, Stride: 1}, // ‿ 连读
+	},
+}
+
+// isIPARune 判断 r 是否可出现在 IPA 音标中, 空格、"." (音节) 与 "|" (韵律边界) 视为分隔符
+func isIPARune(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z':
+		return true
+	case r == ' ' || r == '.' || r == '|':
+		return true
+	}
+	return unicode.Is(ipaRanges, r)
+}
+
+// parseLexicon 校验词典条目, 同一词后出现的条目覆盖先出现的
+func parseLexicon(entries []LexiconEntry) ([]LexiconEntry, error) {
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no lexicon entries")
+	}
+	if len(entries) > MAX_LEXICON_ENTRIES {
+		return nil, fmt.Errorf("too many lexicon entries (%d > %d)", len(entries), MAX_LEXICON_ENTRIES)
+	}
+
+	index := make(map[string]int, len(entries))
+	var lexicon []LexiconEntry
+	for _, e := range entries {
+		word := strings.TrimSpace(e.Word)
+		pron := strings.TrimSpace(e.Pron)
+		if word == "" {
+			return nil, fmt.Errorf("empty word")
+		}
+		if pron == "" {
+			return nil, fmt.Errorf("empty pron for '%s'", word)
+		}
+		for _, r := range pron {
+			if !isIPARune(r) {
+				return nil, fmt.Errorf("invalid IPA character '%c' in pron for '%s'", r, word)
+			}
+		}
+
+		entry := LexiconEntry{Word: word, Pron: pron}
+		if i, ok := index[word]; ok {
+			lexicon[i] = entry
+			continue
+		}
+		index[word] = len(lexicon)
+		lexicon = append(lexicon, entry)
+	}
+	return lexicon, nil
+}
+
+// applyLexicon 为各文本片段标注其中出现的词典条目 (区分大小写), 供引擎按音标发音
+func applyLexicon(segments []ssmlSegment, lexicon []LexiconEntry) {
+	if len(lexicon) == 0 {
+		return
+	}
+	for i := range segments {
+		if segments[i].Text == "" {
+			continue
+		}
+		for _, e := range lexicon {
+			if strings.Contains(segments[i].Text, e.Word) {
+				segments[i].Lexicon = append(segments[i].Lexicon, e)
+			}
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RETRY_AFTER_SECONDS 连接数超限时建议客户端重试的间隔
+const RETRY_AFTER_SECONDS = 5
+
+// connLimiter 限制总连接数与单个 IP 的连接数, 0 表示不限制
+type connLimiter struct {
+	mu     sync.Mutex
+	max    int
+	perIP  int
+	active int
+	byIP   map[string]int
+}
+
+func newConnLimiter(max, perIP int) *connLimiter {
+	return &connLimiter{max: max, perIP: perIP, byIP: make(map[string]int)}
+}
+
+// acquire 占用一个连接名额, 超限时返回 false
+func (l *connLimiter) acquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.max > 0 && l.active >= l.max {
+		return false
+	}
+	if l.perIP > 0 && l.byIP[ip] >= l.perIP {
+		return false
+	}
+	l.active++
+	l.byIP[ip]++
+	return true
+}
+
+// release 释放 acquire 占用的名额
+func (l *connLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	if l.byIP[ip]--; l.byIP[ip] <= 0 {
+		delete(l.byIP, ip)
+	}
+}
+
+// Active 当前占用的连接数
+func (l *connLimiter) Active() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.active
+}
+
+// clientIP 取请求的对端 IP
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rejectBusy 在升级前以 503 拒绝连接
+func rejectBusy(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(RETRY_AFTER_SECONDS))
+	http.Error(w, "too many connections", http.StatusServiceUnavailable)
+}
+
+// tokenBucket 令牌桶限流, 以 rate 个/秒补充, 最多累积 burst 个
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	capacity := bucketBurst(rate, burst)
+	return &tokenBucket{rate: rate, burst: capacity, tokens: capacity, last: time.Now()}
+}
+
+// bucketBurst 令牌桶容量, burst 未配置时取 rate (至少 1)
+func bucketBurst(rate float64, burst int) float64 {
+	if burst <= 0 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	return float64(burst)
+}
+
+// setRate 按原速率补充到当前时刻后改用新的速率与容量, 已有的令牌不超过新容量
+func (b *tokenBucket) setRate(rate float64, burst int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.rate, b.burst = rate, bucketBurst(rate, burst)
+	b.tokens = math.Min(b.burst, b.tokens)
+}
+
+// take 取一个令牌; 令牌不足时返回 false 及下一个令牌可用前需等待的时间
+func (b *tokenBucket) take() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	return false, wait
+}
+
+// rateLimiter 按连接或用户分配令牌桶, rate 为 0 时不限流
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   int
+	perUser bool
+	users   map[string]*tokenBucket
+}
+
+func newRateLimiter(rate float64, burst int, perUser bool) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: burst, perUser: perUser, users: make(map[string]*tokenBucket)}
+}
+
+// bucket 返回连接使用的令牌桶, 不限流时返回 nil
+//
+// per_user 开启且连接已鉴权时, 同一用户的所有连接共享一个桶; 否则每个连接独立。
+func (l *rateLimiter) bucket(user string) *tokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 {
+		return nil
+	}
+	if !l.perUser || user == "" {
+		return newTokenBucket(l.rate, l.burst)
+	}
+	b, ok := l.users[user]
+	if !ok {
+		b = newTokenBucket(l.rate, l.burst)
+		l.users[user] = b
+	}
+	return b
+}
+
+// configure 替换限流参数
+//
+// 按用户共享的令牌桶保留已消耗的令牌, 只更新速率与容量, 重新加载不会让用户的额度回满;
+// 关闭 per_user 或限流时清空共享的桶。每个连接独立的桶沿用原来的参数。
+func (l *rateLimiter) configure(rate float64, burst int, perUser bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate, l.burst, l.perUser = rate, burst, perUser
+	if rate <= 0 || !perUser {
+		l.users = make(map[string]*tokenBucket)
+		return
+	}
+	for _, b := range l.users {
+		b.setRate(rate, burst)
+	}
+}
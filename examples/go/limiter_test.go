@@ -0,0 +1,185 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestConnLimiterTotal(t *testing.T) {
+	l := newConnLimiter(2, 0)
+	if !l.acquire("10.0.0.1") || !l.acquire("10.0.0.2") {
+		t.Fatal("acquire within the limit failed")
+	}
+	if l.acquire("10.0.0.3") {
+		t.Fatal("acquire above max_connections succeeded")
+	}
+	l.release("10.0.0.1")
+	if !l.acquire("10.0.0.3") {
+		t.Fatal("acquire after release failed")
+	}
+	if l.Active() != 2 {
+		t.Fatalf("Active = %d, want 2", l.Active())
+	}
+}
+
+func TestConnLimiterPerIP(t *testing.T) {
+	l := newConnLimiter(0, 1)
+	if !l.acquire("10.0.0.1") {
+		t.Fatal("first connection rejected")
+	}
+	if l.acquire("10.0.0.1") {
+		t.Fatal("second connection from the same IP accepted")
+	}
+	if !l.acquire("10.0.0.2") {
+		t.Fatal("connection from another IP rejected")
+	}
+	l.release("10.0.0.1")
+	if _, ok := l.byIP["10.0.0.1"]; ok {
+		t.Fatal("released IP still tracked")
+	}
+	if !l.acquire("10.0.0.1") {
+		t.Fatal("acquire after release failed")
+	}
+}
+
+func TestConnLimiterUnlimited(t *testing.T) {
+	l := newConnLimiter(0, 0)
+	for i := 0; i < 100; i++ {
+		if !l.acquire("10.0.0.1") {
+			t.Fatalf("acquire %d rejected without limits", i)
+		}
+	}
+}
+
+func TestConnectionLimitRejectsUpgrade(t *testing.T) {
+	setTestConfig(t, nil)
+	prev := limiter
+	limiter = newConnLimiter(1, 0)
+	t.Cleanup(func() { limiter = prev })
+
+	srv := httptest.NewServer(http.HandlerFunc(handleTTS))
+	t.Cleanup(srv.Close)
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil {
+		t.Fatal("second connection accepted above the limit")
+	}
+	if resp == nil || resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("response = %+v, want 503 with Retry-After", resp)
+	}
+}
+
+func TestTokenBucketBurstAndRefill(t *testing.T) {
+	b := newTokenBucket(2, 3)
+	for i := 0; i < 3; i++ {
+		if ok, _ := b.take(); !ok {
+			t.Fatalf("take %d within burst rejected", i)
+		}
+	}
+	ok, wait := b.take()
+	if ok {
+		t.Fatal("take beyond burst accepted")
+	}
+	if wait <= 0 || wait > 500*time.Millisecond {
+		t.Fatalf("retry after %s, want (0, 500ms] at 2 tokens/s", wait)
+	}
+
+	// 模拟经过 1s: 补充 2 个令牌
+	b.last = b.last.Add(-time.Second)
+	for i := 0; i < 2; i++ {
+		if ok, _ := b.take(); !ok {
+			t.Fatalf("take %d after refill rejected", i)
+		}
+	}
+	if ok, _ := b.take(); ok {
+		t.Fatal("refill exceeded the rate")
+	}
+
+	// 长时间空闲后最多累积 burst 个
+	b.last = b.last.Add(-time.Hour)
+	taken := 0
+	for ok, _ := b.take(); ok; ok, _ = b.take() {
+		taken++
+	}
+	if taken != 3 {
+		t.Fatalf("took %d tokens after idling, want burst 3", taken)
+	}
+}
+
+func TestTokenBucketDefaultBurst(t *testing.T) {
+	if b := newTokenBucket(2.5, 0); b.burst != 3 {
+		t.Fatalf("burst = %g, want ceil(rate) = 3", b.burst)
+	}
+	if b := newTokenBucket(0.2, 0); b.burst != 1 {
+		t.Fatalf("burst = %g, want 1", b.burst)
+	}
+}
+
+func TestRateLimiterBuckets(t *testing.T) {
+	if newRateLimiter(0, 0, false).bucket("alice") != nil {
+		t.Fatal("rate 0 returned a bucket")
+	}
+
+	perConn := newRateLimiter(1, 1, false)
+	if perConn.bucket("alice") == perConn.bucket("alice") {
+		t.Fatal("per-connection limiter shared a bucket")
+	}
+
+	perUser := newRateLimiter(1, 1, true)
+	a := perUser.bucket("alice")
+	if perUser.bucket("alice") != a {
+		t.Fatal("per-user limiter did not share the user's bucket")
+	}
+	if perUser.bucket("bob") == a || perUser.bucket("") == perUser.bucket("") {
+		t.Fatal("bucket shared across users or anonymous connections")
+	}
+
+	a.take()
+	perUser.configure(5, 2, true)
+	if b := perUser.bucket("alice"); b != a || b.rate != 5 || b.burst != 2 {
+		t.Fatalf("configure did not keep the shared bucket with the new rate: %+v", b)
+	}
+	if a.tokens >= 1 {
+		t.Fatalf("tokens = %g after configure, want the consumed token not refilled", a.tokens)
+	}
+}
+
+func TestTTSRateLimited(t *testing.T) {
+	setTestConfig(t, nil)
+	prev := ttsRateLimiter
+	ttsRateLimiter = newRateLimiter(0.5, 1, false)
+	t.Cleanup(func() { ttsRateLimiter = prev })
+
+	conn := dialTestWS(t, handleTTS)
+	realtime := false
+	req := TTSRequest{Action: "tts", Text: "你", Realtime: &realtime}
+	writeJSONMessage(t, conn, req)
+	for {
+		m := readJSONMessage(t, conn)
+		if m["code"] != nil {
+			t.Fatalf("first request rejected: %v", m)
+		}
+		if m["status"] == "complete" {
+			break
+		}
+	}
+	writeJSONMessage(t, conn, req)
+	m := readJSONMessage(t, conn)
+	if m["code"] != "RATE_LIMITED" {
+		t.Fatalf("response = %v, want RATE_LIMITED", m)
+	}
+	if retry, _ := m["retry_after_ms"].(float64); retry <= 0 || retry > 2001 {
+		t.Fatalf("retry_after_ms = %v, want (0, 2001]", m["retry_after_ms"])
+	}
+}
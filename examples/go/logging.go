@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+)
+
+// 日志格式
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// setupLogger 按配置设置默认 slog Logger
+//
+// json 便于日志平台按字段过滤, text 为便于人读的 key=value 格式。
+func setupLogger(format string) {
+	var handler slog.Handler
+	if format == LogFormatText {
+		handler = slog.NewTextHandler(os.Stderr, nil)
+	} else {
+		handler = slog.NewJSONHandler(os.Stderr, nil)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// newSessionID 生成随机会话 ID
+func newSessionID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type loggerKey struct{}
+
+// withLogger 将 Logger 放入 ctx, 供引擎内部按会话记录日志
+func withLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// loggerFrom 取 ctx 中的 Logger, 没有时返回默认 Logger
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// fatal 记录错误并退出
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
@@ -6,7 +6,7 @@
  *     go get github.com/gorilla/websocket
  *
  * 运行:
- *     go run main.go
+ *     go run .
  *
  * 说明:
  *     这是一个演示用的 WebSocket 服务器，实现了 TTS 和 ASR 的基本接口。
@@ -17,27 +17,124 @@ package main
 
 import (
 	"bytes"
-	"encoding/binary"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"math"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
+	"unicode"
 
 	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const (
 	HOST = "0.0.0.0"
 	PORT = 8080
+
+	// PING_INTERVAL 服务端发送 Ping 的间隔
+	PING_INTERVAL = 30 * time.Second
+	// READ_TIMEOUT 未收到任何数据或 Pong 的最长时间, 超时后关闭连接
+	READ_TIMEOUT = 60 * time.Second
+
+	// MAX_MESSAGE_SIZE 单条 WebSocket 消息字节数上限的默认值, 见 max_message_size;
+	// 音频帧通常只有几 KB, 上限按 base64 编码后的 max_audio_bytes 默认值 (10 MiB) 留出余量
+	MAX_MESSAGE_SIZE = 16 * 1024 * 1024
+
+	// STREAM_QUEUE_SIZE 流式合成排队的文本段数上限的默认值, 见 stream_queue_size
+	STREAM_QUEUE_SIZE = 64
+
+	// TTS_NATIVE_SAMPLE_RATE 演示 TTS 引擎的原生输出采样率, 其他采样率在发送前重采样
+	TTS_NATIVE_SAMPLE_RATE = 16000
+
+	// MAX_PARSE_ERRORS TTS 连接上连续 JSON 解析失败的次数上限, 达到后以 1008 (违反协议) 关闭连接
+	MAX_PARSE_ERRORS = 5
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // 允许所有来源
-	},
+var upgrader = newUpgrader(DefaultConfig())
+
+// readTimeout 连接的读超时, 即 READ_TIMEOUT; 为变量以便测试缩短
+var readTimeout = READ_TIMEOUT
+
+// writeBufferPool 各连接共享的写缓冲池, write_buffer_pool 开启时使用
+var writeBufferPool = &sync.Pool{}
+
+// newUpgrader 按配置构建 Upgrader
+//
+// 缓冲区大小为 0 时使用 gorilla 的默认值 (4096 字节)。
+func newUpgrader(c *Config) websocket.Upgrader {
+	u := websocket.Upgrader{
+		CheckOrigin:       originChecker(c.AllowedOrigins, c.AllowAllOrigins),
+		EnableCompression: c.EnableCompression,
+		Subprotocols:      c.Subprotocols,
+		ReadBufferSize:    c.ReadBufferSize,
+		WriteBufferSize:   c.WriteBufferSize,
+	}
+	if c.WriteBufferPool {
+		// 写缓冲只在写消息期间占用, 空闲连接不再各自持有
+		u.WriteBufferPool = writeBufferPool
+	}
+	return u
+}
+
+// originChecker 按允许列表校验 Origin, 校验失败时 Upgrade 返回 403
+//
+// 未携带 Origin 头的请求 (非浏览器客户端, 如 UniMRCP 插件) 始终允许。
+// allowAll 仅用于本地开发。
+func originChecker(allowed []string, allowAll bool) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || allowAll {
+			return true
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Host == "" {
+			slog.Warn("拒绝来源: 格式错误", "origin", origin, "remote", clientIP(r))
+			return false
+		}
+		for _, pattern := range allowed {
+			if matchOrigin(pattern, u) {
+				return true
+			}
+		}
+		slog.Warn("拒绝来源", "origin", origin, "remote", clientIP(r))
+		return false
+	}
+}
+
+// matchOrigin 判断 Origin 是否匹配允许项
+//
+// 允许项可为完整来源 ("https://app.example.com")、主机 ("app.example.com")
+// 或通配子域名 ("*.example.com", "https://*.example.com"), 通配不匹配裸域名。
+func matchOrigin(pattern string, origin *url.URL) bool {
+	host := pattern
+	if i := strings.Index(pattern, "://"); i >= 0 {
+		if !strings.EqualFold(pattern[:i], origin.Scheme) {
+			return false
+		}
+		host = pattern[i+3:]
+	}
+
+	if strings.HasPrefix(host, "*.") {
+		suffix := strings.ToLower(host[1:])
+		h := strings.ToLower(origin.Host)
+		return len(h) > len(suffix) && strings.HasSuffix(h, suffix)
+	}
+	return strings.EqualFold(host, origin.Host)
 }
 
 // TTSRequest TTS 请求结构
@@ -45,270 +142,2606 @@ type TTSRequest struct {
 	Action     string  `json:"action"`
 	Text       string  `json:"text"`
 	Voice      string  `json:"voice"`
+	Profile    string  `json:"profile"` // 命名的参数预设, 填充未设置的 voice/speed/pitch/volume
 	Speed      float64 `json:"speed"`
 	Pitch      float64 `json:"pitch"`
 	Volume     float64 `json:"volume"`
 	SampleRate int     `json:"sample_rate"`
+	Encoding   string  `json:"encoding"`
+	Endian     string  `json:"endian"`     // pcm16 字节序: little (默认) 或 big
+	Format     string  `json:"format"`     // UniMRCP 插件发送的音频格式, 只支持 "pcm" (无封装的原始音频)
+	Channels   int     `json:"channels"`   // 1 (默认) 或 2, 双声道时左右声道相同
+	FrameMs    int     `json:"frame_ms"`   // 每帧音频时长, 默认 20
+	Framing    string  `json:"framing"`    // 二进制帧格式: raw (默认)、headed (带序号与时间戳头) 或 rtp
+	Marks      bool    `json:"marks"`      // 发送词级时间标记
+	FrameMeta  bool    `json:"frame_meta"` // 每帧之前发送 frame_meta 能量信息, 默认关闭
+	Progress   bool    `json:"progress"`   // 每完成 10% 发送 progress 事件, 默认关闭
+	Stream     bool    `json:"stream"`     // 流式合成: 文本段依次排队, 收到 flush 后结束
+	Realtime   *bool   `json:"realtime"`   // 按音频时长实时发送帧, 默认 true; false 时尽快发送
 	SessionID  string  `json:"session_id"`
+	Resume     bool    `json:"resume"` // 断线重连后续传 session_id 未合成完的请求
+
+	// 调试用的发送扰动, 只在 debug_mode 下接受, 用于测试客户端的抖动缓冲; 仅演示引擎支持
+	// JitterMs 实时发送时帧间隔在 frame_ms ± jitter_ms 内随机变化; DropFrameEveryN 每 n 帧丢弃一帧不发送
+	JitterMs        int `json:"jitter_ms"`
+	DropFrameEveryN int `json:"drop_frame_every_n"`
+
+	// NormalizeText 合成前将数字、金额、日期与缩写展开为朗读形式, 未指定时取 normalize_text 配置
+	NormalizeText *bool `json:"normalize_text"`
+
+	// FadeIn 首帧开头淡入; FadeOut 被打断时以淡出的尾音结束, 默认 true; 时长均为 fade_ms
+	FadeIn  bool  `json:"fade_in"`
+	FadeOut *bool `json:"fade_out"`
+
+	// ProtocolVersion 完成、打断、错误等控制消息的格式: 1 (默认, status 字段) 或 2 (type 字段);
+	// 对连接上之后的响应生效, 未指定时沿用之前的版本
+	ProtocolVersion int `json:"protocol_version"`
+
+	// 在合成音频前后补静音 (ms), 避免电话侧放音截掉开头或结尾; 默认 0
+	LeadSilenceMs  int `json:"lead_silence_ms"`
+	TrailSilenceMs int `json:"trail_silence_ms"`
+
+	// PacketizationMs 按 RTP 打包时长输出: 每个二进制帧恰为该时长的采样, 末帧以静音补齐;
+	// 设置后 frame_ms 取相同的值
+	PacketizationMs int `json:"packetization_ms"`
+
+	// ResumeFrame 续传时跳过已发送的帧数, 由服务端设置; 目前仅演示引擎支持, 其他引擎从头合成
+	ResumeFrame int `json:"-"`
+
+	// Segments 拼接播放: 依次合成 text 片段、播放 prompt 录音, 作为一段连续的音频发送; 与 text 互斥
+	Segments []TTSSegment `json:"segments"`
+
+	Entries []LexiconEntry `json:"entries"` // define_lexicon: 发音词典条目
+
+	// Lexicon 连接上定义的发音词典, 由服务端设置并随请求传给引擎
+	Lexicon []LexiconEntry `json:"-"`
+
+	// convert: 之后以二进制消息发送的源音频的采样率, 默认 default_sample_rate;
+	// SourceAudio 为收到 flush 前累积的源音频, 由服务端设置
+	InputSampleRate int    `json:"input_sample_rate"`
+	SourceAudio     []byte `json:"-"`
 }
 
 // ErrorResponse 错误响应结构
 type ErrorResponse struct {
-	Status  string `json:"status"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	Status       string `json:"status"`
+	Code         string `json:"code"`
+	Message      string `json:"message"`
+	RetryAfterMs int64  `json:"retry_after_ms,omitempty"` // RATE_LIMITED 时建议的重试等待时间
+	HTTPStatus   int    `json:"http_status,omitempty"`    // FETCH_ERROR 时远端返回的 HTTP 状态码
+	Field        string `json:"field,omitempty"`          // 消息字段缺失、类型不符或未知时的字段名
+
+	Supported []string `json:"supported,omitempty"` // 未知 action 时列出支持的 action
+}
+
+// ASR 协议状态, strict_asr_protocol 时据此拒绝乱序消息
+const (
+	ASRStateIdle        = "idle"        // 未收到 start 或已收到 end
+	ASRStateRecognizing = "recognizing" // 已收到 start, 正在接收音频
+	ASRStateFinalizing  = "finalizing"  // 已出结果 (超时、no-input、按键结束或自动端点), 等待 end
+)
+
+// 各端点支持的 action
+var (
+	ttsActions = []string{"tts", "stop", "flush", "define_lexicon", "validate", "warmup", "convert"}
+	asrActions = []string{"start", "end", "define_grammar", "activate_grammar", "deactivate_grammar", "dtmf", "recognize_url", "recognize", "cancel", "warmup"}
+)
+
+// unknownActionError 未知 action 的错误响应, 附带支持的 action 列表
+func unknownActionError(action string, supported []string) ErrorResponse {
+	return ErrorResponse{
+		Status:    "error",
+		Code:      "INVALID_REQUEST",
+		Message:   fmt.Sprintf("unknown action '%s'", action),
+		Supported: supported,
+	}
 }
 
 // CompleteResponse 完成响应结构
 type CompleteResponse struct {
+	Status     string `json:"status"`
+	DurationMs int64  `json:"duration_ms"` // 本次发送的音频时长
+	Frames     int    `json:"frames"`      // 本次发送的二进制帧数
+}
+
+// StatusResponse 只有状态的响应, 如 validate 通过时的 valid 与 warmup 完成时的 ready
+type StatusResponse struct {
 	Status string `json:"status"`
 }
 
-// TTSEngine TTS 引擎
-type TTSEngine struct{}
+// ResumedEvent TTS 会话恢复时发送, 之后的音频从第 Frame 帧开始
+type ResumedEvent struct {
+	Type  string `json:"type"` // 固定为 "resumed"
+	Frame int    `json:"frame"`
+}
 
-// Synthesize 合成语音
-func (e *TTSEngine) Synthesize(req TTSRequest, sendFrame func([]byte), onComplete func()) {
-	log.Printf("TTS: text='%s', voice=%s, speed=%.1f, sampleRate=%d",
-		req.Text, req.Voice, req.Speed, req.SampleRate)
+// ASRResumed ASR 会话恢复时发送, Bytes 为已恢复的缓冲音频字节数
+type ASRResumed struct {
+	Status string `json:"status"` // 固定为 "resumed"
+	Bytes  int    `json:"bytes"`
+}
 
-	// 设置默认值
-	if req.SampleRate == 0 {
-		req.SampleRate = 8000
+// AudioStart 首个音频帧之前发送的格式信息
+type AudioStart struct {
+	Type          string `json:"type"` // 固定为 "audio_start"
+	SampleRate    int    `json:"sample_rate"`
+	Encoding      string `json:"encoding"`
+	ByteOrder     string `json:"byte_order,omitempty"` // 仅 pcm16; 键名避开 UniMRCP 插件视为结束的关键字
+	Channels      int    `json:"channels"`
+	BitsPerSample int    `json:"bits_per_sample"`
+	FrameMs       int    `json:"frame_ms"`
+	DurationMs    int64  `json:"duration_ms,omitempty"` // 预计的音频总时长, 流式后端无法预知时省略
+}
+
+// newAudioStart 构建请求对应的格式信息, req 须已应用默认值
+func newAudioStart(req TTSRequest) AudioStart {
+	var byteOrder string
+	if req.Encoding == EncodingPCM16 {
+		byteOrder = req.Endian
 	}
-	if req.Speed == 0 {
-		req.Speed = 1.0
+	return AudioStart{
+		Type:          "audio_start",
+		SampleRate:    req.SampleRate,
+		Encoding:      req.Encoding,
+		ByteOrder:     byteOrder,
+		Channels:      req.Channels,
+		BitsPerSample: bitsPerSample(req.Encoding),
+		FrameMs:       req.FrameMs,
 	}
-	if req.Pitch == 0 {
-		req.Pitch = 1.0
+}
+
+// ttsJob 正在进行的合成任务
+type ttsJob struct {
+	sessionID string
+	cancel    context.CancelFunc
+	done      chan struct{}
+
+	// 流式合成的文本队列, 非流式任务为 nil; flush 后关闭
+	mu      sync.Mutex
+	chunks  chan TTSRequest
+	flushed bool
+	stats   *connStats // 排队深度报告到 /stats
+
+	// 断线续传用: 由合成协程 (frames 由 connWriter 的写协程) 写入, done 关闭且 connWriter 关闭后读取
+	req      TTSRequest
+	frames   int  // 已写出的帧数 (含续传跳过的帧)
+	finished bool // 已合成完成
+}
+
+// stop 取消合成并等待合成协程退出
+func (j *ttsJob) stop() {
+	j.cancel()
+	<-j.done
+}
+
+// enqueue 向流式任务追加文本段, 非流式、已 flush 或已结束的任务返回 false
+//
+// 队列已满时不阻塞读循环, 返回 true 且 full 为 true, 文本段被丢弃, 由客户端在排队的文本合成后重发。
+func (j *ttsJob) enqueue(req TTSRequest) (queued, full bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.chunks == nil || j.flushed {
+		return false, false
 	}
-	if req.Volume == 0 {
-		req.Volume = 1.0
+	select {
+	case <-j.done:
+		return false, false
+	default:
 	}
+	select {
+	case j.chunks <- req:
+		j.stats.queueDepth.Store(int64(len(j.chunks)))
+		return true, false
+	default:
+		return true, true
+	}
+}
 
-	// 演示: 生成简单的正弦波音频
-	// 实际应用中替换为真实 TTS 引擎的输出
-	durationMs := len([]rune(req.Text)) * 200 // 每字符约 200ms
-	samplesPerFrame := req.SampleRate / 50    // 20ms 一帧
-	totalSamples := req.SampleRate * durationMs / 1000
+// flush 结束流式任务的文本输入, 排队的文本合成完后发送完成消息
+func (j *ttsJob) flush() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.chunks == nil || j.flushed {
+		return false
+	}
+	j.flushed = true
+	close(j.chunks)
+	return true
+}
 
-	frequency := 440.0
-	samplesGenerated := 0
-	frameCount := 0
+// next 取下一段排队的文本, 队列已 flush 且取完或任务被取消时返回 false
+func (j *ttsJob) next(ctx context.Context) (TTSRequest, bool) {
+	select {
+	case req, ok := <-j.chunks:
+		j.stats.queueDepth.Store(int64(len(j.chunks)))
+		return req, ok
+	case <-ctx.Done():
+		return TTSRequest{}, false
+	}
+}
 
-	for samplesGenerated < totalSamples {
-		frameSamples := samplesPerFrame
-		if totalSamples-samplesGenerated < frameSamples {
-			frameSamples = totalSamples - samplesGenerated
-		}
+// ASR 控制消息, 每个 action 一种结构, 按 action 分派后解析 (见 handleAs)
 
-		frameBuffer := new(bytes.Buffer)
+// ASRStartControl start: 开始识别
+type ASRStartControl struct {
+	Action     string `json:"action"`
+	SampleRate int    `json:"sample_rate"` // 音频采样率, 默认 8000
+	Codec      string `json:"codec"`       // 输入音频编码, pcm16 (默认)、ulaw、alaw 或 opus
 
-		for i := 0; i < frameSamples; i++ {
-			t := float64(samplesGenerated+i) / float64(req.SampleRate)
-			// 生成正弦波
-			sample := int16(32767 * req.Volume * 0.3 *
-				math.Sin(2*math.Pi*frequency*t*req.Pitch))
+	PartialIntervalMs int `json:"partial_interval_ms"` // 中间结果间隔 (音频时长), 0 表示关闭
 
-			binary.Write(frameBuffer, binary.LittleEndian, sample)
-		}
+	// 服务端端点检测, 尾部静音达到 silence_ms 后自动识别
+	VADEnabled       bool    `json:"vad_enabled"`
+	SilenceThreshold float64 `json:"silence_threshold"` // RMS 静音阈值, 默认 500
+	SilenceMs        int     `json:"silence_ms"`        // 默认 800
 
-		samplesGenerated += frameSamples
-		sendFrame(frameBuffer.Bytes())
-		frameCount++
+	// 识别前将音频整体增益到 agc_target_rms (默认 3276, 约 -20 dBFS)
+	AGC          bool    `json:"agc"`
+	AGCTargetRMS float64 `json:"agc_target_rms"`
 
-		time.Sleep(10 * time.Millisecond)
-	}
+	// 发送 speech_start/speech_end 事件, 中间结果改为 {"type":"partial"} 事件
+	Events bool `json:"events"`
 
-	log.Printf("TTS 完成: 发送 %d 帧", frameCount)
-	onComplete()
+	SessionID string `json:"session_id"` // 会话 ID, 断线重连时用于恢复已缓冲的音频
+
+	// 语种提示 (BCP 47), languages 为混合语种通话的候选列表, 优先于 language;
+	// 均未指定时使用 default_language
+	Language  string   `json:"language"`
+	Languages []string `json:"languages"`
+
+	// DTMF 结束符 (如 "#") 与按键间隔超时, 收到结束符或超时即返回按键结果;
+	// dtmf_detect 开启时同时从音频中检测按键音
+	DTMFTermChar            string `json:"dtmf_term_char"`
+	DTMFInterdigitTimeoutMs int    `json:"dtmf_interdigit_timeout_ms"`
+	DTMFDetect              bool   `json:"dtmf_detect"`
+
+	// 识别开始后 no_input_timeout_ms 内未检测到语音 (RMS 超过 silence_threshold)
+	// 时返回 no-input; 最佳置信度低于 confidence_threshold 时返回 no-match
+	NoInputTimeoutMs    int     `json:"no_input_timeout_ms"`
+	ConfidenceThreshold float64 `json:"confidence_threshold"`
+
+	// 累积音频达到 recognition_timeout_ms 时以 recognition-timeout 结束识别
+	RecognitionTimeoutMs int `json:"recognition_timeout_ms"`
+
+	// 结果格式, nlsml (默认, 直接发送 NLSML 文本) 或 json (ASRResult, 携带完成原因)
+	ResultFormat string `json:"result_format"`
 }
 
-// ASREngine ASR 引擎
-type ASREngine struct{}
+func (ASRStartControl) requiredFields() [][]string { return nil }
 
-// Recognize 识别语音
-func (e *ASREngine) Recognize(audioData []byte, sampleRate int) string {
-	if sampleRate == 0 {
-		sampleRate = 8000
-	}
-	duration := float64(len(audioData)) / float64(sampleRate*2) // 16-bit
-	log.Printf("ASR: received %d bytes, duration=%.2fs", len(audioData), duration)
+// ASREndControl end: 结束音频并返回识别结果
+type ASREndControl struct {
+	Action       string `json:"action"`
+	Alternatives int    `json:"alternatives"` // 返回的候选数, 默认 1
+}
 
-	// 演示: 返回模拟识别结果
-	// 实际应用中替换为真实 ASR 引擎的输出
-	text := "这是一段测试语音"
-	confidence := 0.95
+func (ASREndControl) requiredFields() [][]string { return nil }
 
-	return e.GenerateNLSML(text, confidence)
+// ASRDefineGrammarControl define_grammar: SRGS XML 或逗号/换行分隔的词表, grammar_uri 写入 NLSML;
+// 同时定义多个语法时使用 grammars
+type ASRDefineGrammarControl struct {
+	Action        string        `json:"action"`
+	Grammar       string        `json:"grammar"`
+	GrammarURI    string        `json:"grammar_uri"`
+	GrammarWeight float64       `json:"weight"`
+	Grammars      []GrammarSpec `json:"grammars"`
 }
 
-// GenerateNLSML 生成 NLSML 格式的识别结果
-func (e *ASREngine) GenerateNLSML(text string, confidence float64) string {
-	return fmt.Sprintf(`<?xml version="1.0"?>
-<result>
-  <interpretation grammar="session:request" confidence="%.2f">
-    <instance>%s</instance>
-    <input mode="speech">%s</input>
-  </interpretation>
-</result>`, confidence, text, text)
+func (ASRDefineGrammarControl) requiredFields() [][]string {
+	return [][]string{{"grammar", "grammars"}}
 }
 
-var ttsEngine = &TTSEngine{}
-var asrEngine = &ASREngine{}
+// ASRGrammarControl activate_grammar / deactivate_grammar: 按 grammar_uri 切换语法
+type ASRGrammarControl struct {
+	Action     string `json:"action"`
+	GrammarURI string `json:"grammar_uri"`
+}
 
-// handleTTS 处理 TTS 请求
-func handleTTS(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Printf("WebSocket 升级失败: %v", err)
-		return
-	}
-	defer conn.Close()
+func (ASRGrammarControl) requiredFields() [][]string { return [][]string{{"grammar_uri"}} }
 
-	log.Println("TTS 客户端连接")
+// ASRDTMFControl dtmf: 单个按键
+type ASRDTMFControl struct {
+	Action string `json:"action"`
+	Digit  string `json:"digit"` // 0-9 * # A-D
+}
 
-	var writeMu sync.Mutex
+func (ASRDTMFControl) requiredFields() [][]string { return [][]string{{"digit"}} }
 
-	for {
-		_, message, err := conn.ReadMessage()
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err,
-				websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("TTS 读取错误: %v", err)
-			}
-			break
-		}
+// ASRSubmittedAudio recognize_url / recognize 一次性提交的整段音频的参数
+type ASRSubmittedAudio struct {
+	SampleRate   int    `json:"sample_rate"`  // 音频采样率, 默认 8000
+	Codec        string `json:"codec"`        // 输入音频编码, pcm16 (默认)、ulaw、alaw 或 opus
+	Alternatives int    `json:"alternatives"` // 返回的候选数, 默认 1
+}
 
-		var req TTSRequest
-		if err := json.Unmarshal(message, &req); err != nil {
-			sendJSONError(conn, &writeMu, "INVALID_REQUEST", "JSON parse error")
-			continue
-		}
+// ASRRecognizeURLControl recognize_url: 拉取并识别整段音频
+type ASRRecognizeURLControl struct {
+	Action string `json:"action"`
+	ASRSubmittedAudio
+	URL string `json:"url"` // 待识别音频的地址, 主机须在 fetch_allowed_hosts 中
+}
 
-		log.Printf("TTS 请求: %+v", req)
+func (ASRRecognizeURLControl) requiredFields() [][]string { return [][]string{{"url"}} }
 
-		if req.Action != "tts" {
-			sendJSONError(conn, &writeMu, "INVALID_REQUEST", "Invalid action")
-			continue
-		}
+// ASRRecognizeControl recognize: 识别消息中携带的整段音频
+type ASRRecognizeControl struct {
+	Action string `json:"action"`
+	ASRSubmittedAudio
+	AudioBase64 string `json:"audio_base64"` // base64 编码的整段音频 (PCM 或 WAV 等), 解码后识别
+}
 
-		if req.Text == "" {
-			sendJSONError(conn, &writeMu, "TEXT_EMPTY", "Text is empty")
-			continue
+func (ASRRecognizeControl) requiredFields() [][]string { return [][]string{{"audio_base64"}} }
+
+// ASRActionControl cancel / warmup 等只有 action 的消息
+type ASRActionControl struct {
+	Action string `json:"action"`
+}
+
+func (ASRActionControl) requiredFields() [][]string { return nil }
+
+// PartialResponse 中间识别结果
+type PartialResponse struct {
+	Status string `json:"status"`
+	Text   string `json:"text"`
+}
+
+// ASREvent start 开启 events 时发送的语音起止事件
+type ASREvent struct {
+	Type string `json:"type"` // speech_start 或 speech_end
+}
+
+// ASRPartialEvent start 开启 events 时的中间识别结果
+type ASRPartialEvent struct {
+	Type string `json:"type"` // 固定为 "partial"
+	Text string `json:"text"`
+}
+
+// asrSampleRates ASR 支持的采样率
+var asrSampleRates = []int{8000, 16000, 22050, 44100}
+
+// isSupportedASRSampleRate 判断采样率是否在允许列表中
+func isSupportedASRSampleRate(rate int) bool {
+	for _, r := range asrSampleRates {
+		if r == rate {
+			return true
 		}
+	}
+	return false
+}
 
-		// 合成并发送音频
-		ttsEngine.Synthesize(req,
-			func(frame []byte) {
-				writeMu.Lock()
-				defer writeMu.Unlock()
-				if err := conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
-					log.Printf("发送音频帧失败: %v", err)
-				}
-			},
-			func() {
-				writeMu.Lock()
-				defer writeMu.Unlock()
-				resp := CompleteResponse{Status: "complete"}
-				data, _ := json.Marshal(resp)
-				conn.WriteMessage(websocket.TextMessage, data)
-			},
-		)
+// 演示引擎的默认音色参数
+const (
+	DEFAULT_TONE_FREQUENCY   = 440.0 // 正弦波频率 (Hz)
+	DEFAULT_CHAR_DURATION_MS = 200.0 // 每字符时长 (ms), 按语速缩放
+	DEFAULT_TONE_AMPLITUDE   = 0.3   // 满幅的比例, 再乘以音量
+)
+
+// TTSEngine 演示用 TTS 引擎, 输出正弦波
+//
+// 音色参数为 0 时使用 DEFAULT_* 默认值; 时长模型固定后可精确推算采样数与帧数。
+type TTSEngine struct {
+	// NativeSampleRate 引擎原生生成音频的采样率, 与请求不同时逐帧重采样; 0 表示直接按请求采样率生成
+	NativeSampleRate int
+
+	ToneFrequency  float64 // 正弦波频率 (Hz), 再乘以音调
+	CharDurationMs float64 // 文本每字符的时长 (ms), 再除以语速
+	Amplitude      float64 // 满幅的比例 (0~1), 再乘以音量
+}
+
+// toneFrequency 返回生效的正弦波频率
+func (e *TTSEngine) toneFrequency() float64 {
+	if e.ToneFrequency > 0 {
+		return e.ToneFrequency
 	}
+	return DEFAULT_TONE_FREQUENCY
+}
 
-	log.Println("TTS 客户端断开")
+// charDurationMs 返回生效的每字符时长
+func (e *TTSEngine) charDurationMs() float64 {
+	if e.CharDurationMs > 0 {
+		return e.CharDurationMs
+	}
+	return DEFAULT_CHAR_DURATION_MS
 }
 
-// handleASR 处理 ASR 请求
-func handleASR(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Printf("WebSocket 升级失败: %v", err)
-		return
+// amplitude 返回生效的振幅比例
+func (e *TTSEngine) amplitude() float64 {
+	if e.Amplitude > 0 {
+		return e.Amplitude
 	}
-	defer conn.Close()
+	return DEFAULT_TONE_AMPLITUDE
+}
 
-	log.Println("ASR 客户端连接")
+// nativeRate 返回本次合成实际生成音频的采样率, 须为音色支持的采样率
+func (e *TTSEngine) nativeRate(req TTSRequest) int {
+	rate := req.SampleRate
+	if e.NativeSampleRate > 0 {
+		rate = e.NativeSampleRate
+	}
+	return voiceSampleRate(req.Voice, rate)
+}
 
-	var audioBuffer bytes.Buffer
-	var bufferMu sync.Mutex
-	var writeMu sync.Mutex
+// Warmup 演示引擎无需加载模型
+func (e *TTSEngine) Warmup() error {
+	return nil
+}
 
-	for {
-		messageType, message, err := conn.ReadMessage()
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err,
-				websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("ASR 读取错误: %v", err)
-			}
-			break
-		}
+// Synthesize 合成语音
+func (e *TTSEngine) Synthesize(req TTSRequest, sendFrame func([]byte), onComplete func()) {
+	if e.SynthesizeContext(context.Background(), req, sendFrame, nil) == nil {
+		onComplete()
+	}
+}
 
-		if messageType == websocket.BinaryMessage {
-			// 音频数据
-			bufferMu.Lock()
-			audioBuffer.Write(message)
-			bufferMu.Unlock()
-			log.Printf("ASR 收到音频: %d bytes", len(message))
+// SynthesizeContext 合成语音, ctx 取消时在帧间中止并返回 ctx.Err()
+//
+// sendEvent 接收需以 JSON 文本消息发送的事件 (如 WordMark), 可为 nil。
+// 帧缓冲会被复用, sendFrame 返回后不得再持有 frame, 需要保留时应复制。
+func (e *TTSEngine) SynthesizeContext(ctx context.Context, req TTSRequest,
+	sendFrame func([]byte), sendEvent func(interface{})) error {
+	if len(req.Segments) > 0 {
+		return e.synthesizeSegments(ctx, req, sendFrame, sendEvent)
+	}
+	if isSSML(req.Text) {
+		return e.synthesizeSSML(ctx, req, sendFrame, sendEvent)
+	}
 
-		} else if messageType == websocket.TextMessage {
-			// 控制消息
-			var control map[string]string
-			if err := json.Unmarshal(message, &control); err == nil {
-				if control["action"] == "end" {
-					bufferMu.Lock()
-					audioData := audioBuffer.Bytes()
-					audioBuffer.Reset()
-					bufferMu.Unlock()
+	loggerFrom(ctx).Info("TTS 合成", "text", req.Text, "voice", req.Voice,
+		"speed", req.Speed, "sample_rate", req.SampleRate)
 
-					if len(audioData) > 0 {
-						result := asrEngine.Recognize(audioData, 8000)
-						writeMu.Lock()
-						conn.WriteMessage(websocket.TextMessage, []byte(result))
-						writeMu.Unlock()
-					}
-				}
+	applyTTSDefaults(&req, configFrom(ctx))
+	segments := plainSegments(req)
+	applyLexicon(segments, req.Lexicon)
+	return e.render(ctx, segments, req, sendFrame, sendEvent)
+}
+
+// SynthesizeSSML 合成 SSML 标记文本
+//
+// SSML 解析失败时记录警告并退回纯文本模式。
+func (e *TTSEngine) SynthesizeSSML(req TTSRequest, sendFrame func([]byte), onComplete func()) {
+	if e.synthesizeSSML(context.Background(), req, sendFrame, nil) == nil {
+		onComplete()
+	}
+}
+
+func (e *TTSEngine) synthesizeSSML(ctx context.Context, req TTSRequest,
+	sendFrame func([]byte), sendEvent func(interface{})) error {
+	logger := loggerFrom(ctx)
+	logger.Info("TTS 合成 (SSML)", "text", req.Text, "voice", req.Voice,
+		"speed", req.Speed, "sample_rate", req.SampleRate)
+
+	applyTTSDefaults(&req, configFrom(ctx))
+	segments, err := parseSSML(req.Text, req.Speed, req.Pitch, req.Volume)
+	if err != nil {
+		logger.Warn("SSML 解析失败, 按纯文本合成", "error", err)
+		segments = plainSegments(req)
+	}
+	applyLexicon(segments, req.Lexicon)
+
+	return e.render(ctx, segments, req, sendFrame, sendEvent)
+}
+
+// synthesizeSegments 拼接播放: 按顺序合成 text 片段 (可为 SSML) 并插入 prompt 录音
+//
+// 录音重采样为引擎原生采样率后与合成的采样一起分帧, 帧边界、编码、标记与进度对整段音频连续计算。
+func (e *TTSEngine) synthesizeSegments(ctx context.Context, req TTSRequest,
+	sendFrame func([]byte), sendEvent func(interface{})) error {
+	logger := loggerFrom(ctx)
+	logger.Info("TTS 合成 (拼接)", "segments", len(req.Segments), "voice", req.Voice,
+		"speed", req.Speed, "sample_rate", req.SampleRate)
+
+	cfg := configFrom(ctx)
+	applyTTSDefaults(&req, cfg)
+	sampleRate := e.nativeRate(req)
+	var segments []ssmlSegment
+	for _, s := range req.Segments {
+		if s.Prompt != "" {
+			samples, rate, err := loadPrompt(cfg.PromptDir, s.Prompt)
+			if err != nil {
+				logger.Warn("读取录音失败", "prompt", s.Prompt, "error", err)
+				return err
+			}
+			segments = append(segments, ssmlSegment{Audio: resample(samples, rate, sampleRate)})
+			continue
+		}
+		part := req
+		part.Text = s.Text
+		parsed := plainSegments(part)
+		if isSSML(s.Text) {
+			var err error
+			if parsed, err = parseSSML(s.Text, req.Speed, req.Pitch, req.Volume); err != nil {
+				logger.Warn("SSML 解析失败, 按纯文本合成", "error", err)
+				parsed = plainSegments(part)
 			}
 		}
+		segments = append(segments, parsed...)
 	}
+	applyLexicon(segments, req.Lexicon)
 
-	// 处理剩余音频
-	bufferMu.Lock()
-	audioData := audioBuffer.Bytes()
-	bufferMu.Unlock()
+	return e.render(ctx, segments, req, sendFrame, sendEvent)
+}
 
-	if len(audioData) > 0 {
-		result := asrEngine.Recognize(audioData, 8000)
-		log.Printf("ASR 结果 (连接已关闭): %s", result)
+// applyTTSDefaults 按配置 c 设置默认值
+func applyTTSDefaults(req *TTSRequest, c *Config) {
+	if isDefaultVoice(req.Voice) {
+		req.Voice = c.DefaultVoice
+	}
+	if req.SampleRate == 0 {
+		req.SampleRate = c.DefaultSampleRate
+	}
+	if req.Speed == 0 {
+		req.Speed = 1.0
+	}
+	if req.Pitch == 0 {
+		req.Pitch = 1.0
+	}
+	if req.Volume == 0 {
+		req.Volume = 1.0
+	}
+	if req.Encoding == "" {
+		req.Encoding = EncodingPCM16
+	}
+	if req.Endian == "" {
+		req.Endian = EndianLittle
+	}
+	if req.Channels == 0 {
+		req.Channels = 1
+	}
+	if req.FrameMs == 0 {
+		req.FrameMs = req.PacketizationMs
 	}
+	if req.FrameMs == 0 {
+		req.FrameMs = DEFAULT_FRAME_MS
+	}
+}
+
+// TTS 参数允许范围, 0 表示未设置并使用默认值 1.0
+const (
+	MIN_SPEED  = 0.5
+	MAX_SPEED  = 2.0
+	MIN_PITCH  = 0.5
+	MAX_PITCH  = 2.0
+	MIN_VOLUME = 0.0
+	MAX_VOLUME = 1.0
+)
+
+// 帧时长 (ms) 允许范围与默认值
+const (
+	MIN_FRAME_MS     = 5
+	MAX_FRAME_MS     = 100
+	DEFAULT_FRAME_MS = 20
+)
 
-	log.Println("ASR 客户端断开")
+// TTS 请求 sample_rate 的允许范围, 音色不支持的采样率按 voice_sample_rate_policy 处理
+const (
+	MIN_SAMPLE_RATE = 8000
+	MAX_SAMPLE_RATE = 48000
+)
+
+// MAX_SILENCE_MS lead_silence_ms / trail_silence_ms 的上限
+const MAX_SILENCE_MS = 5000
+
+// validateTTSRequest 按配置 cfg 校验合成请求, WebSocket 与 HTTP 接口共用, 通过时返回 nil
+//
+// 只读取 req 与 cfg, 不访问连接状态; action 由调用方分派。
+func validateTTSRequest(req TTSRequest, cfg Config) *ErrorResponse {
+	if req.Action == "convert" {
+		if errResp := checkConvertRequest(req); errResp != nil {
+			return errResp
+		}
+	} else if len(req.Segments) > 0 {
+		if errResp := checkSegments(req, &cfg); errResp != nil {
+			return errResp
+		}
+	} else if isBlankText(req.Text) {
+		return &ErrorResponse{Status: "error", Code: "TEXT_EMPTY", Message: "Text is empty"}
+	}
+	if cfg.MaxTextRunes > 0 {
+		// 按字符计数, 与时长估算一致
+		if n := textRunes(req); n > cfg.MaxTextRunes {
+			return &ErrorResponse{
+				Status:  "error",
+				Code:    "TEXT_TOO_LONG",
+				Message: fmt.Sprintf("Text exceeds %d characters (got %d)", cfg.MaxTextRunes, n),
+			}
+		}
+	}
+	if req.Encoding != "" && !isSupportedEncoding(req.Encoding) {
+		return &ErrorResponse{
+			Status:  "error",
+			Code:    "UNSUPPORTED_ENCODING",
+			Message: fmt.Sprintf("Unsupported encoding '%s'", req.Encoding),
+		}
+	}
+	if req.Endian != "" && !isSupportedEndian(req.Endian) {
+		return &ErrorResponse{
+			Status:  "error",
+			Code:    "INVALID_REQUEST",
+			Message: fmt.Sprintf("Unsupported endian '%s'", req.Endian),
+		}
+	}
+	if req.Format != "" && req.Format != FormatPCM {
+		return &ErrorResponse{
+			Status:  "error",
+			Code:    "INVALID_REQUEST",
+			Message: fmt.Sprintf("Unsupported format '%s'", req.Format),
+			Field:   "format",
+		}
+	}
+	if !isDefaultVoice(req.Voice) {
+		if _, ok := lookupVoice(req.Voice); !ok {
+			return &ErrorResponse{
+				Status:  "error",
+				Code:    "VOICE_NOT_FOUND",
+				Message: fmt.Sprintf("Voice '%s' not found", req.Voice),
+			}
+		}
+	}
+	if cfg.VoiceSampleRatePolicy == SampleRatePolicyStrict {
+		id, rate := req.Voice, req.SampleRate
+		if isDefaultVoice(id) {
+			id = cfg.DefaultVoice
+		}
+		if rate == 0 {
+			rate = cfg.DefaultSampleRate
+		}
+		if v, ok := lookupVoice(id); ok && !v.supportsSampleRate(rate) {
+			return &ErrorResponse{
+				Status:  "error",
+				Code:    "SAMPLE_RATE_UNSUPPORTED_FOR_VOICE",
+				Message: fmt.Sprintf("Voice '%s' does not support sample rate %d (supported: %v)", id, rate, v.SampleRates),
+			}
+		}
+	}
+	if !isSupportedFraming(req.Framing) {
+		return &ErrorResponse{
+			Status:  "error",
+			Code:    "INVALID_REQUEST",
+			Message: fmt.Sprintf("Unsupported framing '%s'", req.Framing),
+		}
+	}
+	if errResp := checkDebugTiming(req, &cfg); errResp != nil {
+		return errResp
+	}
+	return checkTTSParams(req, &cfg)
 }
 
-func sendJSONError(conn *websocket.Conn, mu *sync.Mutex, code, message string) {
-	mu.Lock()
-	defer mu.Unlock()
-	resp := ErrorResponse{
-		Status:  "error",
-		Code:    code,
-		Message: message,
+// isBlankText 判断文本是否实际为空: 只含空白、控制字符或零宽字符 (如 U+200B、U+FEFF) 时没有可合成的内容
+func isBlankText(text string) bool {
+	for _, r := range text {
+		if !unicode.IsSpace(r) && !unicode.IsControl(r) && !unicode.Is(unicode.Cf, r) {
+			return false
+		}
 	}
-	data, _ := json.Marshal(resp)
-	conn.WriteMessage(websocket.TextMessage, data)
+	return true
 }
 
-func main() {
-	addr := fmt.Sprintf("%s:%d", HOST, PORT)
+// checkTTSParams 校验 speed/pitch/volume 范围与声道数, 通过时返回 nil
+func checkTTSParams(req TTSRequest, c *Config) *ErrorResponse {
+	params := []struct {
+		name     string
+		value    float64
+		min, max float64
+	}{
+		{"speed", req.Speed, MIN_SPEED, MAX_SPEED},
+		{"pitch", req.Pitch, MIN_PITCH, MAX_PITCH},
+		{"volume", req.Volume, MIN_VOLUME, MAX_VOLUME},
+		{"sample_rate", float64(req.SampleRate), MIN_SAMPLE_RATE, MAX_SAMPLE_RATE},
+		{"frame_ms", float64(req.FrameMs), MIN_FRAME_MS, MAX_FRAME_MS},
+		{"lead_silence_ms", float64(req.LeadSilenceMs), 0, MAX_SILENCE_MS},
+		{"trail_silence_ms", float64(req.TrailSilenceMs), 0, MAX_SILENCE_MS},
+		{"packetization_ms", float64(req.PacketizationMs), MIN_FRAME_MS, MAX_FRAME_MS},
+	}
+	for _, p := range params {
+		if p.value == 0 {
+			continue
+		}
+		if p.value < p.min || p.value > p.max || math.IsNaN(p.value) {
+			return &ErrorResponse{
+				Status: "error",
+				Code:   "PARAMETER_OUT_OF_RANGE",
+				Message: fmt.Sprintf("%s %g out of range [%g, %g]",
+					p.name, p.value, p.min, p.max),
+			}
+		}
+	}
+	if req.Channels != 0 && req.Channels != 1 && req.Channels != 2 {
+		return &ErrorResponse{
+			Status:  "error",
+			Code:    "PARAMETER_OUT_OF_RANGE",
+			Message: fmt.Sprintf("channels %d must be 1 or 2", req.Channels),
+		}
+	}
+	if req.PacketizationMs != 0 {
+		if req.FrameMs != 0 && req.FrameMs != req.PacketizationMs {
+			return &ErrorResponse{
+				Status:  "error",
+				Code:    "INVALID_REQUEST",
+				Message: "frame_ms conflicts with packetization_ms",
+			}
+		}
+		sampleRate := req.SampleRate
+		if sampleRate == 0 {
+			sampleRate = c.DefaultSampleRate
+		}
+		if sampleRate*req.PacketizationMs%1000 != 0 {
+			return &ErrorResponse{
+				Status: "error",
+				Code:   "PARAMETER_OUT_OF_RANGE",
+				Message: fmt.Sprintf("packetization_ms %d is not a whole number of samples at %d Hz",
+					req.PacketizationMs, sampleRate),
+			}
+		}
+	}
+	return nil
+}
+
+// plainSegments 将整段文本作为单个片段
+func plainSegments(req TTSRequest) []ssmlSegment {
+	return []ssmlSegment{{
+		Text:   req.Text,
+		Speed:  req.Speed,
+		Pitch:  req.Pitch,
+		Volume: req.Volume,
+	}}
+}
+
+// padSilence 按 lead_silence_ms / trail_silence_ms 在片段前后加停顿片段
+//
+// 静音与文本一样计入时长、进度与标记偏移, 并按 frame_ms 与前后的音频拼成完整的帧。
+func padSilence(segments []ssmlSegment, req TTSRequest) []ssmlSegment {
+	if req.LeadSilenceMs <= 0 && req.TrailSilenceMs <= 0 {
+		return segments
+	}
+	padded := make([]ssmlSegment, 0, len(segments)+2)
+	if req.LeadSilenceMs > 0 {
+		padded = append(padded, ssmlSegment{BreakMs: req.LeadSilenceMs})
+	}
+	padded = append(padded, segments...)
+	if req.TrailSilenceMs > 0 {
+		padded = append(padded, ssmlSegment{BreakMs: req.TrailSilenceMs})
+	}
+	return padded
+}
+
+// segmentSamples 片段的采样数: 文本每字符 CharDurationMs (按语速缩放), 停顿按时长
+func (e *TTSEngine) segmentSamples(seg ssmlSegment, sampleRate int) int {
+	if seg.Audio != nil {
+		return len(seg.Audio)
+	}
+	var durationMs float64
+	if seg.Text != "" {
+		durationMs = float64(len([]rune(seg.Text))) * e.charDurationMs() / seg.Speed
+	} else {
+		durationMs = float64(seg.BreakMs)
+	}
+	return int(float64(sampleRate) * durationMs / 1000)
+}
+
+// speechMarks 按演示时长模型计算 SSML 标记与 (words 时) 各词的起始采样偏移, 按文档顺序排列
+func (e *TTSEngine) speechMarks(segments []ssmlSegment, sampleRate int, words bool) []pendingMark {
+	var marks []pendingMark
+	offset := 0
+	for _, seg := range segments {
+		if seg.Mark != "" {
+			marks = append(marks, pendingMark{sample: offset, event: SSMLMark{
+				Type:     "mark",
+				Name:     seg.Mark,
+				OffsetMs: offset * 1000 / sampleRate,
+			}})
+		}
+		n := e.segmentSamples(seg, sampleRate)
+		if runes := len([]rune(seg.Text)); runes > 0 && words {
+			for _, w := range splitWords(seg.Text) {
+				sample := offset + n*w.index/runes
+				marks = append(marks, pendingMark{sample: sample, event: WordMark{
+					Type:     "mark",
+					Word:     w.word,
+					OffsetMs: sample * 1000 / sampleRate,
+				}})
+			}
+		}
+		offset += n
+	}
+	return marks
+}
+
+// render 按片段生成音频, 以 req.FrameMs 为一帧按请求的编码发送, 末尾不足一帧的采样单独成帧
+//
+// 音频按引擎原生采样率生成, 与 req.SampleRate 不同时每帧重采样后再编码。
+// 每帧之间检查 ctx, 取消后不再发送并返回 ctx.Err()。
+// SSML 的 <mark> 与 (req.Marks 时) 每个 WordMark 在包含其起始位置的帧之前发送;
+// req.FrameMeta 时, 每帧的 FrameMeta 紧接在该帧之前发送 (位于标记之后);
+// req.Progress 时, 进度每越过 PROGRESS_STEP_PERCENT 在该帧之后发送一次 ProgressEvent。
+func (e *TTSEngine) render(ctx context.Context, segments []ssmlSegment, req TTSRequest,
+	sendFrame func([]byte), sendEvent func(interface{})) error {
+	cfg := configFrom(ctx)
+	sampleRate := e.nativeRate(req)
+	segments = padSilence(segments, req)
+	// 演示: 生成简单的正弦波音频
+	// 实际应用中替换为真实 TTS 引擎的输出
+	samplesPerFrame := sampleRate * req.FrameMs / 1000
+	frequency := e.toneFrequency()
+	amplitude := e.amplitude()
+	samplesGenerated := 0
+	samplesSent := 0
+	frameCount := 0
+
+	var marks []pendingMark
+	if sendEvent != nil {
+		marks = e.speechMarks(segments, sampleRate, req.Marks)
+	}
+
+	// 进度按已发送的采样数计算, totalSamples 为 0 时不发送
+	totalSamples := 0
+	for _, seg := range segments {
+		totalSamples += e.segmentSamples(seg, sampleRate)
+	}
+	progress := req.Progress && sendEvent != nil && totalSamples > 0
+	nextPercent := PROGRESS_STEP_PERCENT
+
+	start := time.Now()
+	defer func() {
+		synthesisDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	if cfg.AudioStart && sendEvent != nil {
+		start := newAudioStart(req)
+		start.DurationMs = int64(totalSamples) * 1000 / int64(sampleRate)
+		sendEvent(start)
+	}
+
+	// 实时模式下按帧时长的 Ticker 发送, 不累积 Sleep 误差;
+	// 设置 jitter_ms 时改为每帧随机等待, 间隔在 frame_ms ± jitter_ms 内变化
+	var ticker *time.Ticker
+	var jitter time.Duration
+	frameDuration := time.Duration(req.FrameMs) * time.Millisecond
+	if req.Realtime == nil || *req.Realtime {
+		if req.JitterMs > 0 {
+			jitter = time.Duration(req.JitterMs) * time.Millisecond
+		} else {
+			ticker = time.NewTicker(frameDuration)
+			defer ticker.Stop()
+		}
+	}
+
+	frame := make([]int16, 0, samplesPerFrame)
+	var resampled []int16 // 重采样时复用的缓冲
+	var stereo []int16    // 双声道时复用的交错缓冲
+	fadeSamples := sampleRate * cfg.FadeMs / 1000
+	// toRequestRate 将原生采样率的采样重采样为请求的采样率
+	toRequestRate := func(samples []int16) []int16 {
+		if sampleRate == req.SampleRate {
+			return samples
+		}
+		resampled = appendResampled(resampled[:0], samples, sampleRate, req.SampleRate)
+		return resampled
+	}
+	// emitFrame 按声道数与编码转换后发送
+	emitFrame := func(out []int16) {
+		if req.Channels == 2 {
+			stereo = interleaveStereo(stereo[:0], out)
+			out = stereo
+		}
+		// sendFrame 同步写出或复制后才归还缓冲
+		bufp := framePool.Get().(*[]byte)
+		data := appendEncoded((*bufp)[:0], out, req.Encoding, req.Endian)
+		sendFrame(data)
+		audioBytesSent.Add(float64(len(data)))
+		*bufp = data
+		framePool.Put(bufp)
+	}
+	flush := func() error {
+		frameEnd := samplesSent + len(frame)
+		if frameCount < req.ResumeFrame {
+			// 续传: 跳过客户端已收到的帧, 不等待也不发送标记
+			for len(marks) > 0 && marks[0].sample < frameEnd {
+				marks = marks[1:]
+			}
+			samplesSent = frameEnd
+			frame = frame[:0]
+			frameCount++
+			return ctx.Err()
+		}
+		if ticker != nil && frameCount > req.ResumeFrame {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+			}
+		} else if jitter > 0 && frameCount > req.ResumeFrame {
+			timer := time.NewTimer(jitteredInterval(frameDuration, jitter))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			// 打断时以 fade_ms 长的淡出尾音代替本帧, 接续已发出的音频, 避免突然截断产生爆音
+			if fadeSamples > 0 && req.fadeOutEnabled() && frameCount > req.ResumeFrame && len(frame) > 0 {
+				tail := frame
+				if len(tail) > fadeSamples {
+					tail = tail[:fadeSamples]
+				}
+				applyFade(tail, false, true, fadeSamples)
+				emitFrame(toRequestRate(tail))
+			}
+			loggerFrom(ctx).Info("TTS 中止", "frames", frameCount)
+			return err
+		}
+		for len(marks) > 0 && marks[0].sample < frameEnd {
+			sendEvent(marks[0].event)
+			marks = marks[1:]
+		}
+		if req.FadeIn && frameCount == 0 {
+			applyFade(frame, true, false, fadeSamples)
+		}
+		out := toRequestRate(frame)
+		if req.FrameMeta && sendEvent != nil {
+			sendEvent(newFrameMeta(frameCount, out))
+		}
+
+		if dropFrame(req, frameCount) {
+			// drop_frame_every_n: 丢弃的帧照常占用发送间隔, 之后的音频不前移
+			loggerFrom(ctx).Info("TTS 调试: 丢弃帧", "frame", frameCount,
+				"drop_frame_every_n", req.DropFrameEveryN)
+		} else {
+			emitFrame(out)
+		}
+		samplesSent = frameEnd
+		frame = frame[:0]
+		frameCount++
+
+		// 续传跳过的帧不发送进度, 之后的首帧只报告已越过的最高百分比
+		if progress {
+			if percent := samplesSent * 100 / totalSamples; percent >= nextPercent {
+				percent -= percent % PROGRESS_STEP_PERCENT
+				sendEvent(ProgressEvent{Type: "progress", Percent: percent,
+					ElapsedMs: time.Since(start).Milliseconds()})
+				nextPercent = percent + PROGRESS_STEP_PERCENT
+			}
+		}
+		return nil
+	}
+
+	for _, seg := range segments {
+		segSamples := e.segmentSamples(seg, sampleRate)
+		// 演示: 正弦波不区分发音, 真实引擎在此按 seg.Lexicon 的音标合成对应的词
+		for _, entry := range seg.Lexicon {
+			loggerFrom(ctx).Debug("TTS 应用发音词典", "word", entry.Word, "pron", entry.Pron)
+		}
+
+		for i := 0; i < segSamples; i++ {
+			var sample int16
+			if seg.Audio != nil {
+				sample = seg.Audio[i]
+			} else if seg.Text != "" {
+				t := float64(samplesGenerated) / float64(sampleRate)
+				// 生成正弦波
+				v := 32767 * seg.Volume * amplitude * math.Sin(2*math.Pi*frequency*t*seg.Pitch)
+				sample = int16(math.Max(-32768, math.Min(32767, v)))
+			}
+			frame = append(frame, sample)
+			samplesGenerated++
+
+			if len(frame) == samplesPerFrame {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if len(frame) > 0 {
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+	// 位于音频末尾的 SSML 标记没有对应的帧, 在最后一帧之后发送
+	for _, m := range marks {
+		sendEvent(m.event)
+	}
+
+	loggerFrom(ctx).Info("TTS 完成", "frames", frameCount)
+	return nil
+}
+
+// ASREngine 演示用 ASR 引擎, 返回固定的识别结果
+type ASREngine struct{}
+
+// Candidate 识别候选结果
+type Candidate struct {
+	Text       string
+	Confidence float64
+}
+
+// Warmup 演示引擎无需加载模型
+func (e *ASREngine) Warmup() error {
+	return nil
+}
+
+// Recognize 识别语音, 返回最佳结果
+func (e *ASREngine) Recognize(audioData []byte, sampleRate int) (string, error) {
+	return e.RecognizeNBest(audioData, sampleRate, 1)
+}
+
+// RecognizeNBest 识别语音, 返回至多 alternatives 个候选结果
+func (e *ASREngine) RecognizeNBest(audioData []byte, sampleRate int, alternatives int) (string, error) {
+	if sampleRate == 0 {
+		sampleRate = 8000
+	}
+	start := time.Now()
+	defer func() {
+		recognitionLatency.Observe(time.Since(start).Seconds())
+	}()
+
+	return e.GenerateNBestNLSML(e.demoCandidates(), alternatives), nil
+}
+
+// RecognizeWithGrammar 按语法约束识别, 只返回语法允许的最佳结果
+//
+// 没有候选符合语法时返回不含 <interpretation> 的 NLSML。
+func (e *ASREngine) RecognizeWithGrammar(audioData []byte, sampleRate int, grammar *Grammar) (string, error) {
+	return e.RecognizeWithGrammars(audioData, sampleRate, []*Grammar{grammar})
+}
+
+// RecognizeWithGrammars 按多个语法约束识别, 只返回最佳结果
+//
+// 候选按置信度与所命中语法的权重之积排序, 同时命中多个语法时归入权重最高的;
+// NLSML 中的 confidence 仍为引擎给出的置信度。
+func (e *ASREngine) RecognizeWithGrammars(audioData []byte, sampleRate int, grammars []*Grammar) (string, error) {
+	start := time.Now()
+	defer func() {
+		recognitionLatency.Observe(time.Since(start).Seconds())
+	}()
+
+	var best []Candidate
+	bestURI := grammars[0].URI
+	bestScore := 0.0
+	for _, c := range e.demoCandidates() {
+		for _, g := range grammars {
+			if score := c.Confidence * g.Weight; g.matches(c.Text) && (best == nil || score > bestScore) {
+				best, bestURI, bestScore = []Candidate{c}, g.URI, score
+			}
+		}
+	}
+	return e.generateNLSML(best, 1, bestURI), nil
+}
+
+// DetectLanguage 演示: 直接返回首选语种
+//
+// 实际应用中替换为真实引擎的语种识别 (LID) 结果。
+func (e *ASREngine) DetectLanguage(audioData []byte, sampleRate int, languages []string) (string, error) {
+	return languages[0], nil
+}
+
+// demoCandidates 演示: 返回模拟识别结果
+//
+// 实际应用中替换为真实 ASR 引擎的输出。
+func (e *ASREngine) demoCandidates() []Candidate {
+	return []Candidate{
+		{Text: "这是一段测试语音", Confidence: 0.95},
+		{Text: "这是一段测式语音", Confidence: 0.62},
+		{Text: "这是一个测试语音", Confidence: 0.81},
+	}
+}
+
+// DetectSpeechSpan 演示: 把整段音频视为语音
+//
+// 实际应用中替换为引擎给出的语音起止位置 (如解码器的首末词时间)。
+func (e *ASREngine) DetectSpeechSpan(audioData []byte, sampleRate int) (SpeechSpan, error) {
+	if sampleRate == 0 {
+		sampleRate = 8000
+	}
+	return SpeechSpan{StartMs: 0, EndMs: int64(len(audioData)/2) * 1000 / int64(sampleRate)}, nil
+}
+
+// RecognizePartial 对已累积的音频做中间识别, 返回当前文本
+func (e *ASREngine) RecognizePartial(audioData []byte, sampleRate int) (string, error) {
+	if sampleRate == 0 {
+		sampleRate = 8000
+	}
+	duration := float64(len(audioData)) / float64(sampleRate*2) // 16-bit
+
+	// 演示: 按音频时长逐步返回最终文本的前缀 (每 0.5s 一个字)
+	text := []rune("这是一段测试语音")
+	n := int(duration / 0.5)
+	if n > len(text) {
+		n = len(text)
+	}
+	return string(text[:n]), nil
+}
+
+// GenerateNLSML 生成 NLSML 格式的识别结果
+func (e *ASREngine) GenerateNLSML(text string, confidence float64) string {
+	return e.GenerateNBestNLSML([]Candidate{{Text: text, Confidence: confidence}}, 1)
+}
+
+// GenerateNBestNLSML 生成包含多个候选的 NLSML
+//
+// 候选按置信度降序排列, 每个候选对应一个 <interpretation>,
+// maxAlternatives <= 0 时输出全部候选。
+func (e *ASREngine) GenerateNBestNLSML(candidates []Candidate, maxAlternatives int) string {
+	return e.generateNLSML(candidates, maxAlternatives, DEFAULT_GRAMMAR_URI)
+}
+
+// generateNLSML 生成 NLSML, grammarURI 写入每个 <interpretation> 的 grammar 属性
+func (e *ASREngine) generateNLSML(candidates []Candidate, maxAlternatives int, grammarURI string) string {
+	sorted := make([]Candidate, len(candidates))
+	copy(sorted, candidates)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Confidence > sorted[j].Confidence
+	})
+	if maxAlternatives > 0 && len(sorted) > maxAlternatives {
+		sorted = sorted[:maxAlternatives]
+	}
+
+	var b strings.Builder
+	b.WriteString("<?xml version=\"1.0\"?>\n<result>\n")
+	for _, c := range sorted {
+		escaped := xmlEscape(c.Text)
+		fmt.Fprintf(&b, `  <interpretation grammar="%s" confidence="%.2f">
+    <instance>%s</instance>
+    <input mode="speech">%s</input>
+  </interpretation>
+`, xmlEscape(grammarURI), c.Confidence, escaped, escaped)
+	}
+	b.WriteString("</result>")
+	return b.String()
+}
+
+// xmlEscape 转义 XML 特殊字符 (&, <, > 及引号)
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// ttsEngine 当前使用的 TTS 引擎, main 中按配置选择
+var ttsEngine Synthesizer = &TTSEngine{NativeSampleRate: TTS_NATIVE_SAMPLE_RATE}
+
+// asrEngine 当前使用的 ASR 引擎, main 中按配置选择
+var asrEngine Recognizer = &ASREngine{}
+
+var connections = newConnRegistry()
+
+var limiter = newConnLimiter(0, 0)
+
+var ttsRateLimiter = newRateLimiter(0, 0, false)
+
+var sessions = newSessionManager(0)
+
+// handleTTS 处理 TTS 请求
+func handleTTS(w http.ResponseWriter, r *http.Request) {
+	// 连接期间沿用建立时的配置, 重新加载只影响之后的连接
+	cfg := currentConfig()
+	engine := ttsEngineFrom(r.Context())
+	if connections.isClosing() {
+		http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	ip := clientIP(r)
+	user, ok := authenticate(r)
+	if !ok {
+		slog.Warn("TTS 鉴权失败, 拒绝连接", "remote", ip)
+		rejectUnauthorized(w)
+		return
+	}
+	if !acceptsSubprotocol(r, cfg) {
+		slog.Warn("TTS 子协议不受支持, 拒绝连接", "remote", ip,
+			"subprotocols", websocket.Subprotocols(r))
+		rejectSubprotocol(w)
+		return
+	}
+	if !limiter.acquire(ip) {
+		slog.Warn("TTS 连接数超限, 拒绝连接", "remote", ip)
+		rejectBusy(w)
+		return
+	}
+	defer limiter.release(ip)
+
+	connID := newSessionID()
+	logger := slog.With("endpoint", "tts", "conn_id", connID, "remote", ip, "user", user)
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Warn("WebSocket 升级失败", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	stats := newConnStats("tts", connID, ip, user)
+	out := newConnWriter(conn, cfg.SendQueueSize, cfg.SlowConsumerTimeout, stats, logger)
+	defer out.close()
+
+	var jobMu sync.Mutex
+	var job *ttsJob              // 受 jobMu 保护, 仅由读循环修改
+	var framer frameHeaderWriter // headed 帧头, 仅由合成协程使用
+	rtp := newRTPHeaderWriter()  // rtp 帧头, 仅由合成协程使用
+	var lexicon []LexiconEntry   // define_lexicon 定义的发音词典, 仅在读循环中访问
+	rateBucket := ttsRateLimiter.bucket(user)
+	parseErrors := 0               // 连续的 JSON 解析失败次数, 成功解析后清零
+	protocolVersion := PROTOCOL_V1 // 控制消息格式, 仅在读循环中访问
+	var conversion *TTSRequest     // 等待源音频的 convert 请求, 仅在读循环中访问
+
+	// 优雅关闭时等待当前合成完成, 流式任务合成完已排队的文本即结束
+	drain := func() {
+		jobMu.Lock()
+		j := job
+		jobMu.Unlock()
+		if j != nil {
+			j.flush()
+			<-j.done
+		}
+		out.flush()
+	}
+	if !connections.add(conn, stats, drain) {
+		return
+	}
+	defer connections.remove(conn)
+
+	logger.Info("TTS 客户端连接", "compression", setupCompression(conn, r, cfg),
+		"subprotocol", conn.Subprotocol())
+
+	if cfg.MaxMessageSize > 0 {
+		conn.SetReadLimit(cfg.MaxMessageSize)
+	}
+
+	stopKeepAlive := keepAlive(conn)
+	defer stopKeepAlive()
+
+	defer func() {
+		if job == nil {
+			return
+		}
+		job.stop()
+		out.close() // 写协程退出后 job.frames 不再变化
+		// 连接断开时保留未合成完的非流式请求, 重连后可从已发送的帧之后续传; 变声不保留源音频
+		if job.chunks == nil && job.req.Action != "convert" && !job.finished && job.frames > 0 &&
+			sessions.parkTTS(job.sessionID, &ttsSession{user: user, req: job.req, frames: job.frames}) {
+			logger.Info("保留 TTS 会话", "session_id", job.sessionID, "frames", job.frames)
+		}
+	}()
+
+	// startSynthesis 校验并开始合成 (或续传) req, 合成在独立协程中进行, 读循环可继续接收 stop
+	startSynthesis := func(req TTSRequest, reqLogger *slog.Logger) {
+		// 续传断线前未合成完的请求, 沿用原请求参数; 会话不存在时按新请求处理
+		if req.Resume && req.SessionID != "" && !req.Stream {
+			if s, ok := sessions.resumeTTS(req.SessionID, user); ok {
+				reqLogger.Info("恢复 TTS 会话", "frame", s.frames)
+				req = s.req
+				req.ResumeFrame = s.frames
+				req.ProtocolVersion = protocolVersion
+				sendJSON(out, ResumedEvent{Type: "resumed", Frame: s.frames})
+			}
+		}
+
+		if errResp := applyTTSProfile(&req, cfg); errResp != nil {
+			sendTTSError(out, protocolVersion, *errResp)
+			return
+		}
+		if errResp := validateTTSRequest(req, *cfg); errResp != nil {
+			sendTTSError(out, protocolVersion, *errResp)
+			return
+		}
+		// 续传的请求沿用原请求的词典, 其文本也已规范化并计入用量
+		chars := 0
+		if req.ResumeFrame == 0 {
+			req.Lexicon = lexicon
+			chars = textRunes(req) // 按客户端提交的 (规范化前的) 文本计费
+			normalizeTTSRequest(&req, cfg)
+		}
+
+		// 超出速率的请求不交给引擎, 由客户端按 retry_after_ms 重试
+		if rateBucket != nil {
+			if ok, wait := rateBucket.take(); !ok {
+				reqLogger.Warn("TTS 请求超出速率限制", "retry_after", wait)
+				sendTTSError(out, protocolVersion, ErrorResponse{
+					Status:       "error",
+					Code:         "RATE_LIMITED",
+					Message:      "Too many TTS requests",
+					RetryAfterMs: wait.Milliseconds() + 1,
+				})
+				return
+			}
+		}
+
+		if !stats.chargeChars(chars, cfg.QuotaMonthlyChars) {
+			reqLogger.Warn("TTS 超出每月字符额度", "chars", chars, "quota", cfg.QuotaMonthlyChars)
+			sendTTSError(out, protocolVersion, quotaExceeded("character"))
+			return
+		}
+
+		// 流式文本段追加到进行中的流式任务, 按到达顺序合成
+		if req.Stream && job != nil {
+			if queued, full := job.enqueue(req); full {
+				stats.refundChars(chars)
+				reqLogger.Warn("TTS 流式队列已满", "queue_size", cfg.StreamQueueSize)
+				sendTTSError(out, protocolVersion, ErrorResponse{Code: "QUEUE_FULL",
+					Message: fmt.Sprintf("Stream queue full (%d chunks)", cfg.StreamQueueSize)})
+				return
+			} else if queued {
+				return
+			}
+		}
+
+		ttsRequestsTotal.Inc()
+
+		// 关闭过程中不再开始新的合成
+		if connections.isClosing() {
+			reqLogger.Info("服务器正在关闭, 忽略 TTS 请求")
+			return
+		}
+
+		// 新请求打断尚未完成的合成
+		if job != nil {
+			job.stop()
+		}
+
+		// 在独立协程中合成并发送音频, 读循环可继续接收 stop
+		ctx, cancel := context.WithCancel(withConfig(withLogger(context.Background(), reqLogger), cfg))
+		newJob := &ttsJob{sessionID: req.SessionID, cancel: cancel, done: make(chan struct{}),
+			req: req, frames: req.ResumeFrame, stats: stats}
+		if req.Stream {
+			newJob.chunks = make(chan TTSRequest, cfg.StreamQueueSize)
+			newJob.chunks <- req
+			stats.queueDepth.Store(1)
+		}
+		jobMu.Lock()
+		job = newJob
+		jobMu.Unlock()
+		go func(req TTSRequest, j *ttsJob) {
+			defer close(j.done)
+			defer stats.queueDepth.Store(0)
+			defer cancel()
+			// 下一个任务在 done 关闭后才开始, 不会被此处覆盖
+			stats.setState(StateSynthesizing)
+			defer stats.setState(StateIdle)
+
+			frameMs := req.FrameMs
+			if frameMs == 0 {
+				frameMs = DEFAULT_FRAME_MS
+			}
+			framer.reset(req.ResumeFrame * frameMs)
+
+			// emit 加上帧头后发送; 写协程写出后计数, 断线续传从客户端可能已收到的帧之后开始
+			var emit func(frame []byte)
+			// packetization_ms 时按负载重新切分, 流式任务只在全部文本合成完后补齐末帧
+			pk := newPacketizer(req, cfg)
+			// 本次发送的帧数与音频时长 (不含帧头), 随结束消息返回
+			sentFrames := 0
+			sentMs := 0.0
+
+			synthesize := func(req TTSRequest) error {
+				sctx, scancel := withSynthesisTimeout(ctx, engine, req)
+				defer scancel()
+				var wrap func(payload []byte) []byte
+				switch req.Framing {
+				case FramingHeaded:
+					framer.setFormat(req, cfg)
+					wrap = framer.wrap
+				case FramingRTP:
+					rtp.setFormat(req, cfg)
+					wrap = rtp.wrap
+				}
+				bytesPerMs := audioBytesPerMs(req, cfg)
+				emit = func(frame []byte) {
+					sentFrames++
+					sentMs += float64(len(frame)) / bytesPerMs
+					if wrap != nil {
+						frame = wrap(frame)
+					}
+					out.sendFrame(ctx, frame, func() { j.frames++ })
+				}
+				sendFrame := func(frame []byte) {
+					if pk != nil {
+						pk.write(frame, emit)
+						return
+					}
+					emit(frame)
+				}
+				sendEvent := func(event interface{}) {
+					sendJSON(out, event)
+				}
+				if req.Action == "convert" {
+					return timeoutCause(sctx, runVoiceConverter(sctx, engine, req, sendFrame, sendEvent))
+				}
+				return timeoutCause(sctx, runSynthesizer(sctx, engine, req, sendFrame, sendEvent))
+			}
+
+			var err error
+			if j.chunks == nil {
+				err = synthesize(req)
+			} else {
+				// 逐段合成, 上一段的帧全部发出后才开始下一段
+				for err == nil {
+					chunk, ok := j.next(ctx)
+					if !ok {
+						err = ctx.Err()
+						break
+					}
+					err = synthesize(chunk)
+				}
+			}
+
+			if err == nil && pk != nil {
+				pk.flush(emit)
+			}
+			j.finished = err == nil
+
+			if errResp := synthesisError(err, cfg); errResp != nil {
+				reqLogger.Warn("TTS 合成失败", "code", errResp.Code, "error", err)
+				sendTTSError(out, req.ProtocolVersion, *errResp)
+				return
+			}
+
+			status := "complete"
+			if err != nil {
+				status = "interrupted"
+			}
+			sendJSON(out, ttsCompleteMessage(req.ProtocolVersion, status, int64(math.Round(sentMs)), sentFrames))
+		}(req, newJob)
+	}
+
+	// ttsHandlers 各 action 的处理函数, tts 与变声均由 startSynthesis 开始合成
+	ttsHandlers := map[string]func(req TTSRequest, reqLogger *slog.Logger){
+		"tts": startSynthesis,
+		"stop": func(req TTSRequest, reqLogger *slog.Logger) {
+			// 打断当前合成, 由合成协程发送 interrupted
+			if job != nil && (req.SessionID == "" || req.SessionID == job.sessionID) {
+				job.stop()
+				jobMu.Lock()
+				job = nil
+				jobMu.Unlock()
+			}
+		},
+		"flush": func(req TTSRequest, reqLogger *slog.Logger) {
+			if conversion != nil {
+				// 源音频接收完毕, 按 convert 请求开始转换
+				req, conversion = *conversion, nil
+				if len(req.SourceAudio) == 0 {
+					sendTTSError(out, protocolVersion, ErrorResponse{Code: "INVALID_REQUEST",
+						Message: "No audio to convert"})
+					return
+				}
+				startSynthesis(req, reqLogger)
+				return
+			}
+			if job == nil || !job.flush() {
+				sendTTSError(out, protocolVersion, ErrorResponse{Code: "INVALID_REQUEST",
+					Message: "No streaming synthesis to flush"})
+			}
+		},
+		"define_lexicon": func(req TTSRequest, reqLogger *slog.Logger) {
+			// 替换连接上的词典, 对之后的请求生效
+			entries, err := parseLexicon(req.Entries)
+			if err != nil {
+				sendTTSError(out, protocolVersion, ErrorResponse{Code: "LEXICON_ERROR",
+					Message: fmt.Sprintf("Lexicon error: %v", err)})
+				return
+			}
+			lexicon = entries
+			reqLogger.Info("TTS 定义发音词典", "entries", len(lexicon))
+		},
+		"validate": func(req TTSRequest, reqLogger *slog.Logger) {
+			// 与 tts 相同的校验, 不合成、不计入速率限制
+			errResp := applyTTSProfile(&req, cfg)
+			if errResp == nil {
+				errResp = validateTTSRequest(req, *cfg)
+			}
+			if errResp != nil {
+				sendTTSError(out, protocolVersion, *errResp)
+				return
+			}
+			sendJSON(out, ttsStatusMessage(protocolVersion, "valid"))
+		},
+		"warmup": func(req TTSRequest, reqLogger *slog.Logger) {
+			// 在首个请求前加载模型, 预热期间读循环阻塞
+			if err := warmupEngine(engine); err != nil {
+				reqLogger.Warn("TTS 引擎预热失败", "error", err)
+				sendTTSError(out, protocolVersion, ErrorResponse{Code: "WARMUP_FAILED",
+					Message: fmt.Sprintf("Warmup failed: %v", err)})
+				return
+			}
+			sendJSON(out, ttsStatusMessage(protocolVersion, "ready"))
+		},
+		"convert": func(req TTSRequest, reqLogger *slog.Logger) {
+			if _, ok := voiceConverterOf(engine); !ok {
+				sendTTSError(out, protocolVersion, ErrorResponse{Code: "INVALID_REQUEST",
+					Message: fmt.Sprintf("Voice conversion not supported by tts_engine '%s'", cfg.TTSEngine)})
+				return
+			}
+			if req.InputSampleRate == 0 {
+				req.InputSampleRate = cfg.DefaultSampleRate
+			}
+			errResp := applyTTSProfile(&req, cfg)
+			if errResp == nil {
+				errResp = validateTTSRequest(req, *cfg)
+			}
+			if errResp != nil {
+				sendTTSError(out, protocolVersion, *errResp)
+				return
+			}
+			// 与新的 tts 请求一样打断尚未完成的合成
+			if job != nil {
+				job.stop()
+				jobMu.Lock()
+				job = nil
+				jobMu.Unlock()
+			}
+			conversion = &req
+			reqLogger.Info("TTS 变声: 等待源音频", "voice", req.Voice, "input_sample_rate", req.InputSampleRate)
+		},
+	}
+
+	for {
+		messageType, message, err := conn.ReadMessage()
+		if err != nil {
+			if isTimeout(err) {
+				logger.Warn("TTS 连接超时: 未收到数据或 Pong", "timeout", readTimeout)
+				out.writeClose(CLOSE_READ_TIMEOUT, CLOSE_REASON_READ_TIMEOUT)
+			} else if errors.Is(err, websocket.ErrReadLimit) {
+				// WebSocket 库已以 1009 关闭连接
+				logger.Warn("TTS 消息超过 max_message_size", "limit", cfg.MaxMessageSize)
+			} else if websocket.IsUnexpectedCloseError(err,
+				websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				logger.Warn("TTS 读取错误", "error", err)
+			}
+			break
+		}
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+		stats.bytesReceived.Add(int64(len(message)))
+
+		// convert 之后的二进制消息为源音频, 收到 flush 后开始转换
+		if messageType == websocket.BinaryMessage && conversion != nil {
+			if cfg.MaxAudioBytes > 0 && len(conversion.SourceAudio)+len(message) > cfg.MaxAudioBytes {
+				logger.Warn("TTS 变声源音频超过上限, 丢弃", "limit", cfg.MaxAudioBytes)
+				sendTTSError(out, protocolVersion, ErrorResponse{Code: "AUDIO_TOO_LONG",
+					Message: fmt.Sprintf("Audio exceeds %d bytes", cfg.MaxAudioBytes)})
+				conversion = nil
+				continue
+			}
+			conversion.SourceAudio = append(conversion.SourceAudio, message...)
+			continue
+		}
+
+		var req TTSRequest
+		if errResp := decodeJSON(bytes.NewReader(message), &req); errResp != nil {
+			sendTTSError(out, protocolVersion, *errResp)
+			// 偶发的错误消息不影响连接; 持续解析失败说明客户端协议状态已错乱 (如把二进制当文本发送)
+			if parseErrors++; parseErrors >= MAX_PARSE_ERRORS {
+				logger.Warn("TTS 连续解析失败, 关闭连接", "errors", parseErrors)
+				out.writeClose(websocket.ClosePolicyViolation, CLOSE_REASON_PARSE_ERRORS)
+				break
+			}
+			continue
+		}
+		parseErrors = 0
+		// 文本、词典等字段已有专门的错误码 (TEXT_EMPTY、LEXICON_ERROR), 除 action 外没有必填字段
+		if errResp := checkRequiredFields(message, nil); errResp != nil {
+			sendTTSError(out, protocolVersion, *errResp)
+			continue
+		}
+
+		if req.ProtocolVersion != 0 {
+			if !isSupportedProtocolVersion(req.ProtocolVersion) {
+				sendTTSError(out, protocolVersion, ErrorResponse{Code: "INVALID_REQUEST",
+					Message: fmt.Sprintf("Unsupported protocol_version %d", req.ProtocolVersion)})
+				continue
+			}
+			protocolVersion = req.ProtocolVersion
+		}
+		req.ProtocolVersion = protocolVersion
+
+		// 请求未指定 session_id 时沿用连接 ID, 便于关联日志
+		sessionID := req.SessionID
+		if sessionID == "" {
+			sessionID = connID
+		}
+		reqLogger := logger.With("session_id", sessionID)
+		reqLogger.Debug("TTS 请求", "action", req.Action)
+
+		if conversion != nil {
+			// 接收源音频期间只接受 flush (开始转换) 与 stop (放弃)
+			switch req.Action {
+			case "flush":
+			case "stop":
+				conversion = nil
+				sendJSON(out, ttsCompleteMessage(protocolVersion, "interrupted", 0, 0))
+				continue
+			default:
+				sendTTSError(out, protocolVersion, ErrorResponse{Code: "INVALID_REQUEST",
+					Message: "Voice conversion awaiting audio; send flush or stop"})
+				continue
+			}
+		}
+
+		handle, ok := ttsHandlers[req.Action]
+		if !ok {
+			sendTTSError(out, protocolVersion, unknownActionError(req.Action, ttsActions))
+			continue
+		}
+		handle(req, reqLogger)
+	}
+
+	logger.Info("TTS 客户端断开")
+}
+
+// handleASR 处理 ASR 请求
+func handleASR(w http.ResponseWriter, r *http.Request) {
+	// 连接期间沿用建立时的配置, 重新加载只影响之后的连接
+	cfg := currentConfig()
+	recognizer := asrEngineFrom(r.Context())
+	if connections.isClosing() {
+		http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	ip := clientIP(r)
+	user, ok := authenticate(r)
+	if !ok {
+		slog.Warn("ASR 鉴权失败, 拒绝连接", "remote", ip)
+		rejectUnauthorized(w)
+		return
+	}
+	if !acceptsSubprotocol(r, cfg) {
+		slog.Warn("ASR 子协议不受支持, 拒绝连接", "remote", ip,
+			"subprotocols", websocket.Subprotocols(r))
+		rejectSubprotocol(w)
+		return
+	}
+	if !limiter.acquire(ip) {
+		slog.Warn("ASR 连接数超限, 拒绝连接", "remote", ip)
+		rejectBusy(w)
+		return
+	}
+	defer limiter.release(ip)
+
+	connID := newSessionID()
+	logger := slog.With("endpoint", "asr", "session_id", connID, "remote", ip, "user", user)
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Warn("WebSocket 升级失败", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	stats := newConnStats("asr", connID, ip, user)
+	if !connections.add(conn, stats, nil) {
+		return
+	}
+	defer connections.remove(conn)
+
+	logger.Info("ASR 客户端连接", "compression", setupCompression(conn, r, cfg),
+		"subprotocol", conn.Subprotocol())
+
+	if cfg.MaxMessageSize > 0 {
+		conn.SetReadLimit(cfg.MaxMessageSize)
+	}
+
+	stopKeepAlive := keepAlive(conn)
+	defer stopKeepAlive()
+
+	out := newConnWriter(conn, cfg.SendQueueSize, cfg.SlowConsumerTimeout, stats, logger)
+	defer out.close()
+
+	// 开启 record_audio 时记录解码后的流式音频, 断开时写为 WAV
+	recorder := newAudioRecorder(cfg, connID, logger)
+	quotaNotified := false // 已提示超出每月音频额度
+
+	var audioBuffer bytes.Buffer
+	var bufferMu sync.Mutex
+	sampleRate := cfg.DefaultSampleRate // 未收到 start 时的默认采样率
+
+	// 中间结果: 每累积 partialBytes 字节异步识别一次, 同一时刻至多一个在进行
+	// 引擎未实现 PartialRecognizer 时不返回中间结果
+	partials, _ := recognizer.(PartialRecognizer)
+	var partialWG sync.WaitGroup
+	partialBytes := 0
+	nextPartial := 0
+	partialBusy := false // 受 bufferMu 保护
+	// 中间识别的上下文, 仅在读循环中替换; cancel 时取消并换新, 被取消的中间结果不再发送
+	var partialCtx context.Context
+	var cancelPartials context.CancelFunc
+	resetPartials := func() {
+		partialCtx, cancelPartials = context.WithCancel(context.Background())
+	}
+	resetPartials()
+	defer func() { cancelPartials() }()
+
+	var grammars *grammarSet // 仅在读循环中访问, nil 表示不约束
+	var noInput *noInputTimer
+	confidenceThreshold := 0.0
+	recognitionBytes := 0 // 0 表示不限制识别时长
+	completed := false    // 已因 recognition-timeout 结束, 丢弃音频直到下一次 start 或 end
+	recognizing := false  // 已收到 start 且尚未收到 end, 用于 strict_asr_protocol 的状态判断
+	jsonResult := false
+	agcTarget := 0.0   // 0 表示不做增益
+	asrSessionID := "" // start 携带的会话 ID, 断开时据此保留未识别的音频
+
+	// 候选语种, 仅在读循环中访问; 未收到 start 时使用 default_language
+	languages := asrLanguages("", nil, cfg.DefaultLanguage)
+
+	// DTMF: 收集器在首个按键时创建, 仅在读循环中创建/替换; 参数来自 start
+	var dtmf *dtmfCollector
+	dtmfTermChar := ""
+	dtmfTimeout := time.Duration(0)
+	dtmfDetect := false
+	lastTone := "" // 上一帧检测到的按键音, 按键按下 (由无到有) 时才记为一次按键
+	defer func() {
+		if noInput != nil {
+			noInput.stop()
+		}
+		if dtmf != nil {
+			dtmf.stop()
+		}
+	}()
+
+	// grammarURI 当前语法的 URI, 用于无结果的 NLSML
+	grammarURI := func() string {
+		return grammars.uri()
+	}
+	var decoder Decoder  // 仅在读循环中访问, nil 表示输入即为 PCM
+	var vad *vadDetector // 仅在读循环中访问, nil 表示未启用端点检测
+	endpointed := false  // 端点检测已出结果, 之后尚未检测到新的语音
+
+	// asrState 当前协议状态: 已出结果 (超时、no-input、按键结束或自动端点) 但未收到 end 时为 finalizing
+	asrState := func() string {
+		switch {
+		case !recognizing:
+			return ASRStateIdle
+		case completed || endpointed || (noInput != nil && noInput.hasFired()) || (dtmf != nil && dtmf.finished()):
+			return ASRStateFinalizing
+		}
+		return ASRStateRecognizing
+	}
+	// rejectOutOfOrder 开启 strict_asr_protocol 时拒绝当前状态不允许的消息, 返回 true 表示已拒绝
+	rejectOutOfOrder := func(what string, disallowed ...string) bool {
+		if !cfg.StrictASRProtocol {
+			return false
+		}
+		state := asrState()
+		for _, s := range disallowed {
+			if s == state {
+				sendJSONError(out, "PROTOCOL_ERROR",
+					fmt.Sprintf("%s not allowed in state '%s'", what, state))
+				return true
+			}
+		}
+		return false
+	}
+
+	// 识别事件, 仅在读循环中访问; 未开启端点检测时由 speech 检测语音起止, 不自动结束识别
+	events := false
+	var speech *vadDetector
+	speaking := false // 已发送 speech_start 且尚未发送 speech_end
+	speechStart := func() {
+		if events && !speaking {
+			speaking = true
+			sendJSON(out, ASREvent{Type: "speech_start"})
+		}
+	}
+	speechEnd := func() {
+		if speaking {
+			speaking = false
+			sendJSON(out, ASREvent{Type: "speech_end"})
+		}
+	}
+
+	// sendResult 按 result_format 发送识别结果
+	// language 为识别出的语种, 非空时标注在 NLSML 上; span 只随 JSON 结果发送, 可为 nil
+	sendResult := func(nlsml string, cause CompletionCause, language string, span *SpeechSpan, asJSON bool) {
+		stats.setState(StateIdle)
+		nlsml = formatNLSML(withLanguage(nlsml, language), cfg.NLSMLFormat)
+		if asJSON {
+			sendJSON(out, ASRResult{Status: "complete", Cause: cause, NLSML: nlsml, Language: language,
+				SpeechSpan: span})
+			return
+		}
+		out.write(websocket.TextMessage, []byte(nlsml))
+	}
+
+	// speechSpan 返回语音在 audio 中的起止位置; 只有 JSON 结果携带, 纯 NLSML 时不检测
+	speechSpan := func(audio []byte, rate int) *SpeechSpan {
+		if !jsonResult {
+			return nil
+		}
+		span, err := detectSpeechSpan(recognizer, audio, rate)
+		if err != nil {
+			logger.Warn("ASR 语音起止检测失败", "error", err)
+			return nil
+		}
+		return span
+	}
+
+	// takeAudio 取出并清空已缓冲的音频
+	//
+	// 返回副本, 识别期间继续写入的音频不会覆盖正在识别的数据。
+	takeAudio := func() []byte {
+		bufferMu.Lock()
+		defer bufferMu.Unlock()
+		audioData := append([]byte(nil), audioBuffer.Bytes()...)
+		audioBuffer.Reset()
+		nextPartial = partialBytes
+		return audioData
+	}
+
+	// recognize 最终识别的唯一入口, end/端点检测/识别超时与断开后的收尾经 recognizeMu 串行执行
+	var recognizeMu sync.Mutex
+	recognize := func(audioData []byte, alternatives int) (string, string, error) {
+		recognizeMu.Lock()
+		defer recognizeMu.Unlock()
+		return runRecognizer(recognizer, audioData, sampleRate, alternatives, grammars.active(), languages, cfg)
+	}
+
+	// finalize 识别已累积的音频并发送结果, 由 end、端点检测或识别超时触发
+	finalize := func(alternatives int, cause CompletionCause) {
+		// 等待进行中的中间识别, 保证最终结果最后发送
+		partialWG.Wait()
+		speechEnd()
+		defer stats.setState(StateIdle)
+
+		audioData := takeAudio()
+
+		if vad != nil {
+			vad.reset()
+		}
+		if speech != nil {
+			speech.reset()
+		}
+		if noInput != nil {
+			noInput.stop()
+		}
+
+		if len(audioData) > 0 {
+			if alternatives <= 0 {
+				alternatives = 1
+			}
+			if agcTarget > 0 {
+				audioData = normalizePCM(audioData, agcTarget)
+			}
+			asrRequestsTotal.Inc()
+			logger.Info("ASR 识别", "bytes", len(audioData),
+				"duration_s", float64(len(audioData))/float64(sampleRate*2)) // 16-bit
+			result, language, err := recognize(audioData, alternatives)
+			if err != nil {
+				logger.Warn("ASR 识别失败", "error", err)
+				sendErrorResponse(out, recognitionError(err))
+				return
+			}
+			if isNoMatch(result, confidenceThreshold) {
+				logger.Info("ASR 无匹配结果", "confidence_threshold", confidenceThreshold)
+				cause = CauseNoMatch
+				result = noResultNLSML(cause, grammarURI())
+			} else {
+				result = withCompletionCause(dropLowConfidence(result, confidenceThreshold), cause)
+			}
+			sendResult(result, cause, language, speechSpan(audioData, sampleRate), jsonResult)
+		}
+	}
+
+	// sendDTMFResult 丢弃已缓冲的语音, 发送按键结果
+	sendDTMFResult := func(digits, uri string, asJSON bool) {
+		takeAudio()
+		if digits == "" {
+			sendResult(noResultNLSML(CauseNoMatch, uri), CauseNoMatch, "", nil, asJSON)
+			return
+		}
+		sendResult(dtmfNLSML(digits, uri), CauseSuccess, "", nil, asJSON)
+	}
+
+	// recognizeOnce 解码一次性提交的整段音频 (recognize_url / recognize) 并识别, 与流式音频的缓冲互不影响
+	//
+	// source 为音频来源, 仅用于日志。
+	recognizeOnce := func(control ASRSubmittedAudio, data []byte, contentType, source string) {
+		audio, rate, err := decodeSubmittedAudio(data, contentType, control.Codec, control.SampleRate, cfg)
+		if err != nil {
+			sendJSONError(out, "UNSUPPORTED_AUDIO_FORMAT", err.Error())
+			return
+		}
+		if len(audio) == 0 {
+			sendJSONError(out, "AUDIO_EMPTY", "Audio is empty")
+			return
+		}
+		if !isSupportedASRSampleRate(rate) {
+			sendJSONError(out, "SAMPLE_RATE_UNSUPPORTED",
+				fmt.Sprintf("Unsupported sample rate %d", rate))
+			return
+		}
+		alternatives := control.Alternatives
+		if alternatives <= 0 {
+			alternatives = 1
+		}
+		if !stats.chargeAudioReceived(len(audio), cfg.QuotaMonthlyASRBytes) {
+			logger.Warn("ASR 超出每月音频额度", "bytes", len(audio), "quota", cfg.QuotaMonthlyASRBytes)
+			sendErrorResponse(out, quotaExceeded("audio"))
+			return
+		}
+
+		stats.setState(StateRecognizing)
+		defer stats.setState(StateIdle)
+		asrRequestsTotal.Inc()
+		logger.Info("ASR 识别", "source", source, "content_type", contentType, "bytes", len(audio),
+			"duration_s", float64(len(audio))/float64(rate*2)) // 16-bit
+		recognizeMu.Lock()
+		result, language, err := runRecognizer(recognizer, audio, rate, alternatives, grammars.active(), languages, cfg)
+		recognizeMu.Unlock()
+		if err != nil {
+			logger.Warn("ASR 识别失败", "error", err)
+			sendErrorResponse(out, recognitionError(err))
+			return
+		}
+		cause := CauseSuccess
+		if isNoMatch(result, confidenceThreshold) {
+			cause = CauseNoMatch
+			result = noResultNLSML(cause, grammarURI())
+		} else {
+			result = withCompletionCause(dropLowConfidence(result, confidenceThreshold), cause)
+		}
+		sendResult(result, cause, language, speechSpan(audio, rate), jsonResult)
+	}
+
+	// recognizeURL 拉取 url 处的音频并识别
+	recognizeURL := func(control ASRRecognizeURLControl) {
+		data, contentType, err := fetchAudio(control.URL, cfg)
+		if err != nil {
+			var fetchErr *fetchError
+			if !errors.As(err, &fetchErr) {
+				sendJSONError(out, "AUDIO_TOO_LONG",
+					fmt.Sprintf("Audio exceeds %d bytes", cfg.MaxAudioBytes))
+				return
+			}
+			logger.Warn("ASR 拉取音频失败", "url", control.URL, "http_status", fetchErr.Status,
+				"error", fetchErr.Message)
+			sendErrorResponse(out, ErrorResponse{Status: "error", Code: "FETCH_ERROR",
+				Message: fetchErr.Message, HTTPStatus: fetchErr.Status})
+			return
+		}
+		recognizeOnce(control.ASRSubmittedAudio, data, contentType, control.URL)
+	}
+
+	// recognizeBase64 识别 audio_base64 中内联的音频, 供无法发送二进制帧的客户端使用
+	recognizeBase64 := func(control ASRRecognizeControl) {
+		data, err := base64.StdEncoding.DecodeString(control.AudioBase64)
+		if err != nil {
+			sendJSONError(out, "INVALID_AUDIO", fmt.Sprintf("Invalid audio_base64: %v", err))
+			return
+		}
+		if cfg.MaxAudioBytes > 0 && len(data) > cfg.MaxAudioBytes {
+			sendJSONError(out, "AUDIO_TOO_LONG",
+				fmt.Sprintf("Audio exceeds %d bytes", cfg.MaxAudioBytes))
+			return
+		}
+		recognizeOnce(control.ASRSubmittedAudio, data, "", "audio_base64")
+	}
+
+	// onDigit 处理 dtmf 消息或从音频检测到的按键
+	onDigit := func(digit string) {
+		if dtmf == nil {
+			uri, asJSON := grammarURI(), jsonResult
+			dtmf = newDTMFCollector(dtmfTermChar, dtmfTimeout, func(digits string) {
+				logger.Info("ASR 按键间隔超时", "digits", digits)
+				sendDTMFResult(digits, uri, asJSON)
+			})
+		}
+		if noInput != nil {
+			noInput.stop()
+		}
+		if digits, complete := dtmf.add(digit); complete {
+			logger.Info("ASR 收到结束按键", "digits", digits)
+			speechEnd()
+			if vad != nil {
+				vad.reset()
+			}
+			sendDTMFResult(digits, grammarURI(), jsonResult)
+		}
+	}
+
+	// switchGrammar 处理 activate_grammar / deactivate_grammar
+	switchGrammar := handleAs(func(control ASRGrammarControl) {
+		active := control.Action == "activate_grammar"
+		if !grammars.setActive(control.GrammarURI, active) {
+			sendJSONError(out, "GRAMMAR_NOT_FOUND",
+				fmt.Sprintf("Grammar '%s' not defined", control.GrammarURI))
+			return
+		}
+		logger.Info("ASR 切换语法", "grammar_uri", control.GrammarURI, "active", active)
+	})
+
+	// asrHandlers 各 action 的处理函数, 消息按 action 对应的结构解析并校验必填字段
+	asrHandlers := map[string]controlHandler{
+		"start": handleAs(func(control ASRStartControl) {
+			if rejectOutOfOrder("start", ASRStateRecognizing) {
+				return
+			}
+			rate := control.SampleRate
+			if rate == 0 {
+				rate = cfg.DefaultSampleRate
+			}
+			if !isSupportedASRSampleRate(rate) {
+				sendJSONError(out, "SAMPLE_RATE_UNSUPPORTED",
+					fmt.Sprintf("Unsupported sample rate %d", rate))
+				return
+			}
+			if control.ResultFormat != "" && control.ResultFormat != "nlsml" &&
+				control.ResultFormat != "json" {
+				sendJSONError(out, "INVALID_REQUEST",
+					fmt.Sprintf("Unsupported result_format '%s'", control.ResultFormat))
+				return
+			}
+			dec, err := newDecoder(control.Codec, rate)
+			if err != nil {
+				sendJSONError(out, "UNSUPPORTED_CODEC", err.Error())
+				return
+			}
+			decoder = dec
+			sampleRate = rate
+			partialBytes = 0
+			if partials != nil {
+				partialBytes = sampleRate * 2 * control.PartialIntervalMs / 1000
+			}
+			nextPartial = partialBytes
+			vad = nil
+			endpointed = false
+			if control.VADEnabled {
+				vad = newVADDetector(sampleRate, control.SilenceThreshold, control.SilenceMs)
+			}
+			events = control.Events
+			speaking = false
+			speech = nil
+			if events && vad == nil {
+				speech = newVADDetector(sampleRate, control.SilenceThreshold, control.SilenceMs)
+			}
+			confidenceThreshold = control.ConfidenceThreshold
+			recognitionBytes = sampleRate * 2 * control.RecognitionTimeoutMs / 1000
+			completed = false
+			jsonResult = control.ResultFormat == "json"
+			agcTarget = 0
+			if control.AGC {
+				agcTarget = control.AGCTargetRMS
+				if agcTarget <= 0 {
+					agcTarget = DEFAULT_AGC_TARGET_RMS
+				}
+			}
+			asrSessionID = control.SessionID
+			languages = asrLanguages(control.Language, control.Languages, cfg.DefaultLanguage)
+			if dtmf != nil {
+				dtmf.stop()
+				dtmf = nil
+			}
+			dtmfTermChar = control.DTMFTermChar
+			dtmfTimeout = time.Duration(control.DTMFInterdigitTimeoutMs) * time.Millisecond
+			dtmfDetect = control.DTMFDetect
+			lastTone = ""
+			if asrSessionID != "" {
+				// 恢复断线前已缓冲的音频, 采样率不同时无法续接, 直接丢弃
+				if s, ok := sessions.resumeASR(asrSessionID, user); ok {
+					if s.sampleRate == sampleRate {
+						bufferMu.Lock()
+						audioBuffer.Write(s.audio)
+						nextPartial = audioBuffer.Len() + partialBytes
+						bufferMu.Unlock()
+						if grammars == nil {
+							grammars = s.grammars
+						}
+						logger.Info("恢复 ASR 会话", "session_id", asrSessionID, "bytes", len(s.audio))
+						sendJSON(out, ASRResumed{Status: "resumed", Bytes: len(s.audio)})
+					} else {
+						logger.Warn("ASR 会话采样率不一致, 丢弃已缓冲的音频",
+							"session_id", asrSessionID, "sample_rate", s.sampleRate)
+					}
+				}
+			}
+			if noInput != nil {
+				noInput.stop()
+				noInput = nil
+			}
+			if control.NoInputTimeoutMs > 0 {
+				uri, asJSON := grammarURI(), jsonResult
+				noInput = newNoInputTimer(
+					time.Duration(control.NoInputTimeoutMs)*time.Millisecond,
+					control.SilenceThreshold,
+					func() {
+						// 丢弃静音, 之后的 end 不再出结果
+						bufferMu.Lock()
+						audioBuffer.Reset()
+						bufferMu.Unlock()
+						logger.Info("ASR 未检测到语音, 返回 no-input")
+						sendResult(noResultNLSML(CauseNoInputTimeout, uri),
+							CauseNoInputTimeout, "", nil, asJSON)
+					})
+			}
+			recognizing = true
+			logger.Info("ASR 开始", "sample_rate", sampleRate, "codec", control.Codec,
+				"partial_interval_ms", control.PartialIntervalMs, "vad", control.VADEnabled,
+				"languages", languages)
+		}),
+		"define_grammar": handleAs(func(control ASRDefineGrammarControl) {
+			specs := control.Grammars
+			if len(specs) == 0 {
+				specs = []GrammarSpec{{Grammar: control.Grammar, GrammarURI: control.GrammarURI,
+					Weight: control.GrammarWeight}}
+			}
+			gs, err := parseGrammars(specs)
+			if err != nil {
+				sendJSONError(out, "GRAMMAR_PARSE_ERROR",
+					fmt.Sprintf("Grammar parse error: %v", err))
+				return
+			}
+			// 重新定义时替换全部语法, 均为激活状态
+			grammars = newGrammarSet(gs)
+			for _, g := range gs {
+				logger.Info("ASR 定义语法", "grammar_uri", g.URI, "phrases", len(g.Phrases), "weight", g.Weight)
+			}
+		}),
+		"activate_grammar":   switchGrammar,
+		"deactivate_grammar": switchGrammar,
+		"dtmf": handleAs(func(control ASRDTMFControl) {
+			if rejectOutOfOrder("dtmf", ASRStateIdle) {
+				return
+			}
+			if !isDTMFDigit(control.Digit) {
+				sendJSONError(out, "INVALID_REQUEST",
+					fmt.Sprintf("Invalid DTMF digit '%s'", control.Digit))
+				return
+			}
+			onDigit(control.Digit)
+		}),
+		"recognize_url": handleAs(func(control ASRRecognizeURLControl) {
+			if rejectOutOfOrder("recognize_url", ASRStateRecognizing, ASRStateFinalizing) {
+				return
+			}
+			recognizeURL(control)
+		}),
+		"recognize": handleAs(func(control ASRRecognizeControl) {
+			if rejectOutOfOrder("recognize", ASRStateRecognizing, ASRStateFinalizing) {
+				return
+			}
+			recognizeBase64(control)
+		}),
+		"warmup": handleAs(func(_ ASRActionControl) {
+			if err := warmupEngine(recognizer); err != nil {
+				logger.Warn("ASR 引擎预热失败", "error", err)
+				sendJSONError(out, "WARMUP_FAILED", fmt.Sprintf("Warmup failed: %v", err))
+				return
+			}
+			sendJSON(out, StatusResponse{Status: "ready"})
+		}),
+		"cancel": handleAs(func(_ ASRActionControl) {
+			// 已出结果或没有进行中的识别时不做任何处理
+			bufferMu.Lock()
+			pending := audioBuffer.Len() > 0 || partialBusy
+			bufferMu.Unlock()
+			if asrState() == ASRStateFinalizing || (!recognizing && !pending) {
+				sendJSON(out, StatusResponse{Status: "already_complete"})
+				return
+			}
+
+			// 中止进行中的中间识别并丢弃已缓冲的音频, 不产生结果, 回到 idle
+			cancelPartials()
+			partialWG.Wait()
+			resetPartials()
+			takeAudio()
+			speechEnd()
+			if vad != nil {
+				vad.reset()
+			}
+			if speech != nil {
+				speech.reset()
+			}
+			if noInput != nil {
+				noInput.stop()
+				noInput = nil
+			}
+			if dtmf != nil {
+				dtmf.stop()
+				dtmf = nil
+			}
+			lastTone = ""
+			recognizing, completed, endpointed = false, false, false
+			stats.setState(StateIdle)
+			logger.Info("ASR 识别已取消")
+			sendJSON(out, StatusResponse{Status: "cancelled"})
+		}),
+		"end": handleAs(func(control ASREndControl) {
+			if rejectOutOfOrder("end", ASRStateIdle) {
+				return
+			}
+			recognizing = false
+			if dtmf != nil {
+				digits, handled := dtmf.end()
+				dtmf = nil
+				if handled {
+					// 按键优先于语音; 已因结束符或超时返回过结果时不重复发送
+					speechEnd()
+					if digits != "" {
+						sendDTMFResult(digits, grammarURI(), jsonResult)
+					}
+					if vad != nil {
+						vad.reset()
+					}
+					if noInput != nil {
+						noInput.stop()
+					}
+					completed = false
+					endpointed = false
+					return
+				}
+			}
+			if noInput != nil && noInput.hasFired() {
+				// 已返回 no-input, 本次识别结束
+				noInput = nil
+				return
+			}
+			if completed {
+				// 已因识别超时返回结果, 不重复出结果
+				completed = false
+				return
+			}
+			if endpointed {
+				// 已自动结束且之后只有静音, 丢弃缓冲, 不重复出结果
+				bufferMu.Lock()
+				audioBuffer.Reset()
+				bufferMu.Unlock()
+				vad.reset()
+				endpointed = false
+				return
+			}
+			finalize(control.Alternatives, CauseSuccess)
+		}),
+	}
+
+	for {
+		messageType, message, err := conn.ReadMessage()
+		if err != nil {
+			if isTimeout(err) {
+				logger.Warn("ASR 连接超时: 未收到数据或 Pong", "timeout", readTimeout)
+				out.writeClose(CLOSE_READ_TIMEOUT, CLOSE_REASON_READ_TIMEOUT)
+			} else if errors.Is(err, websocket.ErrReadLimit) {
+				// WebSocket 库已以 1009 关闭连接
+				logger.Warn("ASR 消息超过 max_message_size", "limit", cfg.MaxMessageSize)
+			} else if websocket.IsUnexpectedCloseError(err,
+				websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				logger.Warn("ASR 读取错误", "error", err)
+			}
+			break
+		}
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+		stats.bytesReceived.Add(int64(len(message)))
+
+		if messageType == websocket.BinaryMessage {
+			if rejectOutOfOrder("audio", ASRStateIdle) {
+				continue
+			}
+			// 超出每月音频额度的音频被丢弃, 每个连接只提示一次
+			if !stats.chargeAudioReceived(len(message), cfg.QuotaMonthlyASRBytes) {
+				if !quotaNotified {
+					quotaNotified = true
+					logger.Warn("ASR 超出每月音频额度", "quota", cfg.QuotaMonthlyASRBytes)
+					sendErrorResponse(out, quotaExceeded("audio"))
+				}
+				continue
+			}
+			// 音频数据, 压缩编码先解码为 PCM, 之后的缓冲/中间结果/端点检测均按 PCM 处理
+			if decoder != nil {
+				pcm, err := decoder.Decode(message)
+				if err != nil {
+					logger.Warn("ASR 音频解码失败", "error", err)
+					sendJSONError(out, "DECODE_ERROR",
+						fmt.Sprintf("Decode error: %v", err))
+					continue
+				}
+				message = pcm
+			}
+			recorder.write(message, sampleRate)
+
+			if noInput != nil {
+				if noInput.hasFired() {
+					// 已返回 no-input, 丢弃音频直到下一次 start 或 end
+					continue
+				}
+				noInput.process(message)
+			}
+			if dtmfDetect {
+				tone := detectDTMF(pcmSamples(message), sampleRate)
+				if tone != "" && tone != lastTone {
+					onDigit(tone)
+				}
+				lastTone = tone
+			}
+			if completed || (dtmf != nil && dtmf.finished()) {
+				// 已因识别超时或按键结束, 丢弃音频直到下一次 start 或 end
+				continue
+			}
+
+			stats.setState(StateRecognizing)
+			bufferMu.Lock()
+			audioBuffer.Write(message)
+			buffered := audioBuffer.Len()
+			if cfg.MaxAudioBytes > 0 && audioBuffer.Len() > cfg.MaxAudioBytes {
+				size := audioBuffer.Len()
+				audioBuffer.Reset()
+				bufferMu.Unlock()
+
+				// 客户端一直不发 end 时避免缓冲无限增长, 丢弃音频并关闭连接
+				logger.Warn("ASR 音频超过上限, 关闭连接", "bytes", size, "limit", cfg.MaxAudioBytes)
+				sendJSONError(out, "AUDIO_TOO_LONG",
+					fmt.Sprintf("Audio exceeds %d bytes", cfg.MaxAudioBytes))
+				out.writeClose(websocket.CloseMessageTooBig, CLOSE_REASON_AUDIO_TOO_LONG)
+				break
+			}
+			var snapshot []byte
+			if partialBytes > 0 && audioBuffer.Len() >= nextPartial && !partialBusy {
+				snapshot = append([]byte(nil), audioBuffer.Bytes()...)
+				nextPartial = audioBuffer.Len() + partialBytes
+				partialBusy = true
+			}
+			bufferMu.Unlock()
+			logger.Debug("ASR 收到音频", "bytes", len(message))
+
+			if recognitionBytes > 0 && buffered >= recognitionBytes {
+				logger.Info("ASR 识别超时, 自动结束")
+				finalize(1, CauseRecognitionTimeout)
+				completed = true
+				continue
+			}
+
+			// 端点检测触发后与 end 走同一路径
+			if vad != nil {
+				started, ended := vad.processEvents(message)
+				if started {
+					speechStart()
+				}
+				if ended {
+					logger.Info("ASR 检测到尾部静音, 自动结束")
+					finalize(1, CauseSuccess)
+					endpointed = true
+					continue
+				}
+				if vad.inSpeech {
+					endpointed = false
+				}
+			} else if speech != nil {
+				started, ended := speech.processEvents(message)
+				if started {
+					speechStart()
+				}
+				if ended {
+					speechEnd()
+					speech.reset()
+				}
+			}
+
+			if snapshot != nil {
+				partialWG.Add(1)
+				go func(ctx context.Context, audio []byte, rate int, asEvent bool) {
+					defer partialWG.Done()
+					text, err := recognizePartial(ctx, partials, audio, rate)
+					if ctx.Err() != nil {
+						// 已取消, 丢弃结果
+					} else if err != nil {
+						logger.Warn("ASR 中间识别失败", "error", err)
+					} else if asEvent {
+						sendJSON(out, ASRPartialEvent{Type: "partial", Text: text})
+					} else {
+						sendJSON(out, PartialResponse{Status: "partial", Text: text})
+					}
+
+					bufferMu.Lock()
+					partialBusy = false
+					bufferMu.Unlock()
+				}(partialCtx, snapshot, sampleRate, events)
+			}
+
+		} else if messageType == websocket.TextMessage {
+			// 控制消息, 按 action 分派给对应的处理函数
+			action, errResp := decodeAction(message)
+			if errResp == nil {
+				if handle, ok := asrHandlers[action]; ok {
+					errResp = handle(message)
+				} else {
+					unknown := unknownActionError(action, asrActions)
+					errResp = &unknown
+				}
+			}
+			if errResp != nil {
+				sendErrorResponse(out, *errResp)
+			}
+		}
+	}
+
+	partialWG.Wait()
+
+	// 处理剩余音频, 与 finalize 经同一路径串行识别
+	audioData := takeAudio()
+
+	// 携带会话 ID 且识别未结束时保留音频, 客户端重连后继续发送
+	resumable := asrSessionID != "" && !completed && (noInput == nil || !noInput.hasFired()) &&
+		(dtmf == nil || !dtmf.finished())
+	if len(audioData) > 0 && resumable && sessions.parkASR(asrSessionID, &asrSession{
+		user: user, audio: audioData, sampleRate: sampleRate, grammars: grammars,
+	}) {
+		logger.Info("保留 ASR 会话", "session_id", asrSessionID, "bytes", len(audioData))
+	} else if len(audioData) > 0 {
+		result, language, err := recognize(audioData, 1)
+		if err != nil {
+			logger.Warn("ASR 识别失败 (连接已关闭)", "error", err)
+		} else {
+			logger.Info("ASR 结果 (连接已关闭)", "result", result, "language", language)
+		}
+	}
+
+	recorder.close()
+	logger.Info("ASR 客户端断开")
+}
+
+// keepAlive 设置读超时并定期发送 Ping, 收到 Pong 时延长读超时
+//
+// 返回的函数用于停止 Ping 协程。
+func keepAlive(conn *websocket.Conn) func() {
+	conn.SetReadDeadline(time.Now().Add(readTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(readTimeout))
+	})
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(PING_INTERVAL)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				// WriteControl 可与其他写操作并发调用
+				if err := conn.WriteControl(websocket.PingMessage, nil,
+					time.Now().Add(10*time.Second)); err != nil {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// isTimeout 判断是否为读超时错误
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// sendJSONError 经 w 发送错误响应
+func sendJSONError(w *connWriter, code, message string) {
+	sendErrorResponse(w, ErrorResponse{
+		Status:  "error",
+		Code:    code,
+		Message: message,
+	})
+}
+
+// sendErrorResponse 发送带附加字段的错误响应并计数
+func sendErrorResponse(w *connWriter, resp ErrorResponse) {
+	errorsTotal.WithLabelValues(resp.Code).Inc()
+	sendJSON(w, resp)
+}
+
+// sendJSON 经 w 发送 JSON 文本消息
+func sendJSON(w *connWriter, v interface{}) {
+	data, _ := json.Marshal(v)
+	w.write(websocket.TextMessage, data)
+}
+
+func main() {
+	configPath := flag.String("config", "", "YAML 配置文件路径")
+	flag.Parse()
+
+	loaded, err := LoadConfig(*configPath)
+	if err != nil {
+		fatal("加载配置失败", err)
+	}
+	activeConfig.Store(loaded)
+	cfg := loaded
+	setupLogger(cfg.LogFormat)
+	upgrader = newUpgrader(cfg)
+	limiter = newConnLimiter(cfg.MaxConnections, cfg.MaxConnectionsPerIP)
+	authenticator = newAuthenticator(cfg)
+	ttsRateLimiter = newRateLimiter(cfg.TTSRateLimit, cfg.TTSRateBurst, cfg.TTSRatePerUser)
+	sessions = newSessionManager(cfg.SessionTTL)
+	stopSweeper := sessions.startSweeper()
+	defer stopSweeper()
+	logConfig(cfg)
+
+	engine, err := newSynthesizer(cfg)
+	if err != nil {
+		fatal("创建 TTS 引擎失败", err)
+	}
+	if _, ok := lookupVoice(cfg.DefaultVoice); !ok {
+		fatal("默认音色未注册", fmt.Errorf("default_voice '%s' not found", cfg.DefaultVoice))
+	}
+	if err := checkProfiles(cfg); err != nil {
+		fatal("合成参数预设无效", err)
+	}
+	registerBreaker("tts", engine)
+	if cfg.TTSCacheSize > 0 {
+		engine = newCachingSynthesizer(engine, cfg.TTSCacheSize)
+	}
+	ttsEngine = engine
+
+	recognizer, err := newRecognizer(cfg)
+	if err != nil {
+		fatal("创建 ASR 引擎失败", err)
+	}
+	registerBreaker("asr", recognizer)
+	asrEngine = recognizer
+	if err := buildRoutes(cfg); err != nil {
+		fatal("创建路由引擎失败", err)
+	}
+
+	addr := cfg.Addr()
+
+	// 探针与 /metrics 调用频繁, 不记录请求日志
+	http.HandleFunc("/tts", withLogging("/tts", handleTTS))
+	http.HandleFunc("/asr", withLogging("/asr", handleASR))
+	http.HandleFunc("/tts/synthesize", withLogging("/tts/synthesize", handleTTSSynthesize))
+	http.HandleFunc("/asr/recognize", withLogging("/asr/recognize", handleASRRecognize))
+	http.HandleFunc("/tts/", withLogging("/tts/", handleTTSRoute))
+	http.HandleFunc("/asr/", withLogging("/asr/", handleASRRoute))
+	http.HandleFunc("/voices", withLogging("/voices", handleVoices))
+	http.HandleFunc("/stats", withLogging("/stats", handleStats))
+	http.HandleFunc("/admin/reload", withLogging("/admin/reload", handleAdminReload(*configPath)))
+	http.HandleFunc("/health", handleHealth)
+	http.HandleFunc("/ready", handleReady)
+	http.Handle("/metrics", promhttp.Handler())
+
+	server := &http.Server{Addr: addr}
+
+	tlsConfig, err := cfg.TLSConfig()
+	if err != nil {
+		fatal("加载 TLS 证书失败", err)
+	}
+	server.TLSConfig = tlsConfig
+
+	if tlsConfig != nil {
+		slog.Info("启动 WebSocket 服务器 (TLS)", "url", "wss://"+addr)
+	} else {
+		slog.Info("启动 WebSocket 服务器", "url", "ws://"+addr)
+	}
+	slog.Info("端点", "tts", "/tts", "asr", "/asr", "tts_http", "/tts/synthesize",
+		"asr_http", "/asr/recognize", "voices", "/voices", "stats", "/stats", "reload", "/admin/reload",
+		"health", "/health", "ready", "/ready", "metrics", "/metrics")
+
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			// 证书已在 TLSConfig 中, 无需再传文件路径
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			fatal("服务器启动失败", err)
+		}
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	<-sig
 
-	http.HandleFunc("/tts", handleTTS)
-	http.HandleFunc("/asr", handleASR)
+	// shutdown_grace 可能已被重新加载
+	grace := currentConfig().ShutdownGrace
+	slog.Info("收到退出信号, 等待活动连接结束",
+		"connections", connections.count(), "grace", grace)
 
-	log.Printf("启动 WebSocket 服务器: ws://%s", addr)
-	log.Println("TTS 端点: /tts")
-	log.Println("ASR 端点: /asr")
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
 
-	if err := http.ListenAndServe(addr, nil); err != nil {
-		log.Fatal("服务器启动失败:", err)
+	// 先排空 WebSocket 连接, 期间监听保持开启, /ready 返回 503 且拒绝新的升级;
+	// 之后再关闭监听
+	if err := connections.shutdown(ctx); err != nil {
+		slog.Warn("等待超时, 强制关闭剩余连接")
 	}
+	server.Shutdown(ctx)
+	slog.Info("服务器已关闭")
 }
@@ -0,0 +1,679 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// setTestConfig 在测试期间以 edit 修改后的默认配置作为当前配置, 测试结束后恢复
+func setTestConfig(t testing.TB, edit func(c *Config)) {
+	t.Helper()
+	prev := currentConfig()
+	c := DefaultConfig()
+	if edit != nil {
+		edit(c)
+	}
+	activeConfig.Store(c)
+	t.Cleanup(func() { activeConfig.Store(prev) })
+}
+
+// dialTestWS 以 handler 启动测试服务器并建立 WebSocket 连接, 测试结束时关闭
+func dialTestWS(t *testing.T, handler http.HandlerFunc) *websocket.Conn {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readTextMessage 读取下一条文本消息, 跳过二进制音频帧
+func readTextMessage(t *testing.T, conn *websocket.Conn) []byte {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if messageType == websocket.TextMessage {
+			return data
+		}
+	}
+}
+
+// readJSONMessage 读取下一条文本消息并解析为 JSON 对象
+func readJSONMessage(t *testing.T, conn *websocket.Conn) map[string]interface{} {
+	t.Helper()
+	data := readTextMessage(t, conn)
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("invalid JSON %s: %v", data, err)
+	}
+	return m
+}
+
+// writeJSONMessage 以文本消息发送 v 的 JSON
+func writeJSONMessage(t *testing.T, conn *websocket.Conn, v interface{}) {
+	t.Helper()
+	if err := conn.WriteJSON(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateTTSRequest(t *testing.T) {
+	promptDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(promptDir, "welcome.wav"), wavHeader(0, 8000, 1, EncodingPCM16), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	base := func() TTSRequest {
+		return TTSRequest{Action: "tts", Text: "你好", Voice: "xiaoyun", Speed: 1, Pitch: 1, Volume: 1, SampleRate: 8000}
+	}
+	with := func(edit func(*TTSRequest)) TTSRequest {
+		req := base()
+		edit(&req)
+		return req
+	}
+	strict := *DefaultConfig()
+	strict.VoiceSampleRatePolicy = SampleRatePolicyStrict
+	debug := *DefaultConfig()
+	debug.DebugMode = true
+	prompts := *DefaultConfig()
+	prompts.PromptDir = promptDir
+
+	tests := []struct {
+		name string
+		req  TTSRequest
+		cfg  *Config // nil 表示 DefaultConfig
+		code string  // 空表示校验通过
+	}{
+		{"valid", base(), nil, ""},
+		{"default voice", with(func(r *TTSRequest) { r.Voice = "default" }), nil, ""},
+		{"empty text", with(func(r *TTSRequest) { r.Text = "" }), nil, "TEXT_EMPTY"},
+		{"blank text", with(func(r *TTSRequest) { r.Text = " \n\t\u200b" }), nil, "TEXT_EMPTY"},
+		{"text too long", with(func(r *TTSRequest) { r.Text = strings.Repeat("字", DefaultConfig().MaxTextRunes+1) }), nil, "TEXT_TOO_LONG"},
+		{"text at limit", with(func(r *TTSRequest) { r.Text = strings.Repeat("字", DefaultConfig().MaxTextRunes) }), nil, ""},
+		{"speaker plain text", with(func(r *TTSRequest) { r.Text = "<speaker>张三</speaker> 说你好" }), nil, ""},
+		{"unknown encoding", with(func(r *TTSRequest) { r.Encoding = "mp3" }), nil, "UNSUPPORTED_ENCODING"},
+		{"unknown endian", with(func(r *TTSRequest) { r.Endian = "middle" }), nil, "INVALID_REQUEST"},
+		{"plugin format", with(func(r *TTSRequest) { r.Format = FormatPCM }), nil, ""},
+		{"unknown format", with(func(r *TTSRequest) { r.Format = "wav" }), nil, "INVALID_REQUEST"},
+		{"unknown voice", with(func(r *TTSRequest) { r.Voice = "nobody" }), nil, "VOICE_NOT_FOUND"},
+		{"strict sample rate", with(func(r *TTSRequest) { r.SampleRate = 48000 }), &strict, "SAMPLE_RATE_UNSUPPORTED_FOR_VOICE"},
+		{"resampled sample rate", with(func(r *TTSRequest) { r.SampleRate = 48000 }), nil, ""},
+		{"unknown framing", with(func(r *TTSRequest) { r.Framing = "mpeg" }), nil, "INVALID_REQUEST"},
+		{"jitter without debug", with(func(r *TTSRequest) { r.JitterMs = 5 }), nil, "INVALID_REQUEST"},
+		{"jitter out of range", with(func(r *TTSRequest) { r.JitterMs = MAX_JITTER_MS + 1 }), &debug, "PARAMETER_OUT_OF_RANGE"},
+		{"drop every frame", with(func(r *TTSRequest) { r.DropFrameEveryN = 1 }), &debug, "PARAMETER_OUT_OF_RANGE"},
+		{"speed below range", with(func(r *TTSRequest) { r.Speed = MIN_SPEED - 0.1 }), nil, "PARAMETER_OUT_OF_RANGE"},
+		{"speed at max", with(func(r *TTSRequest) { r.Speed = MAX_SPEED }), nil, ""},
+		{"negative pitch", with(func(r *TTSRequest) { r.Pitch = -1 }), nil, "PARAMETER_OUT_OF_RANGE"},
+		{"volume above range", with(func(r *TTSRequest) { r.Volume = 50 }), nil, "PARAMETER_OUT_OF_RANGE"},
+		{"frame_ms too long", with(func(r *TTSRequest) { r.FrameMs = MAX_FRAME_MS + 1 }), nil, "PARAMETER_OUT_OF_RANGE"},
+		{"lead silence too long", with(func(r *TTSRequest) { r.LeadSilenceMs = MAX_SILENCE_MS + 1 }), nil, "PARAMETER_OUT_OF_RANGE"},
+		{"negative sample rate", with(func(r *TTSRequest) { r.SampleRate = -8000 }), nil, "PARAMETER_OUT_OF_RANGE"},
+		{"sample rate too high", with(func(r *TTSRequest) { r.SampleRate = MAX_SAMPLE_RATE + 1 }), nil, "PARAMETER_OUT_OF_RANGE"},
+		{"three channels", with(func(r *TTSRequest) { r.Channels = 3 }), nil, "PARAMETER_OUT_OF_RANGE"},
+		{"packetization conflicts", with(func(r *TTSRequest) { r.PacketizationMs, r.FrameMs = 20, 30 }), nil, "INVALID_REQUEST"},
+		{"packetization fraction", with(func(r *TTSRequest) { r.SampleRate, r.PacketizationMs = 22050, 7 }), nil, "PARAMETER_OUT_OF_RANGE"},
+		{"segments with text", with(func(r *TTSRequest) { r.Segments = []TTSSegment{{Text: "a"}} }), nil, "INVALID_REQUEST"},
+		{"segment blank text", with(func(r *TTSRequest) { r.Text, r.Segments = "", []TTSSegment{{Text: " "}} }), nil, "TEXT_EMPTY"},
+		{"segment missing prompt", with(func(r *TTSRequest) { r.Text, r.Segments = "", []TTSSegment{{Prompt: "missing"}} }), &prompts, "PROMPT_NOT_FOUND"},
+		{"segment prompt", with(func(r *TTSRequest) { r.Text, r.Segments = "", []TTSSegment{{Text: "你有"}, {Prompt: "welcome"}} }), &prompts, ""},
+		{"convert", with(func(r *TTSRequest) { r.Action, r.Text, r.InputSampleRate = "convert", "", 16000 }), nil, ""},
+		{"convert with text", with(func(r *TTSRequest) { r.Action, r.InputSampleRate = "convert", 16000 }), nil, "INVALID_REQUEST"},
+		{"convert input rate", with(func(r *TTSRequest) { r.Action, r.Text, r.InputSampleRate = "convert", "", 12345 }), nil, "SAMPLE_RATE_UNSUPPORTED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			if cfg == nil {
+				cfg = DefaultConfig()
+			}
+			errResp := validateTTSRequest(tt.req, *cfg)
+			switch {
+			case tt.code == "" && errResp != nil:
+				t.Fatalf("validateTTSRequest = %+v, want nil", *errResp)
+			case tt.code != "" && errResp == nil:
+				t.Fatalf("validateTTSRequest = nil, want %s", tt.code)
+			case tt.code != "" && errResp.Code != tt.code:
+				t.Fatalf("validateTTSRequest code = %s (%s), want %s", errResp.Code, errResp.Message, tt.code)
+			}
+		})
+	}
+}
+
+func TestCheckTTSParamsBoundaries(t *testing.T) {
+	tests := []struct {
+		field string
+		value float64
+		ok    bool
+	}{
+		{"speed", MIN_SPEED, true},
+		{"speed", MAX_SPEED, true},
+		{"speed", MIN_SPEED - 0.01, false},
+		{"speed", MAX_SPEED + 0.01, false},
+		{"speed", -1, false},
+		{"speed", math.NaN(), false},
+		{"pitch", MIN_PITCH, true},
+		{"pitch", MAX_PITCH, true},
+		{"pitch", MIN_PITCH - 0.01, false},
+		{"pitch", MAX_PITCH + 0.01, false},
+		{"pitch", -0.5, false},
+		{"volume", MAX_VOLUME, true},
+		{"volume", 0.01, true},
+		{"volume", MAX_VOLUME + 0.01, false},
+		{"volume", -0.1, false},
+	}
+	for _, tt := range tests {
+		req := TTSRequest{Speed: 1, Pitch: 1, Volume: 1}
+		switch tt.field {
+		case "speed":
+			req.Speed = tt.value
+		case "pitch":
+			req.Pitch = tt.value
+		case "volume":
+			req.Volume = tt.value
+		}
+		errResp := checkTTSParams(req, DefaultConfig())
+		if tt.ok {
+			if errResp != nil {
+				t.Errorf("%s=%g: checkTTSParams = %+v, want nil", tt.field, tt.value, *errResp)
+			}
+			continue
+		}
+		if errResp == nil || errResp.Code != "PARAMETER_OUT_OF_RANGE" || !strings.HasPrefix(errResp.Message, tt.field+" ") {
+			t.Errorf("%s=%g: checkTTSParams = %+v, want PARAMETER_OUT_OF_RANGE naming %s", tt.field, tt.value, errResp, tt.field)
+		}
+	}
+}
+
+func TestASRMaxAudioBytes(t *testing.T) {
+	setTestConfig(t, func(c *Config) { c.MaxAudioBytes = 1000 })
+	conn := dialTestWS(t, handleASR)
+
+	writeJSONMessage(t, conn, map[string]interface{}{"action": "start", "sample_rate": 8000})
+	frame := make([]byte, 400)
+	for i := 0; i < 3; i++ {
+		if err := conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if m := readJSONMessage(t, conn); m["code"] != "AUDIO_TOO_LONG" {
+		t.Fatalf("response = %v, want AUDIO_TOO_LONG", m)
+	}
+	code, reason := readUntilClose(t, conn)
+	if code != websocket.CloseMessageTooBig || reason != CLOSE_REASON_AUDIO_TOO_LONG {
+		t.Fatalf("close = %d %q, want %d %q", code, reason, websocket.CloseMessageTooBig, CLOSE_REASON_AUDIO_TOO_LONG)
+	}
+}
+
+func TestASRWithinMaxAudioBytes(t *testing.T) {
+	setTestConfig(t, func(c *Config) { c.MaxAudioBytes = 1000 })
+	conn := dialTestWS(t, handleASR)
+
+	writeJSONMessage(t, conn, map[string]interface{}{"action": "start", "sample_rate": 8000})
+	if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, 1000)); err != nil {
+		t.Fatal(err)
+	}
+	writeJSONMessage(t, conn, map[string]interface{}{"action": "end"})
+	if data := readTextMessage(t, conn); !strings.Contains(string(data), "<result") {
+		t.Fatalf("response = %s, want NLSML result", data)
+	}
+}
+
+func BenchmarkSynthesize(b *testing.B) {
+	setTestConfig(b, nil)
+	realtime := false
+	req := TTSRequest{Text: strings.Repeat("测试", 10), Voice: "xiaoyun", SampleRate: 16000, Realtime: &realtime}
+	ctx := withLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	engine := &TTSEngine{NativeSampleRate: TTS_NATIVE_SAMPLE_RATE}
+	frames := 0
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := engine.SynthesizeContext(ctx, req, func([]byte) { frames++ }, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(frames)/float64(b.N), "frames/op")
+}
+
+// BenchmarkBinaryFrameThroughput 经真实升级的连接发送 TTS 音频帧, 比较读写缓冲区配置下的帧速率
+func BenchmarkBinaryFrameThroughput(b *testing.B) {
+	// 48kHz 100ms 的 pcm16 帧 (9600 字节), 大于默认 4096 字节的写缓冲
+	frame := make([]byte, 48000*100/1000*2)
+	for _, bc := range []struct {
+		name string
+		edit func(c *Config)
+	}{
+		{"default", func(c *Config) {}},
+		{"buffers_16k", func(c *Config) { c.ReadBufferSize, c.WriteBufferSize = 16384, 16384 }},
+		{"write_buffer_pool", func(c *Config) { c.WriteBufferPool = true }},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			c := DefaultConfig()
+			bc.edit(c)
+			u := newUpgrader(c)
+			frames := b.N
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, err := u.Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				for i := 0; i < frames; i++ {
+					if err := conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+						return
+					}
+				}
+			}))
+			defer srv.Close()
+			dialer := websocket.Dialer{ReadBufferSize: c.ReadBufferSize}
+			conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer conn.Close()
+
+			b.SetBytes(int64(len(frame)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "frames/s")
+		})
+	}
+}
+
+// serialRecognizer 记录 Recognize 的调用, 并检测是否有并发调用
+type serialRecognizer struct {
+	inFlight   atomic.Int32
+	concurrent atomic.Bool
+	mu         sync.Mutex
+	calls      []int // 每次调用的音频字节数
+	slow       time.Duration
+}
+
+func (r *serialRecognizer) Recognize(audio []byte, sampleRate int) (string, error) {
+	if r.inFlight.Add(1) > 1 {
+		r.concurrent.Store(true)
+	}
+	defer r.inFlight.Add(-1)
+	time.Sleep(r.slow)
+	r.mu.Lock()
+	r.calls = append(r.calls, len(audio))
+	r.mu.Unlock()
+	return (&ASREngine{}).GenerateNLSML("你好", 0.9), nil
+}
+
+func TestASREndThenImmediateClose(t *testing.T) {
+	setTestConfig(t, nil)
+	recognizer := &serialRecognizer{slow: 50 * time.Millisecond}
+	prev := asrEngine
+	asrEngine = recognizer
+	t.Cleanup(func() { asrEngine = prev })
+
+	done := make(chan struct{})
+	conn := dialTestWS(t, func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		handleASR(w, r)
+	})
+	writeJSONMessage(t, conn, map[string]interface{}{"action": "start", "sample_rate": 8000})
+	if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, 1600)); err != nil {
+		t.Fatal(err)
+	}
+	writeJSONMessage(t, conn, map[string]interface{}{"action": "end"})
+	// 紧接着发送尚未识别的音频并断开, 收尾识别须等 end 的识别结束后才执行
+	if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, 800)); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handleASR did not return after the connection closed")
+	}
+	if recognizer.concurrent.Load() {
+		t.Fatal("Recognize ran concurrently")
+	}
+	recognizer.mu.Lock()
+	defer recognizer.mu.Unlock()
+	total := 0
+	for _, n := range recognizer.calls {
+		total += n
+	}
+	if len(recognizer.calls) == 0 || recognizer.calls[0] != 1600 || total != 2400 {
+		t.Fatalf("Recognize calls = %v, want the 1600 bytes before end first and 2400 bytes in total", recognizer.calls)
+	}
+}
+
+// synthesizeSamples 非实时合成 req, 返回每帧的字节数与解码后的全部采样 (pcm16 Little-Endian)
+func synthesizeSamples(t *testing.T, engine *TTSEngine, req TTSRequest) ([]int, []int16) {
+	t.Helper()
+	realtime := false
+	req.Realtime = &realtime
+	ctx := withLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	var frames []int
+	var samples []int16
+	err := engine.SynthesizeContext(ctx, req, func(frame []byte) {
+		frames = append(frames, len(frame))
+		samples = append(samples, decodeFrameSamples(frame, EncodingPCM16, EndianLittle)...)
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frames, samples
+}
+
+func TestSynthesizeSilencePadding(t *testing.T) {
+	setTestConfig(t, nil)
+	engine := &TTSEngine{}
+	req := TTSRequest{Text: "你好", Voice: "xiaoyun", SampleRate: 8000}
+	_, plain := synthesizeSamples(t, engine, req)
+
+	req.LeadSilenceMs, req.TrailSilenceMs = 100, 70
+	frames, padded := synthesizeSamples(t, engine, req)
+	lead, trail := 8000*100/1000, 8000*70/1000
+	if len(padded) != lead+len(plain)+trail {
+		t.Fatalf("got %d samples, want %d lead + %d speech + %d trail", len(padded), lead, len(plain), trail)
+	}
+	for i, s := range padded[:lead] {
+		if s != 0 {
+			t.Fatalf("lead silence sample %d = %d, want 0", i, s)
+		}
+	}
+	for i, s := range padded[len(padded)-trail:] {
+		if s != 0 {
+			t.Fatalf("trail silence sample %d = %d, want 0", i, s)
+		}
+	}
+	for i := range plain {
+		if padded[lead+i] != plain[i] {
+			t.Fatalf("speech sample %d = %d, want %d (unchanged by padding)", i, padded[lead+i], plain[i])
+		}
+	}
+
+	// 帧大小与 frame_ms 一致, 只有最后一帧可以不满
+	frameBytes := 8000 * DEFAULT_FRAME_MS / 1000 * 2
+	for i, n := range frames[:len(frames)-1] {
+		if n != frameBytes {
+			t.Fatalf("frame %d is %d bytes, want %d", i, n, frameBytes)
+		}
+	}
+}
+
+func TestTTSMaxTextRunes(t *testing.T) {
+	setTestConfig(t, func(c *Config) { c.MaxTextRunes = 10 })
+	conn := dialTestWS(t, handleTTS)
+
+	// 按字符而非字节计数: 10 个汉字为 30 字节, 仍在限制内
+	realtime := false
+	writeJSONMessage(t, conn, TTSRequest{Action: "tts", Text: strings.Repeat("字", 10), Realtime: &realtime})
+	for {
+		if m := readJSONMessage(t, conn); m["code"] != nil {
+			t.Fatalf("response = %v, want synthesis", m)
+		} else if m["status"] == "complete" {
+			break
+		}
+	}
+
+	writeJSONMessage(t, conn, TTSRequest{Action: "tts", Text: strings.Repeat("字", 11), Realtime: &realtime})
+	m := readJSONMessage(t, conn)
+	if m["code"] != "TEXT_TOO_LONG" || m["message"] != "Text exceeds 10 characters (got 11)" {
+		t.Fatalf("response = %v, want TEXT_TOO_LONG with limit and length", m)
+	}
+}
+
+func TestTTSEngineToneParameters(t *testing.T) {
+	setTestConfig(t, nil)
+	req := TTSRequest{Text: "abc", Voice: "xiaoyun", SampleRate: 8000}
+
+	// 默认时长模型: 每字符 DEFAULT_CHAR_DURATION_MS
+	const defaultSamples = int(3 * 8000 * DEFAULT_CHAR_DURATION_MS / 1000)
+	if _, samples := synthesizeSamples(t, &TTSEngine{}, req); len(samples) != defaultSamples {
+		t.Fatalf("default engine: %d samples, want %d", len(samples), defaultSamples)
+	}
+
+	engine := &TTSEngine{ToneFrequency: 1000, CharDurationMs: 100, Amplitude: 0.5}
+	frames, samples := synthesizeSamples(t, engine, req)
+	if len(samples) != 2400 || len(frames) != 15 {
+		t.Fatalf("got %d samples in %d frames, want 2400 in 15", len(samples), len(frames))
+	}
+	// 8kHz 下 1000Hz 正弦波每 8 个采样一个周期, 第 2 个采样为峰值
+	const peak = 16383 // 32767 × 0.5
+	for i, want := range []int{0, peak * 7071 / 10000, peak, peak * 7071 / 10000, 0} {
+		if diff := int(samples[i]) - want; diff > 1 || diff < -1 {
+			t.Fatalf("sample %d = %d, want %d", i, samples[i], want)
+		}
+	}
+	if samples[8+2] != samples[2] {
+		t.Fatalf("period: sample 10 = %d, want %d", samples[10], samples[2])
+	}
+
+	req.Speed = 2
+	if _, samples := synthesizeSamples(t, engine, req); len(samples) != 1200 {
+		t.Fatalf("speed 2: %d samples, want 1200", len(samples))
+	}
+}
+
+func TestIsBlankText(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"", true},
+		{"   ", true},
+		{"\n\t", true},
+		{"\u200b", true},
+		{"\u200b\u200c\u200d\ufeff", true},
+		{" \u3000\r\n", true}, // 全角空格
+		{"\x00\x07", true},
+		{"你", false},
+		{" a ", false},
+		{"\u200b1", false},
+		{"。", false},
+	}
+	for _, tt := range tests {
+		if got := isBlankText(tt.text); got != tt.want {
+			t.Errorf("isBlankText(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTTSBlankTextRejected(t *testing.T) {
+	setTestConfig(t, nil)
+	conn := dialTestWS(t, handleTTS)
+	for _, text := range []string{"   ", "\n\t", "\u200b\u200b"} {
+		writeJSONMessage(t, conn, TTSRequest{Action: "tts", Text: text})
+		if m := readJSONMessage(t, conn); m["code"] != "TEXT_EMPTY" {
+			t.Errorf("text %q: response = %v, want TEXT_EMPTY", text, m)
+		}
+	}
+}
+
+func TestASRStrictProtocolRejectsIllegalTransitions(t *testing.T) {
+	start := map[string]interface{}{"action": "start", "sample_rate": 8000}
+	// 识别超时 100ms (1600 字节) 后出结果, 进入 finalizing
+	startWithTimeout := map[string]interface{}{"action": "start", "sample_rate": 8000, "recognition_timeout_ms": 100}
+	recognize := map[string]interface{}{"action": "recognize", "audio_base64": "AAAA"}
+	recognizeURL := map[string]interface{}{"action": "recognize_url", "url": "http://127.0.0.1:1/a.wav"}
+
+	tests := []struct {
+		name     string
+		setup    []interface{} // JSON 消息或 []byte 音频
+		finalize bool          // setup 后等待识别结果
+		message  interface{}
+		want     string
+	}{
+		{"audio in idle", nil, false, []byte{0, 0}, "audio not allowed in state 'idle'"},
+		{"end in idle", nil, false, map[string]interface{}{"action": "end"}, "end not allowed in state 'idle'"},
+		{"dtmf in idle", nil, false, map[string]interface{}{"action": "dtmf", "digit": "5"}, "dtmf not allowed in state 'idle'"},
+		{"start in recognizing", []interface{}{start}, false, start, "start not allowed in state 'recognizing'"},
+		{"recognize in recognizing", []interface{}{start}, false, recognize, "recognize not allowed in state 'recognizing'"},
+		{"recognize_url in recognizing", []interface{}{start}, false, recognizeURL, "recognize_url not allowed in state 'recognizing'"},
+		{"recognize in finalizing", []interface{}{startWithTimeout, make([]byte, 1600)}, true, recognize,
+			"recognize not allowed in state 'finalizing'"},
+		{"recognize_url in finalizing", []interface{}{startWithTimeout, make([]byte, 1600)}, true, recognizeURL,
+			"recognize_url not allowed in state 'finalizing'"},
+	}
+	send := func(t *testing.T, conn *websocket.Conn, m interface{}) {
+		t.Helper()
+		if audio, ok := m.([]byte); ok {
+			if err := conn.WriteMessage(websocket.BinaryMessage, audio); err != nil {
+				t.Fatal(err)
+			}
+			return
+		}
+		writeJSONMessage(t, conn, m)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestConfig(t, func(c *Config) { c.StrictASRProtocol = true })
+			conn := dialTestWS(t, handleASR)
+			for _, m := range tt.setup {
+				send(t, conn, m)
+			}
+			if tt.finalize {
+				if data := readTextMessage(t, conn); !strings.Contains(string(data), "<result") {
+					t.Fatalf("setup response = %s, want NLSML result", data)
+				}
+			}
+			send(t, conn, tt.message)
+			m := readJSONMessage(t, conn)
+			if m["code"] != "PROTOCOL_ERROR" || m["message"] != tt.want {
+				t.Fatalf("response = %v, want PROTOCOL_ERROR %q", m, tt.want)
+			}
+		})
+	}
+}
+
+func TestASRLenientProtocolAcceptsEndInIdle(t *testing.T) {
+	setTestConfig(t, nil)
+	conn := dialTestWS(t, handleASR)
+	writeJSONMessage(t, conn, map[string]interface{}{"action": "end"})
+	// 宽松模式下 end 不报错; 之后的正常识别不受影响
+	writeJSONMessage(t, conn, map[string]interface{}{"action": "start", "sample_rate": 8000})
+	if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, 1600)); err != nil {
+		t.Fatal(err)
+	}
+	writeJSONMessage(t, conn, map[string]interface{}{"action": "end"})
+	if data := readTextMessage(t, conn); !strings.Contains(string(data), "<result") {
+		t.Fatalf("response = %s, want NLSML result", data)
+	}
+}
+
+func TestTTSValidateAction(t *testing.T) {
+	setTestConfig(t, nil)
+	conn := dialTestWS(t, handleTTS)
+
+	tests := []struct {
+		message string
+		code    string // 空表示 valid
+	}{
+		{`{"action":"validate","text":"你好"}`, ""},
+		{`{"action":"validate","text":"<speak>你好<break time=\"200ms\"/></speak>","voice":"default"}`, ""},
+		{`{"action":"validate","text":""}`, "TEXT_EMPTY"},
+		{`{"action":"validate","text":"你好","voice":"nobody"}`, "VOICE_NOT_FOUND"},
+		{`{"action":"validate","text":"你好","encoding":"mp3"}`, "UNSUPPORTED_ENCODING"},
+		{`{"action":"validate","text":"你好","speed":9}`, "PARAMETER_OUT_OF_RANGE"},
+		{`{"action":"validate","text":"你好","profile":"missing"}`, "PROFILE_NOT_FOUND"},
+		{`{"action":"validate","text":"你好","sample_rate":"8000"}`, "INVALID_REQUEST"},
+	}
+	for _, tt := range tests {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(tt.message)); err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if messageType != websocket.TextMessage {
+			t.Fatalf("%s: got a binary frame, validate must not synthesize", tt.message)
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(data, &m); err != nil {
+			t.Fatal(err)
+		}
+		if tt.code == "" && (m["status"] != "valid" || m["code"] != nil) {
+			t.Errorf("%s: response = %v, want valid", tt.message, m)
+		}
+		if tt.code != "" && m["code"] != tt.code {
+			t.Errorf("%s: response = %v, want %s", tt.message, m, tt.code)
+		}
+	}
+}
+
+func TestTTSStreamQueueFull(t *testing.T) {
+	setTestConfig(t, func(c *Config) { c.StreamQueueSize = 2 })
+	prev := authenticator
+	authenticator = nil
+	t.Cleanup(func() { authenticator = prev })
+	conn := dialTestWS(t, handleTTS)
+
+	// 实时合成每段约 1.2s, 首段开始发送音频后排队的段在测试期间不会被取走
+	chunk := TTSRequest{Action: "tts", Stream: true, Text: "你好你好你好"}
+	writeJSONMessage(t, conn, chunk)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		messageType, _, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if messageType == websocket.BinaryMessage {
+			break
+		}
+	}
+	for i := 0; i < 5; i++ {
+		writeJSONMessage(t, conn, chunk)
+	}
+	rejected := 0
+	for rejected < 3 {
+		m := readJSONMessage(t, conn)
+		if m["code"] == nil {
+			continue
+		}
+		if m["code"] != "QUEUE_FULL" || m["message"] != "Stream queue full (2 chunks)" {
+			t.Fatalf("response = %v, want QUEUE_FULL", m)
+		}
+		rejected++
+	}
+
+	w := statsRequest("127.0.0.1:4321", "")
+	var resp StatsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	depth := int64(-1)
+	for _, s := range resp.Sessions {
+		if s.Endpoint == "tts" {
+			depth = s.QueueDepth
+		}
+	}
+	if depth != 2 {
+		t.Fatalf("/stats queue_depth = %d, want 2", depth)
+	}
+	writeJSONMessage(t, conn, TTSRequest{Action: "stop"})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"math"
+	"unicode"
+)
+
+// WordMark 词级时间标记, 以文本消息发送
+//
+// offset_ms 为该词开始播放的位置。标记在包含该位置的音频帧之前发送,
+// 真实引擎可直接构造 WordMark 并通过 sendEvent 提供自己的时间信息。
+type WordMark struct {
+	Type     string `json:"type"` // 固定 "mark"
+	Word     string `json:"word"`
+	OffsetMs int    `json:"offset_ms"`
+}
+
+// SSMLMark SSML <mark name=".."/> 的到达事件, 与 WordMark 同为 "mark" 类型, 以 name 区分
+//
+// offset_ms 为标记在音频中的位置, 按文档顺序在包含该位置的音频帧之前发送;
+// 位于音频末尾的标记在最后一帧之后发送。
+type SSMLMark struct {
+	Type     string `json:"type"` // 固定 "mark"
+	Name     string `json:"name"`
+	OffsetMs int    `json:"offset_ms"`
+}
+
+// FrameMeta 单帧的能量信息, frame_meta 开启时在对应的音频帧之前发送, 用于客户端绘制波形
+//
+// seq 为帧在本次请求中的序号 (从 0 开始, 续传时接着原请求计数);
+// rms 与 peak 按编码前的 16-bit 采样计算, 归一化到 0~1。
+type FrameMeta struct {
+	Type string  `json:"type"` // 固定 "frame_meta"
+	Seq  int     `json:"seq"`
+	RMS  float64 `json:"rms"`
+	Peak float64 `json:"peak"`
+}
+
+// newFrameMeta 计算一帧采样的 RMS 与峰值, 保留 4 位小数以减小消息体积
+func newFrameMeta(seq int, samples []int16) FrameMeta {
+	var sum, peak float64
+	for _, s := range samples {
+		v := math.Abs(float64(s))
+		sum += v * v
+		if v > peak {
+			peak = v
+		}
+	}
+	rms := 0.0
+	if len(samples) > 0 {
+		rms = math.Sqrt(sum / float64(len(samples)))
+	}
+	round := func(v float64) float64 {
+		return math.Round(math.Min(v/32768, 1)*1e4) / 1e4
+	}
+	return FrameMeta{Type: "frame_meta", Seq: seq, RMS: round(rms), Peak: round(peak)}
+}
+
+// PROGRESS_STEP_PERCENT 合成进度事件的间隔 (百分点)
+const PROGRESS_STEP_PERCENT = 10
+
+// ProgressEvent 合成进度, progress 开启时每完成 PROGRESS_STEP_PERCENT 发送一次
+//
+// percent 为已发送音频占全部音频的百分比, elapsed_ms 为合成开始以来的时间。
+// 事件在使进度越过该百分比的音频帧之后发送。
+type ProgressEvent struct {
+	Type      string `json:"type"` // 固定 "progress"
+	Percent   int    `json:"percent"`
+	ElapsedMs int64  `json:"elapsed_ms"`
+}
+
+// wordSpan 文本中的一个词及其起始字符下标
+type wordSpan struct {
+	word  string
+	index int // 以 rune 计
+}
+
+// splitWords 切分文本: 汉字逐字成词, 字母数字连续成词, 空白与标点跳过
+func splitWords(text string) []wordSpan {
+	var words []wordSpan
+	runes := []rune(text)
+	start := -1
+
+	for i, r := range runes {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			if start >= 0 {
+				words = append(words, wordSpan{string(runes[start:i]), start})
+				start = -1
+			}
+			words = append(words, wordSpan{string(r), i})
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if start < 0 {
+				start = i
+			}
+		default:
+			if start >= 0 {
+				words = append(words, wordSpan{string(runes[start:i]), start})
+				start = -1
+			}
+		}
+	}
+	if start >= 0 {
+		words = append(words, wordSpan{string(runes[start:]), start})
+	}
+	return words
+}
+
+// pendingMark 尚未发送的标记及其采样偏移
+type pendingMark struct {
+	sample int
+	event  interface{}
+}
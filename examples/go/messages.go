@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// controlMessage 一种 action 的控制消息结构
+type controlMessage interface {
+	// requiredFields 除 action 外的必填字段 (JSON 名称), 内层为任选其一的字段
+	requiredFields() [][]string
+}
+
+// controlHandler 按 action 分派的控制消息处理函数, 解析或校验失败时返回错误响应
+type controlHandler func(message []byte) *ErrorResponse
+
+// handleAs 返回将消息解析为 M 并校验必填字段后交给 handle 的 controlHandler
+func handleAs[M controlMessage](handle func(msg M)) controlHandler {
+	return func(message []byte) *ErrorResponse {
+		var msg M
+		if errResp := decodeJSON(bytes.NewReader(message), &msg); errResp != nil {
+			return errResp
+		}
+		if errResp := checkRequiredFields(message, msg.requiredFields()); errResp != nil {
+			return errResp
+		}
+		handle(msg)
+		return nil
+	}
+}
+
+// decodeAction 解析消息的 action 用于分派, 其余字段由该 action 的消息结构校验
+func decodeAction(message []byte) (string, *ErrorResponse) {
+	var m struct {
+		Action *string `json:"action"`
+	}
+	if errResp := decode(bytes.NewReader(message), &m, false); errResp != nil {
+		return "", errResp
+	}
+	if m.Action == nil {
+		return "", missingFieldError([]string{"action"})
+	}
+	return *m.Action, nil
+}
+
+// decodeJSON 将 r 中的单个 JSON 对象解析到 v, 拒绝未知字段与类型不符的字段
+//
+// 错误为 INVALID_REQUEST, message 指出出错的字段, field 为其 JSON 名称 (嵌套字段以 "." 连接)。
+func decodeJSON(r io.Reader, v interface{}) *ErrorResponse {
+	return decode(r, v, true)
+}
+
+// decode 同 decodeJSON, strict 为 false 时忽略未知字段
+func decode(r io.Reader, v interface{}, strict bool) *ErrorResponse {
+	dec := json.NewDecoder(r)
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	err := dec.Decode(v)
+	if err == nil && dec.Decode(&json.RawMessage{}) != io.EOF {
+		err = errors.New("unexpected data after JSON object")
+	}
+	if err == nil {
+		return nil
+	}
+
+	resp := &ErrorResponse{Status: "error", Code: "INVALID_REQUEST"}
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr) && typeErr.Field == "":
+		resp.Message = "Message must be a JSON object"
+	case errors.As(err, &typeErr):
+		resp.Field = typeErr.Field
+		resp.Message = fmt.Sprintf("Field '%s' must be %s, got %s", typeErr.Field, jsonTypeName(typeErr.Type), typeErr.Value)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json 没有导出未知字段的错误类型
+		resp.Field = strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		resp.Message = fmt.Sprintf("Unknown field '%s'", resp.Field)
+	default:
+		resp.Message = fmt.Sprintf("JSON parse error: %v", err)
+	}
+	return resp
+}
+
+// jsonTypeName Go 类型对应的 JSON 类型描述, 用于错误消息
+func jsonTypeName(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	}
+	return t.String()
+}
+
+// checkRequiredFields 校验 message 带有 action 及 required 中的必填字段, 值为 null 视为缺失
+func checkRequiredFields(message []byte, required [][]string) *ErrorResponse {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(message, &fields); err != nil {
+		return &ErrorResponse{Status: "error", Code: "INVALID_REQUEST", Message: fmt.Sprintf("JSON parse error: %v", err)}
+	}
+	present := func(name string) bool {
+		v, ok := fields[name]
+		return ok && !bytes.Equal(bytes.TrimSpace(v), []byte("null"))
+	}
+
+	if !present("action") {
+		return missingFieldError([]string{"action"})
+	}
+	for _, anyOf := range required {
+		found := false
+		for _, name := range anyOf {
+			if present(name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return missingFieldError(anyOf)
+		}
+	}
+	return nil
+}
+
+// missingFieldError 缺少必填字段的错误响应, anyOf 有多个时表示任选其一
+func missingFieldError(anyOf []string) *ErrorResponse {
+	message := fmt.Sprintf("Missing required field '%s'", anyOf[0])
+	if len(anyOf) > 1 {
+		message = fmt.Sprintf("Missing required field: one of '%s'", strings.Join(anyOf, "', '"))
+	}
+	return &ErrorResponse{Status: "error", Code: "INVALID_REQUEST", Message: message, Field: anyOf[0]}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// pluginSpeakJSON websocket-synth 插件 (websocket_synth_engine.c) 每个 SPEAK 发送的请求
+const pluginSpeakJSON = `{"action":"tts","text":"你好","voice":"default","speed":1.00,"volume":1.00,` +
+	`"sample_rate":8000,"format":"pcm","session_id":"abc123"}`
+
+func TestDecodeJSONPluginPayload(t *testing.T) {
+	var req TTSRequest
+	if errResp := decodeJSON(strings.NewReader(pluginSpeakJSON), &req); errResp != nil {
+		t.Fatalf("decodeJSON(plugin payload) = %+v, want nil", *errResp)
+	}
+	if errResp := checkRequiredFields([]byte(pluginSpeakJSON), nil); errResp != nil {
+		t.Fatalf("checkRequiredFields(plugin payload) = %+v, want nil", *errResp)
+	}
+	if req.Format != FormatPCM || req.SampleRate != 8000 || req.SessionID != "abc123" {
+		t.Fatalf("decoded %+v", req)
+	}
+
+	cfg := DefaultConfig()
+	if errResp := applyTTSProfile(&req, cfg); errResp != nil {
+		t.Fatalf("applyTTSProfile = %+v", *errResp)
+	}
+	if errResp := validateTTSRequest(req, *cfg); errResp != nil {
+		t.Fatalf("validateTTSRequest(plugin payload) = %+v, want nil", *errResp)
+	}
+}
+
+func TestDecodeJSONUnknownField(t *testing.T) {
+	tests := []struct {
+		message string
+		v       interface{}
+		field   string
+	}{
+		{`{"action":"tts","text":"hi","sampel_rate":8000}`, &TTSRequest{}, "sampel_rate"},
+		{`{"action":"start","vad":true}`, &ASRStartControl{}, "vad"},
+		// 每个 action 只接受其自身的字段
+		{`{"action":"end","sample_rate":8000}`, &ASREndControl{}, "sample_rate"},
+	}
+	for _, tt := range tests {
+		errResp := decodeJSON(strings.NewReader(tt.message), tt.v)
+		want := "Unknown field '" + tt.field + "'"
+		if errResp == nil || errResp.Code != "INVALID_REQUEST" || errResp.Field != tt.field || errResp.Message != want {
+			t.Errorf("decodeJSON(%s) = %+v, want field %q message %q", tt.message, errResp, tt.field, want)
+		}
+	}
+}
+
+func TestDecodeAction(t *testing.T) {
+	// action 之外的字段留给该 action 的消息结构校验
+	if action, errResp := decodeAction([]byte(`{"action":"dtmf","digit":"5","extra":1}`)); errResp != nil || action != "dtmf" {
+		t.Fatalf("decodeAction = %q, %+v, want dtmf", action, errResp)
+	}
+	for message, want := range map[string]string{
+		`{"digit":"5"}`:   "Missing required field 'action'",
+		`{"action":null}`: "Missing required field 'action'",
+		`{"action":5}`:    "Field 'action' must be a string, got number",
+	} {
+		if _, errResp := decodeAction([]byte(message)); errResp == nil || errResp.Field != "action" || errResp.Message != want {
+			t.Errorf("decodeAction(%s) = %+v, want %q", message, errResp, want)
+		}
+	}
+}
+
+func TestDecodeJSONMistypedFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		v       interface{}
+		field   string
+		want    string
+	}{
+		{"string for int", `{"action":"tts","sample_rate":"8000"}`, &TTSRequest{}, "sample_rate",
+			"Field 'sample_rate' must be an integer, got string"},
+		{"fraction for int", `{"action":"tts","frame_ms":1.5}`, &TTSRequest{}, "frame_ms",
+			"Field 'frame_ms' must be an integer, got number 1.5"},
+		{"string for bool", `{"action":"tts","realtime":"yes"}`, &TTSRequest{}, "realtime",
+			"Field 'realtime' must be a boolean, got string"},
+		{"number for string", `{"action":"tts","text":123}`, &TTSRequest{}, "text",
+			"Field 'text' must be a string, got number"},
+		{"asr sample_rate", `{"action":"start","sample_rate":"16000"}`, &ASRStartControl{}, "sample_rate",
+			"Field 'sample_rate' must be an integer, got string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errResp := decodeJSON(strings.NewReader(tt.message), tt.v)
+			if errResp == nil {
+				t.Fatal("decodeJSON = nil, want error")
+			}
+			if errResp.Code != "INVALID_REQUEST" || errResp.Field != tt.field || errResp.Message != tt.want {
+				t.Fatalf("decodeJSON = %+v, want field %q message %q", *errResp, tt.field, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONMalformed(t *testing.T) {
+	for _, message := range []string{`[1,2]`, `{"action":"tts"`, `{"action":"tts"} {}`, `not json`} {
+		var req TTSRequest
+		errResp := decodeJSON(strings.NewReader(message), &req)
+		if errResp == nil || errResp.Code != "INVALID_REQUEST" || errResp.Field != "" {
+			t.Errorf("decodeJSON(%s) = %+v, want INVALID_REQUEST without field", message, errResp)
+		}
+	}
+}
+
+func TestHandleAsRequiredFields(t *testing.T) {
+	tests := []struct {
+		message string
+		handler controlHandler
+		field   string // 空表示校验通过
+		want    string
+	}{
+		{`{"digit":"5"}`, handleAs(func(ASRDTMFControl) {}), "action", "Missing required field 'action'"},
+		{`{"action":"dtmf"}`, handleAs(func(ASRDTMFControl) {}), "digit", "Missing required field 'digit'"},
+		{`{"action":"dtmf","digit":null}`, handleAs(func(ASRDTMFControl) {}), "digit", "Missing required field 'digit'"},
+		{`{"action":"dtmf","digit":"5"}`, handleAs(func(ASRDTMFControl) {}), "", ""},
+		{`{"action":"activate_grammar"}`, handleAs(func(ASRGrammarControl) {}), "grammar_uri",
+			"Missing required field 'grammar_uri'"},
+		{`{"action":"recognize_url"}`, handleAs(func(ASRRecognizeURLControl) {}), "url", "Missing required field 'url'"},
+		{`{"action":"recognize"}`, handleAs(func(ASRRecognizeControl) {}), "audio_base64",
+			"Missing required field 'audio_base64'"},
+		{`{"action":"define_grammar"}`, handleAs(func(ASRDefineGrammarControl) {}), "grammar",
+			"Missing required field: one of 'grammar', 'grammars'"},
+		{`{"action":"define_grammar","grammars":[]}`, handleAs(func(ASRDefineGrammarControl) {}), "", ""},
+		{`{"action":"start"}`, handleAs(func(ASRStartControl) {}), "", ""},
+		{`{"action":"dtmf","digit":5}`, handleAs(func(ASRDTMFControl) {}), "digit",
+			"Field 'digit' must be a string, got number"},
+	}
+	for _, tt := range tests {
+		errResp := tt.handler([]byte(tt.message))
+		if tt.field == "" {
+			if errResp != nil {
+				t.Errorf("handler(%s) = %+v, want nil", tt.message, *errResp)
+			}
+			continue
+		}
+		if errResp == nil || errResp.Code != "INVALID_REQUEST" || errResp.Field != tt.field || errResp.Message != tt.want {
+			t.Errorf("handler(%s) = %+v, want field %q message %q", tt.message, errResp, tt.field, tt.want)
+		}
+	}
+}
+
+func TestHandleAsDecodesMessage(t *testing.T) {
+	var got ASRRecognizeURLControl
+	handle := handleAs(func(control ASRRecognizeURLControl) { got = control })
+	if errResp := handle([]byte(`{"action":"recognize_url","url":"http://a/b.wav","sample_rate":16000,"alternatives":2}`)); errResp != nil {
+		t.Fatalf("handler = %+v", *errResp)
+	}
+	if got.URL != "http://a/b.wav" || got.SampleRate != 16000 || got.Alternatives != 2 {
+		t.Fatalf("decoded %+v", got)
+	}
+}
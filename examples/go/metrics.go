@@ -0,0 +1,62 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus 指标, 注册到默认 Registry, 由 /metrics 导出
+var (
+	ttsRequestsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tts_requests_total",
+		Help: "Total number of TTS synthesis requests.",
+	})
+
+	asrRequestsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "asr_requests_total",
+		Help: "Total number of ASR recognition requests.",
+	})
+
+	synthesisDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "tts_synthesis_duration_seconds",
+		Help:    "Wall-clock time spent synthesizing a request.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	})
+
+	audioBytesSent = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tts_audio_bytes_sent_total",
+		Help: "Total bytes of TTS audio frames sent to clients.",
+	})
+
+	recognitionLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "asr_recognition_latency_seconds",
+		Help:    "Time spent producing a recognition result.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	activeConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "websocket_active_connections",
+		Help: "Number of active websocket connections.",
+	}, []string{"endpoint"})
+
+	ttsCacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tts_cache_hits_total",
+		Help: "Total number of TTS requests served from the audio cache.",
+	})
+
+	ttsCacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tts_cache_misses_total",
+		Help: "Total number of TTS requests not found in the audio cache.",
+	})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Duration of HTTP requests, or connection lifetime for websocket upgrades.",
+		Buckets: []float64{0.01, 0.05, 0.25, 1, 5, 30, 120, 600, 3600},
+	}, []string{"path", "status"})
+
+	errorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "errors_total",
+		Help: "Total number of error responses sent to clients, by code.",
+	}, []string{"code"})
+)
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// withLogging 记录每个请求的方法、路径、来源、结果与耗时, 并计入 http_request_duration_seconds
+//
+// 指标的 path 标签为注册的 pattern 而非请求路径, 使 "/tts/" 等子树下的任意路径不会各自产生时间序列;
+// 处理函数可用 setRouteLabel 细分为配置中的路由。
+// WebSocket 连接在处理函数返回 (连接关闭) 时记录, 耗时即连接时长;
+// 升级成功的连接状态码记为 101, 升级失败时为 Upgrade 返回的错误状态码。
+func withLogging(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, route: pattern}
+		next(rec, r)
+		elapsed := time.Since(start)
+
+		status := rec.status
+		switch {
+		case rec.hijacked:
+			status = http.StatusSwitchingProtocols
+		case status == 0:
+			status = http.StatusOK
+		}
+		requestDuration.WithLabelValues(rec.route, strconv.Itoa(status)).Observe(elapsed.Seconds())
+
+		attrs := []any{"method", r.Method, "path", r.URL.Path, "remote", clientIP(r),
+			"origin", r.Header.Get("Origin"), "status", status, "duration", elapsed}
+		if isUpgradeRequest(r) {
+			attrs = append(attrs, "upgraded", rec.hijacked)
+		}
+		slog.Info("HTTP 请求", attrs...)
+	}
+}
+
+// isUpgradeRequest 判断是否为 WebSocket 升级请求
+func isUpgradeRequest(r *http.Request) bool {
+	return r.Header.Get("Upgrade") != ""
+}
+
+// statusRecorder 记录响应状态码, 并透传 WebSocket 升级所需的 Hijack
+type statusRecorder struct {
+	http.ResponseWriter
+	status   int
+	hijacked bool
+	route    string // 指标的 path 标签
+}
+
+// setRouteLabel 将请求在 http_request_duration_seconds 中的 path 标签设为 route, route 的取值须有限 (如来自配置)
+func setRouteLabel(w http.ResponseWriter, route string) {
+	if rec, ok := w.(*statusRecorder); ok {
+		rec.route = route
+	}
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// Hijack 交由底层 ResponseWriter 接管连接, websocket.Upgrader 依赖该接口
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		rec.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Flush 透传 http.Flusher
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap 供 http.ResponseController 访问底层 ResponseWriter
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
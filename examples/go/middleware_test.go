@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// requestDurationPaths 返回 http_request_duration_seconds 中出现的 path 标签
+func requestDurationPaths(t *testing.T) map[string]bool {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := map[string]bool{}
+	for _, f := range families {
+		if f.GetName() != "http_request_duration_seconds" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "path" {
+					paths[l.GetValue()] = true
+				}
+			}
+		}
+	}
+	return paths
+}
+
+func TestWithLoggingLabelsRoutePattern(t *testing.T) {
+	setTestConfig(t, nil)
+	ttsRoutes["engineA"] = &TTSEngine{}
+	defer delete(ttsRoutes, "engineA")
+
+	handler := withLogging("/tts/", handleTTSRoute)
+	for _, path := range []string{"/tts/random-1", "/tts/random-2/synthesize", "/tts/engineA/synthesize"} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	paths := requestDurationPaths(t)
+	for _, unwanted := range []string{"/tts/random-1", "/tts/random-2/synthesize", "/tts/random-2"} {
+		if paths[unwanted] {
+			t.Errorf("request path %q became a metric label", unwanted)
+		}
+	}
+	if !paths["/tts/"] {
+		t.Error("unknown routes not labelled with the /tts/ pattern")
+	}
+	if !paths["/tts/engineA/synthesize"] {
+		t.Errorf("configured route not labelled, labels: %v", paths)
+	}
+}
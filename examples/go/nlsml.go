@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// NLSML 输出格式
+const (
+	NLSMLFormatSimple = "simple" // 不带命名空间的 <result>, 置信度 0.00-1.00
+	NLSMLFormatV1     = "v1"     // MRCPv1 NLSML: <result> 带 grammar, 置信度为 0-100 的整数
+	NLSMLFormatMRCPv2 = "mrcpv2" // MRCPv2: <result> 带 xmlns 与 grammar, 置信度 0.00-1.00
+)
+
+// NLSML_NAMESPACE mrcpv2 格式 <result> 的默认命名空间
+const NLSML_NAMESPACE = "http://www.ietf.org/xml/ns/mrcpv2"
+
+// CompletionCause MRCP 识别完成原因
+type CompletionCause string
+
+const (
+	CauseSuccess            CompletionCause = "success"
+	CauseNoMatch            CompletionCause = "no-match"
+	CauseNoInputTimeout     CompletionCause = "no-input-timeout"
+	CauseRecognitionTimeout CompletionCause = "recognition-timeout"
+)
+
+// completionCodes 完成原因对应的 MRCP Completion-Cause 编号
+var completionCodes = map[CompletionCause]int{
+	CauseSuccess:            0,
+	CauseNoMatch:            1,
+	CauseNoInputTimeout:     2,
+	CauseRecognitionTimeout: 3,
+}
+
+// header 返回 Completion-Cause 头格式, 如 "001 no-match"
+func (c CompletionCause) header() string {
+	return fmt.Sprintf("%03d %s", completionCodes[c], c)
+}
+
+// ASRResult result_format 为 json 时的识别结果消息
+type ASRResult struct {
+	Status string          `json:"status"` // 固定为 "complete"
+	Cause  CompletionCause `json:"cause"`
+	NLSML  string          `json:"nlsml"`
+
+	Language string `json:"language,omitempty"` // 识别出的语种, 引擎不支持语种识别时省略
+
+	// 语音在识别音频中的起止位置 (speech_start_ms / speech_end_ms), 引擎不支持或非语音结果时省略
+	*SpeechSpan
+}
+
+// withCompletionCause 在 NLSML 的 <result> 上标注完成原因, success 时原样返回
+func withCompletionCause(nlsml string, cause CompletionCause) string {
+	if cause == CauseSuccess {
+		return nlsml
+	}
+	return strings.Replace(nlsml, "<result>",
+		fmt.Sprintf(`<result completion-cause="%s">`, cause.header()), 1)
+}
+
+// withLanguage 在 NLSML 的 <result> 上标注 xml:lang, language 为空时原样返回
+func withLanguage(nlsml, language string) string {
+	if language == "" {
+		return nlsml
+	}
+	return strings.Replace(nlsml, "<result",
+		fmt.Sprintf(`<result xml:lang="%s"`, xmlEscape(language)), 1)
+}
+
+// noResultNLSML 生成 no-match / no-input 的 NLSML
+//
+// 按 RFC 6787 以 <nomatch/> / <noinput/> 表示, completion-cause 属性
+// 对应 MRCP 的 Completion-Cause 头。
+func noResultNLSML(cause CompletionCause, grammarURI string) string {
+	element := "nomatch"
+	if cause == CauseNoInputTimeout {
+		element = "noinput"
+	}
+	return withCompletionCause(fmt.Sprintf(`<?xml version="1.0"?>
+<result>
+  <interpretation grammar="%s" confidence="0.00">
+    <input mode="speech"><%s/></input>
+  </interpretation>
+</result>`, xmlEscape(grammarURI), element), cause)
+}
+
+// nlsmlResult 解析识别结果时关心的字段
+type nlsmlResult struct {
+	Interpretations []struct {
+		Confidence float64 `xml:"confidence,attr"`
+	} `xml:"interpretation"`
+}
+
+// isNoMatch 判断识别结果是否应报告为 no-match
+//
+// 没有 <interpretation> (如不符合语法), 或 threshold > 0 且最佳置信度低于 threshold。
+// 结果无法解析时按原样返回, 不视为 no-match。
+func isNoMatch(result string, threshold float64) bool {
+	var r nlsmlResult
+	if err := xml.Unmarshal([]byte(result), &r); err != nil {
+		return false
+	}
+	if len(r.Interpretations) == 0 {
+		return true
+	}
+	best := 0.0
+	for _, in := range r.Interpretations {
+		if in.Confidence > best {
+			best = in.Confidence
+		}
+	}
+	return threshold > 0 && best < threshold
+}
+
+// dropLowConfidence 删除置信度低于 threshold 的 <interpretation>, 其余内容原样保留
+//
+// threshold <= 0 或结果无法解析时按原样返回; 调用方应先用 isNoMatch 排除全部低于阈值的情况。
+func dropLowConfidence(result string, threshold float64) string {
+	if threshold <= 0 {
+		return result
+	}
+
+	decoder := xml.NewDecoder(strings.NewReader(result))
+	var b strings.Builder
+	last := 0
+	for {
+		start := int(decoder.InputOffset())
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result
+		}
+		t, ok := tok.(xml.StartElement)
+		if !ok || t.Name.Local != "interpretation" {
+			continue
+		}
+		confidence, err := strconv.ParseFloat(ssmlAttr(t.Attr, "confidence"), 64)
+		if err != nil || confidence >= threshold {
+			if err := decoder.Skip(); err != nil {
+				return result
+			}
+			continue
+		}
+		if err := decoder.Skip(); err != nil {
+			return result
+		}
+		end := int(decoder.InputOffset())
+
+		// 连同所在行的缩进与换行一起删除
+		for start > last && (result[start-1] == ' ' || result[start-1] == '\t') {
+			start--
+		}
+		if end < len(result) && result[end] == '\n' {
+			end++
+		}
+		b.WriteString(result[last:start])
+		last = end
+	}
+	b.WriteString(result[last:])
+	return b.String()
+}
+
+// isSupportedNLSMLFormat 判断 nlsml_format 是否受支持
+func isSupportedNLSMLFormat(format string) bool {
+	switch format {
+	case NLSMLFormatSimple, NLSMLFormatV1, NLSMLFormatMRCPv2:
+		return true
+	}
+	return false
+}
+
+// formatNLSML 将引擎生成的 NLSML 转换为 format 格式, 须在补充 completion-cause / xml:lang 之后调用
+//
+// v1 与 mrcpv2 在 <result> 上补充首个 <interpretation> 的 grammar 作为默认值, mrcpv2 另加
+// xmlns; 置信度按格式重写并限制在有效范围内。simple 或结果无法解析时按原样返回。
+func formatNLSML(nlsml, format string) string {
+	if format != NLSMLFormatV1 && format != NLSMLFormatMRCPv2 {
+		return nlsml
+	}
+
+	// 第一遍: 取首个 <interpretation> 的 grammar (候选按置信度降序)
+	grammar := ""
+	decoder := xml.NewDecoder(strings.NewReader(nlsml))
+	for grammar == "" {
+		tok, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nlsml
+		}
+		if t, ok := tok.(xml.StartElement); ok && t.Name.Local == "interpretation" {
+			grammar = ssmlAttr(t.Attr, "grammar")
+		}
+	}
+
+	// 第二遍: 重写 <result> 与 <interpretation> 的开始标签, 其余内容原样保留
+	decoder = xml.NewDecoder(strings.NewReader(nlsml))
+	var b strings.Builder
+	last := 0
+	for {
+		start := int(decoder.InputOffset())
+		tok, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nlsml
+		}
+		t, ok := tok.(xml.StartElement)
+		if !ok || t.Name.Space != "" || (t.Name.Local != "result" && t.Name.Local != "interpretation") {
+			continue
+		}
+		end := int(decoder.InputOffset())
+		if t.Name.Local == "result" {
+			if format == NLSMLFormatMRCPv2 && ssmlAttr(t.Attr, "xmlns") == "" {
+				t.Attr = append([]xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: NLSML_NAMESPACE}}, t.Attr...)
+			}
+			if grammar != "" && ssmlAttr(t.Attr, "grammar") == "" {
+				t.Attr = append(t.Attr, xml.Attr{Name: xml.Name{Local: "grammar"}, Value: grammar})
+			}
+		} else {
+			for i, a := range t.Attr {
+				if a.Name.Space == "" && a.Name.Local == "confidence" {
+					t.Attr[i].Value = formatConfidence(a.Value, format)
+				}
+			}
+		}
+		b.WriteString(nlsml[last:start])
+		writeStartTag(&b, t, strings.HasSuffix(nlsml[start:end], "/>"))
+		last = end
+	}
+	b.WriteString(nlsml[last:])
+	return b.String()
+}
+
+// formatConfidence 按格式重写置信度: v1 为 0-100 的整数, mrcpv2 为 0.00-1.00; 无法解析时原样返回
+func formatConfidence(v, format string) string {
+	c, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return v
+	}
+	c = math.Max(0, math.Min(1, c))
+	if format == NLSMLFormatV1 {
+		return strconv.Itoa(int(math.Round(c * 100)))
+	}
+	return strconv.FormatFloat(c, 'f', 2, 64)
+}
+
+// writeStartTag 写出 RawToken 返回的开始标签, 保留属性的命名空间前缀
+func writeStartTag(b *strings.Builder, t xml.StartElement, selfClosing bool) {
+	b.WriteString("<" + rawName(t.Name))
+	for _, a := range t.Attr {
+		fmt.Fprintf(b, ` %s="%s"`, rawName(a.Name), xmlEscape(a.Value))
+	}
+	if selfClosing {
+		b.WriteString("/>")
+		return
+	}
+	b.WriteString(">")
+}
+
+// rawName RawToken 的名称, Space 为原始前缀
+func rawName(n xml.Name) string {
+	if n.Space == "" {
+		return n.Local
+	}
+	return n.Space + ":" + n.Local
+}
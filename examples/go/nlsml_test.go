@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/xml"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// parsedNLSML 测试中解析 NLSML 关心的字段
+type parsedNLSML struct {
+	XMLName         xml.Name `xml:"result"`
+	Grammar         string   `xml:"grammar,attr"`
+	Interpretations []struct {
+		Grammar    string `xml:"grammar,attr"`
+		Confidence string `xml:"confidence,attr"`
+		Instance   string `xml:"instance"`
+		Input      string `xml:"input"`
+	} `xml:"interpretation"`
+}
+
+func TestGenerateNLSMLEscapesText(t *testing.T) {
+	const text = `天气 < 20°C & 下雨 "</instance><x>"`
+	nlsml := (&ASREngine{}).GenerateNLSML(text, 0.9)
+
+	var r parsedNLSML
+	if err := xml.Unmarshal([]byte(nlsml), &r); err != nil {
+		t.Fatalf("NLSML is not well-formed: %v\n%s", err, nlsml)
+	}
+	if len(r.Interpretations) != 1 {
+		t.Fatalf("got %d interpretations, want 1\n%s", len(r.Interpretations), nlsml)
+	}
+	in := r.Interpretations[0]
+	if in.Instance != text || in.Input != text {
+		t.Fatalf("round-trip instance=%q input=%q, want %q", in.Instance, in.Input, text)
+	}
+}
+
+func TestGenerateNLSMLEscapesGrammarURI(t *testing.T) {
+	const uri = `builtin:grammar/x?a=1&b="2"`
+	nlsml := (&ASREngine{}).generateNLSML([]Candidate{{Text: "你好", Confidence: 0.5}}, 1, uri)
+
+	var r parsedNLSML
+	if err := xml.Unmarshal([]byte(nlsml), &r); err != nil {
+		t.Fatalf("NLSML is not well-formed: %v\n%s", err, nlsml)
+	}
+	if got := r.Interpretations[0].Grammar; got != uri {
+		t.Fatalf("grammar = %q, want %q", got, uri)
+	}
+}
+
+// checkNLSMLSchema 按 MRCP NLSML 的结构约束校验 nlsml, 返回解析结果
+//
+// 根元素为 <result> (mrcpv2 时位于 NLSML_NAMESPACE), 带 grammar 属性;
+// 每个 <interpretation> 有 grammar、按格式书写的 confidence 及 <instance>/<input>。
+func checkNLSMLSchema(t *testing.T, nlsml, format string) parsedNLSML {
+	t.Helper()
+	var r parsedNLSML
+	if err := xml.Unmarshal([]byte(nlsml), &r); err != nil {
+		t.Fatalf("NLSML is not well-formed: %v\n%s", err, nlsml)
+	}
+	wantSpace := ""
+	if format == NLSMLFormatMRCPv2 {
+		wantSpace = NLSML_NAMESPACE
+	}
+	if r.XMLName.Local != "result" || r.XMLName.Space != wantSpace {
+		t.Fatalf("root = {%s}%s, want {%s}result\n%s", r.XMLName.Space, r.XMLName.Local, wantSpace, nlsml)
+	}
+	if r.Grammar == "" {
+		t.Fatalf("<result> has no grammar attribute\n%s", nlsml)
+	}
+	confidence := regexp.MustCompile(`^(0\.\d\d|1\.00)$`)
+	if format == NLSMLFormatV1 {
+		confidence = regexp.MustCompile(`^(\d|[1-9]\d|100)$`)
+	}
+	for i, in := range r.Interpretations {
+		if in.Grammar == "" || in.Instance == "" || in.Input == "" {
+			t.Fatalf("interpretation %d incomplete: %+v\n%s", i, in, nlsml)
+		}
+		if !confidence.MatchString(in.Confidence) {
+			t.Fatalf("interpretation %d confidence %q not valid for %s\n%s", i, in.Confidence, format, nlsml)
+		}
+	}
+	return r
+}
+
+func TestFormatNLSMLMRCPv2(t *testing.T) {
+	engine := &ASREngine{}
+	nlsml := withLanguage(engine.GenerateNBestNLSML(engine.demoCandidates(), 0), "zh-CN")
+	out := formatNLSML(nlsml, NLSMLFormatMRCPv2)
+	r := checkNLSMLSchema(t, out, NLSMLFormatMRCPv2)
+	if r.Grammar != DEFAULT_GRAMMAR_URI || len(r.Interpretations) != 3 || r.Interpretations[0].Confidence != "0.95" {
+		t.Fatalf("formatNLSML = %+v\n%s", r, out)
+	}
+	if !strings.Contains(out, `xml:lang="zh-CN"`) {
+		t.Fatalf("xml:lang lost\n%s", out)
+	}
+}
+
+func TestFormatNLSMLV1(t *testing.T) {
+	nlsml := (&ASREngine{}).GenerateNLSML("你好", 0.857)
+	out := formatNLSML(nlsml, NLSMLFormatV1)
+	r := checkNLSMLSchema(t, out, NLSMLFormatV1)
+	if got, _ := strconv.Atoi(r.Interpretations[0].Confidence); got != 86 {
+		t.Fatalf("v1 confidence = %q, want 86\n%s", r.Interpretations[0].Confidence, out)
+	}
+	if strings.Contains(out, "xmlns") {
+		t.Fatalf("v1 output has a namespace\n%s", out)
+	}
+}
+
+func TestFormatNLSMLClampsConfidence(t *testing.T) {
+	nlsml := `<?xml version="1.0"?>
+<result>
+  <interpretation grammar="g" confidence="1.7"><instance>a</instance><input mode="speech">a</input></interpretation>
+  <interpretation grammar="g" confidence="-0.2"><instance>b</instance><input mode="speech">b</input></interpretation>
+</result>`
+	r := checkNLSMLSchema(t, formatNLSML(nlsml, NLSMLFormatMRCPv2), NLSMLFormatMRCPv2)
+	if r.Interpretations[0].Confidence != "1.00" || r.Interpretations[1].Confidence != "0.00" {
+		t.Fatalf("confidences = %q, %q, want 1.00, 0.00", r.Interpretations[0].Confidence, r.Interpretations[1].Confidence)
+	}
+}
+
+func TestFormatNLSMLSimpleUnchanged(t *testing.T) {
+	nlsml := (&ASREngine{}).GenerateNLSML("你好", 0.9)
+	if out := formatNLSML(nlsml, NLSMLFormatSimple); out != nlsml {
+		t.Fatalf("simple format changed the NLSML:\n%s", out)
+	}
+}
+
+func TestFormatNLSMLNoMatch(t *testing.T) {
+	out := formatNLSML(noResultNLSML(CauseNoMatch, "session:menu"), NLSMLFormatMRCPv2)
+	var r parsedNLSML
+	if err := xml.Unmarshal([]byte(out), &r); err != nil {
+		t.Fatalf("NLSML is not well-formed: %v\n%s", err, out)
+	}
+	if r.XMLName.Space != NLSML_NAMESPACE || r.Grammar != "session:menu" {
+		t.Fatalf("formatNLSML = %+v\n%s", r, out)
+	}
+	if !strings.Contains(out, `completion-cause="001 no-match"`) || !strings.Contains(out, "<nomatch/>") {
+		t.Fatalf("no-match details lost\n%s", out)
+	}
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// TextNormalizer 将某一语种的文本转写为朗读形式, 如展开数字、金额、日期与常见缩写
+type TextNormalizer func(text string) string
+
+var (
+	textNormalizersMu sync.RWMutex
+	// textNormalizers 按 BCP 47 主语种标签 ("zh"、"en") 索引
+	textNormalizers = map[string]TextNormalizer{
+		"zh": normalizeZh,
+		"en": normalizeEn,
+	}
+)
+
+// RegisterTextNormalizer 注册语种 lang (BCP 47 主标签, 如 "ja") 的文本规范化, 已存在时替换
+func RegisterTextNormalizer(lang string, n TextNormalizer) {
+	textNormalizersMu.Lock()
+	defer textNormalizersMu.Unlock()
+	textNormalizers[strings.ToLower(lang)] = n
+}
+
+// normalizeText 按语种规范化文本, lang 可带地区 ("zh-CN"); 未注册的语种原样返回
+func normalizeText(text, lang string) string {
+	primary, _, _ := strings.Cut(strings.ToLower(lang), "-")
+	textNormalizersMu.RLock()
+	n, ok := textNormalizers[primary]
+	textNormalizersMu.RUnlock()
+	if !ok {
+		return text
+	}
+	return n(text)
+}
+
+// normalizeTTSRequest 按需规范化请求的 text 与各 text 片段, 语种取自音色
+//
+// 请求的 normalize_text 优先于配置; 规范化在校验之后、缓存与合成之前进行,
+// 引擎 (及按字符数估算的时长) 看到的是规范化后的文本。
+func normalizeTTSRequest(req *TTSRequest, c *Config) {
+	enabled := c.NormalizeText
+	if req.NormalizeText != nil {
+		enabled = *req.NormalizeText
+	}
+	if !enabled {
+		return
+	}
+	id := req.Voice
+	if isDefaultVoice(id) {
+		id = c.DefaultVoice
+	}
+	voice, ok := lookupVoice(id)
+	if !ok {
+		return
+	}
+	req.Text = normalizeMarkup(req.Text, voice.Language)
+	for i := range req.Segments {
+		req.Segments[i].Text = normalizeMarkup(req.Segments[i].Text, voice.Language)
+	}
+}
+
+// normalizeMarkup 规范化纯文本或 SSML; SSML 只处理标签之间的文本,
+// 标签、实体引用 (&amp; 等) 与 <say-as> 中的内容保持不变, 交由引擎解释
+func normalizeMarkup(text, lang string) string {
+	if text == "" || !isSSML(text) {
+		return normalizeText(text, lang)
+	}
+
+	var b strings.Builder
+	sayAs := 0
+	for text != "" {
+		i := strings.IndexAny(text, "<&")
+		if i < 0 {
+			i = len(text)
+		}
+		if sayAs > 0 {
+			b.WriteString(text[:i])
+		} else {
+			b.WriteString(normalizeText(text[:i], lang))
+		}
+		text = text[i:]
+		if text == "" {
+			break
+		}
+
+		end := ";"
+		if text[0] == '<' {
+			end = ">"
+		}
+		j := strings.Index(text, end)
+		if j < 0 {
+			b.WriteString(text)
+			break
+		}
+		token := text[:j+1]
+		switch {
+		case strings.HasPrefix(token, "<say-as") && !strings.HasSuffix(token, "/>"):
+			sayAs++
+		case strings.HasPrefix(token, "</say-as") && sayAs > 0:
+			sayAs--
+		}
+		b.WriteString(token)
+		text = text[j+1:]
+	}
+	return b.String()
+}
+
+// 各语种共用的匹配规则
+var (
+	isoDatePattern = regexp.MustCompile(`\b(\d{4})[-/](\d{1,2})[-/](\d{1,2})\b`)
+	clockPattern   = regexp.MustCompile(`\b(\d{1,2}):(\d{2})\b`)
+	// 金额与数字: 可带千分位逗号与小数部分
+	currencyPattern = regexp.MustCompile(`([¥￥$€£])\s?(\d{1,3}(?:,\d{3})+(?:\.\d+)?|\d+(?:\.\d+)?)`)
+	percentPattern  = regexp.MustCompile(`(\d{1,3}(?:,\d{3})+(?:\.\d+)?|\d+(?:\.\d+)?)\s?%`)
+	numberPattern   = regexp.MustCompile(`\d{1,3}(?:,\d{3})+(?:\.\d+)?|\d+(?:\.\d+)?`)
+)
+
+// MAX_CARDINAL_DIGITS 不带千分位的整数超过该位数 (或以 0 开头) 时按数位逐个朗读, 如电话号码;
+// 带千分位的整数总是按数值朗读
+const MAX_CARDINAL_DIGITS = 8
+
+// splitNumber 拆分数字为整数值与小数部分; digits 为 true 表示整数部分应逐位朗读
+func splitNumber(s string) (n uint64, frac string, digits bool) {
+	grouped := strings.Contains(s, ",")
+	whole, frac, _ := strings.Cut(strings.ReplaceAll(s, ",", ""), ".")
+	if !grouped && (len(whole) > MAX_CARDINAL_DIGITS || (len(whole) > 1 && whole[0] == '0')) {
+		return 0, frac, true
+	}
+	n, err := strconv.ParseUint(whole, 10, 64)
+	if err != nil || n >= 1e16 {
+		return 0, frac, true
+	}
+	return n, frac, false
+}
+
+// validDate 判断月、日是否在合法范围内
+func validDate(month, day string) (int, int, bool) {
+	m, _ := strconv.Atoi(month)
+	d, _ := strconv.Atoi(day)
+	return m, d, m >= 1 && m <= 12 && d >= 1 && d <= 31
+}
+
+var (
+	zhDigits = []string{"零", "一", "二", "三", "四", "五", "六", "七", "八", "九"}
+
+	zhYearPattern = regexp.MustCompile(`(\d{4})年`)
+	zhUnitPattern = regexp.MustCompile(`(\d{1,3}(?:,\d{3})+(?:\.\d+)?|\d+(?:\.\d+)?)\s?(km|kg|cm|mm|ml|m²|℃)`)
+
+	zhCurrencies = map[string]string{"¥": "元", "￥": "元", "$": "美元", "€": "欧元", "£": "英镑"}
+	zhUnits      = map[string]string{
+		"km": "公里", "kg": "千克", "cm": "厘米", "mm": "毫米", "ml": "毫升", "m²": "平方米", "℃": "摄氏度",
+	}
+)
+
+// normalizeZh 中文规范化: 日期、时刻、金额、百分数、度量单位与数字
+func normalizeZh(text string) string {
+	text = isoDatePattern.ReplaceAllStringFunc(text, func(s string) string {
+		g := isoDatePattern.FindStringSubmatch(s)
+		m, d, ok := validDate(g[2], g[3])
+		if !ok {
+			return s
+		}
+		return zhDigitString(g[1]) + "年" + zhInteger(uint64(m)) + "月" + zhInteger(uint64(d)) + "日"
+	})
+	text = zhYearPattern.ReplaceAllStringFunc(text, func(s string) string {
+		return zhDigitString(strings.TrimSuffix(s, "年")) + "年"
+	})
+	text = clockPattern.ReplaceAllStringFunc(text, func(s string) string {
+		g := clockPattern.FindStringSubmatch(s)
+		h, _ := strconv.Atoi(g[1])
+		m, _ := strconv.Atoi(g[2])
+		if h > 24 || m > 59 {
+			return s
+		}
+		switch {
+		case m == 0:
+			return zhInteger(uint64(h)) + "点整"
+		case m < 10:
+			return zhInteger(uint64(h)) + "点零" + zhInteger(uint64(m)) + "分"
+		}
+		return zhInteger(uint64(h)) + "点" + zhInteger(uint64(m)) + "分"
+	})
+	text = currencyPattern.ReplaceAllStringFunc(text, func(s string) string {
+		g := currencyPattern.FindStringSubmatch(s)
+		return zhNumber(g[2]) + zhCurrencies[g[1]]
+	})
+	text = percentPattern.ReplaceAllStringFunc(text, func(s string) string {
+		return "百分之" + zhNumber(percentPattern.FindStringSubmatch(s)[1])
+	})
+	text = zhUnitPattern.ReplaceAllStringFunc(text, func(s string) string {
+		g := zhUnitPattern.FindStringSubmatch(s)
+		return zhNumber(g[1]) + zhUnits[g[2]]
+	})
+	return numberPattern.ReplaceAllStringFunc(text, zhNumber)
+}
+
+// zhNumber 朗读数字, 如 "1,234.5" 为 "一千二百三十四点五"
+func zhNumber(s string) string {
+	n, frac, digits := splitNumber(s)
+	var out string
+	if digits {
+		whole, _, _ := strings.Cut(strings.ReplaceAll(s, ",", ""), ".")
+		out = zhDigitString(whole)
+	} else {
+		out = zhInteger(n)
+	}
+	if frac != "" {
+		out += "点" + zhDigitString(frac)
+	}
+	return out
+}
+
+// zhDigitString 逐位朗读数字串, 如年份 "2024" 为 "二零二四"
+func zhDigitString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteString(zhDigits[r-'0'])
+		}
+	}
+	return b.String()
+}
+
+// zhInteger 按万、亿分节朗读整数 (小于 10^16), 10~19 开头省略 "一"
+func zhInteger(n uint64) string {
+	if n == 0 {
+		return zhDigits[0]
+	}
+	units := []string{"", "万", "亿", "万亿"}
+	var groups []int
+	for ; n > 0; n /= 10000 {
+		groups = append(groups, int(n%10000))
+	}
+
+	var b strings.Builder
+	zero := false
+	for i := len(groups) - 1; i >= 0; i-- {
+		g := groups[i]
+		if g == 0 {
+			zero = true
+			continue
+		}
+		if b.Len() > 0 && (zero || g < 1000) {
+			b.WriteString(zhDigits[0])
+		}
+		b.WriteString(zhGroup(g))
+		b.WriteString(units[i])
+		zero = false
+	}
+	s := b.String()
+	if strings.HasPrefix(s, "一十") {
+		s = strings.TrimPrefix(s, "一")
+	}
+	return s
+}
+
+// zhGroup 朗读 1~9999 的一节, 中间的连续 0 读作一个 "零"
+func zhGroup(g int) string {
+	places := []string{"千", "百", "十", ""}
+	var b strings.Builder
+	zero := false
+	for i, div := range []int{1000, 100, 10, 1} {
+		d := g / div % 10
+		if d == 0 {
+			zero = b.Len() > 0
+			continue
+		}
+		if zero {
+			b.WriteString(zhDigits[0])
+			zero = false
+		}
+		b.WriteString(zhDigits[d])
+		b.WriteString(places[i])
+	}
+	return b.String()
+}
+
+var (
+	enOnes = []string{"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine",
+		"ten", "eleven", "twelve", "thirteen", "fourteen", "fifteen", "sixteen", "seventeen", "eighteen", "nineteen"}
+	enTens   = []string{"", "", "twenty", "thirty", "forty", "fifty", "sixty", "seventy", "eighty", "ninety"}
+	enScales = []string{"", "thousand", "million", "billion", "trillion", "quadrillion"}
+	enMonths = []string{"", "January", "February", "March", "April", "May", "June",
+		"July", "August", "September", "October", "November", "December"}
+
+	enOrdinalPattern = regexp.MustCompile(`\b(\d+)(st|nd|rd|th)\b`)
+	enUnitPattern    = regexp.MustCompile(`(\d{1,3}(?:,\d{3})+(?:\.\d+)?|\d+(?:\.\d+)?)\s?(km|kg|cm|mm|ml)\b`)
+	enNumberSign     = regexp.MustCompile(`\bNo\.\s?(\d)`)
+	enAbbreviations  = []struct {
+		pattern *regexp.Regexp
+		spoken  string
+	}{
+		{regexp.MustCompile(`\bDr\.`), "Doctor"},
+		{regexp.MustCompile(`\bMr\.`), "Mister"},
+		{regexp.MustCompile(`\bMrs\.`), "Missus"},
+		{regexp.MustCompile(`\bMs\.`), "Miz"},
+		{regexp.MustCompile(`\bSt\.`), "Street"},
+		{regexp.MustCompile(`\bJr\.`), "Junior"},
+		{regexp.MustCompile(`\bvs\.`), "versus"},
+		{regexp.MustCompile(`\betc\.`), "et cetera"},
+		{regexp.MustCompile(`\be\.g\.`), "for example"},
+		{regexp.MustCompile(`\bi\.e\.`), "that is"},
+	}
+
+	// enCurrencies 货币单位的单复数与辅币名称, 无辅币时小数部分按数字朗读
+	enCurrencies = map[string][4]string{
+		"$": {"dollar", "dollars", "cent", "cents"},
+		"€": {"euro", "euros", "cent", "cents"},
+		"£": {"pound", "pounds", "penny", "pence"},
+		"¥": {"yen", "yen", "", ""},
+		"￥": {"yen", "yen", "", ""},
+	}
+	enUnits = map[string]string{
+		"km": "kilometers", "kg": "kilograms", "cm": "centimeters", "mm": "millimeters", "ml": "milliliters",
+	}
+)
+
+// normalizeEn 英文规范化: 缩写、日期、时刻、金额、百分数、序数、度量单位与数字
+func normalizeEn(text string) string {
+	text = enNumberSign.ReplaceAllString(text, "number $1")
+	for _, a := range enAbbreviations {
+		text = a.pattern.ReplaceAllLiteralString(text, a.spoken)
+	}
+	text = isoDatePattern.ReplaceAllStringFunc(text, func(s string) string {
+		g := isoDatePattern.FindStringSubmatch(s)
+		m, d, ok := validDate(g[2], g[3])
+		if !ok {
+			return s
+		}
+		y, _ := strconv.Atoi(g[1])
+		return enMonths[m] + " " + enOrdinal(uint64(d)) + ", " + enYear(y)
+	})
+	text = clockPattern.ReplaceAllStringFunc(text, func(s string) string {
+		g := clockPattern.FindStringSubmatch(s)
+		h, _ := strconv.Atoi(g[1])
+		m, _ := strconv.Atoi(g[2])
+		switch {
+		case h > 24 || m > 59:
+			return s
+		case m == 0:
+			return enInteger(uint64(h)) + " o'clock"
+		case m < 10:
+			return enInteger(uint64(h)) + " oh " + enInteger(uint64(m))
+		}
+		return enInteger(uint64(h)) + " " + enInteger(uint64(m))
+	})
+	text = currencyPattern.ReplaceAllStringFunc(text, func(s string) string {
+		g := currencyPattern.FindStringSubmatch(s)
+		return enMoney(g[2], enCurrencies[g[1]])
+	})
+	text = percentPattern.ReplaceAllStringFunc(text, func(s string) string {
+		return enNumber(percentPattern.FindStringSubmatch(s)[1]) + " percent"
+	})
+	text = enOrdinalPattern.ReplaceAllStringFunc(text, func(s string) string {
+		n, err := strconv.ParseUint(enOrdinalPattern.FindStringSubmatch(s)[1], 10, 64)
+		if err != nil || n >= 1e16 {
+			return s
+		}
+		return enOrdinal(n)
+	})
+	text = enUnitPattern.ReplaceAllStringFunc(text, func(s string) string {
+		g := enUnitPattern.FindStringSubmatch(s)
+		return enNumber(g[1]) + " " + enUnits[g[2]]
+	})
+	return numberPattern.ReplaceAllStringFunc(text, enNumber)
+}
+
+// enNumber 朗读数字, 如 "3.14" 为 "three point one four"
+func enNumber(s string) string {
+	n, frac, digits := splitNumber(s)
+	var out string
+	if digits {
+		whole, _, _ := strings.Cut(strings.ReplaceAll(s, ",", ""), ".")
+		out = enDigitString(whole)
+	} else {
+		out = enInteger(n)
+	}
+	if frac != "" {
+		out += " point " + enDigitString(frac)
+	}
+	return out
+}
+
+// enMoney 朗读金额, 两位小数读作辅币, 如 "$1.50" 为 "one dollar and fifty cents"
+func enMoney(amount string, names [4]string) string {
+	n, frac, digits := splitNumber(amount)
+	if digits || (frac != "" && (names[2] == "" || len(frac) != 2)) {
+		return enNumber(amount) + " " + names[1]
+	}
+	unit := names[1]
+	if n == 1 {
+		unit = names[0]
+	}
+	out := enInteger(n) + " " + unit
+	if cents, _ := strconv.Atoi(frac); cents > 0 {
+		sub := names[3]
+		if cents == 1 {
+			sub = names[2]
+		}
+		out += " and " + enInteger(uint64(cents)) + " " + sub
+	}
+	return out
+}
+
+// enDigitString 逐位朗读数字串
+func enDigitString(s string) string {
+	var words []string
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			words = append(words, enOnes[r-'0'])
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// enInteger 朗读整数, 如 1234 为 "one thousand two hundred thirty-four"
+func enInteger(n uint64) string {
+	if n == 0 {
+		return enOnes[0]
+	}
+	var parts []string
+	for scale := 0; n > 0; scale, n = scale+1, n/1000 {
+		g := int(n % 1000)
+		if g == 0 {
+			continue
+		}
+		part := enHundreds(g)
+		if enScales[scale] != "" {
+			part += " " + enScales[scale]
+		}
+		parts = append([]string{part}, parts...)
+	}
+	return strings.Join(parts, " ")
+}
+
+// enHundreds 朗读 1~999
+func enHundreds(n int) string {
+	var words []string
+	if n >= 100 {
+		words = append(words, enOnes[n/100], "hundred")
+		n %= 100
+	}
+	switch {
+	case n >= 20 && n%10 != 0:
+		words = append(words, enTens[n/10]+"-"+enOnes[n%10])
+	case n >= 20:
+		words = append(words, enTens[n/10])
+	case n > 0:
+		words = append(words, enOnes[n])
+	}
+	return strings.Join(words, " ")
+}
+
+// enOrdinal 朗读序数, 如 21 为 "twenty-first"
+func enOrdinal(n uint64) string {
+	s := enInteger(n)
+	irregular := map[string]string{
+		"one": "first", "two": "second", "three": "third", "five": "fifth",
+		"eight": "eighth", "nine": "ninth", "twelve": "twelfth",
+	}
+	// 只变换最后一个词 (或连字符后的部分)
+	i := strings.LastIndexAny(s, " -") + 1
+	last := s[i:]
+	switch {
+	case irregular[last] != "":
+		last = irregular[last]
+	case strings.HasSuffix(last, "y"):
+		last = strings.TrimSuffix(last, "y") + "ieth"
+	default:
+		last += "th"
+	}
+	return s[:i] + last
+}
+
+// enYear 按年份习惯朗读, 如 2024 为 "twenty twenty-four", 2005 为 "two thousand five"
+func enYear(y int) string {
+	hi, lo := y/100, y%100
+	switch {
+	case y >= 2000 && y < 2010, y%1000 == 0:
+		return enInteger(uint64(y))
+	case lo == 0:
+		return enInteger(uint64(hi)) + " hundred"
+	case lo < 10:
+		return enInteger(uint64(hi)) + " oh " + enInteger(uint64(lo))
+	}
+	return enInteger(uint64(hi)) + " " + enInteger(uint64(lo))
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTextZh(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"今天是2024-03-05", "今天是二零二四年三月五日"},
+		{"1998年出生", "一九九八年出生"},
+		{"会议9:05开始, 10:30结束, 8:00集合", "会议九点零五分开始, 十点三十分结束, 八点整集合"},
+		{"共¥1,234.50", "共一千二百三十四点五零元"},
+		{"花了$20", "花了二十美元"},
+		{"增长15%", "增长百分之十五"},
+		{"跑了5km, 气温-3℃", "跑了五公里, 气温-三摄氏度"},
+		{"10005人", "一万零五人"},
+		{"第12名", "第十二名"},
+		{"电话13800138000", "电话一三八零零一三八零零零"},
+		{"编号007", "编号零零七"},
+		{"2024-13-40", "二千零二十四-十三-四十"}, // 非法日期不按日期朗读
+		{"没有数字", "没有数字"},
+	}
+	for _, tt := range tests {
+		if got := normalizeText(tt.in, "zh-CN"); got != tt.want {
+			t.Errorf("normalizeText(%q, zh-CN) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeTextEn(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Dr. Smith lives on Main St.", "Doctor Smith lives on Main Street"},
+		{"Due 2024-03-05", "Due March fifth, twenty twenty-four"},
+		{"Born 2005-01-01", "Born January first, two thousand five"},
+		{"Meet at 9:05 or 10:00", "Meet at nine oh five or ten o'clock"},
+		{"It costs $1.50", "It costs one dollar and fifty cents"},
+		{"Pay €3", "Pay three euros"},
+		{"Up 12.5%", "Up twelve point five percent"},
+		{"the 21st and 3rd place", "the twenty-first and third place"},
+		{"No. 7 is 1,234 km away", "number seven is one thousand two hundred thirty-four kilometers away"},
+		{"e.g. 42", "for example forty-two"},
+		{"no digits here", "no digits here"},
+	}
+	for _, tt := range tests {
+		if got := normalizeText(tt.in, "en-US"); got != tt.want {
+			t.Errorf("normalizeText(%q, en-US) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeTextUnknownLanguage(t *testing.T) {
+	if got := normalizeText("123", "ja-JP"); got != "123" {
+		t.Fatalf("normalizeText(123, ja-JP) = %q, want unchanged", got)
+	}
+}
+
+func TestRegisterTextNormalizer(t *testing.T) {
+	RegisterTextNormalizer("XX", strings.ToUpper)
+	t.Cleanup(func() {
+		textNormalizersMu.Lock()
+		delete(textNormalizers, "xx")
+		textNormalizersMu.Unlock()
+	})
+	if got := normalizeText("abc", "xx-YY"); got != "ABC" {
+		t.Fatalf("normalizeText with registered normalizer = %q, want ABC", got)
+	}
+}
+
+func TestNormalizeMarkupSSML(t *testing.T) {
+	in := `<speak>共<break time="500ms"/>3个 &amp; <say-as interpret-as="digits">123</say-as></speak>`
+	want := `<speak>共<break time="500ms"/>三个 &amp; <say-as interpret-as="digits">123</say-as></speak>`
+	if got := normalizeMarkup(in, "zh"); got != want {
+		t.Fatalf("normalizeMarkup = %q, want %q", got, want)
+	}
+}
+
+func TestNormalizeTTSRequest(t *testing.T) {
+	cfg := DefaultConfig()
+	off := false
+	req := TTSRequest{Text: "3个", Voice: "xiaoyun"}
+	normalizeTTSRequest(&req, cfg)
+	if (cfg.NormalizeText && req.Text != "三个") || (!cfg.NormalizeText && req.Text != "3个") {
+		t.Fatalf("default normalize_text=%v: text = %q", cfg.NormalizeText, req.Text)
+	}
+
+	on := true
+	req = TTSRequest{Text: "3个", Voice: "xiaoyun", NormalizeText: &on,
+		Segments: []TTSSegment{{Text: "第2段"}}}
+	normalizeTTSRequest(&req, cfg)
+	if req.Text != "三个" || req.Segments[0].Text != "第二段" {
+		t.Fatalf("normalize_text=true: text = %q, segment = %q", req.Text, req.Segments[0].Text)
+	}
+
+	req = TTSRequest{Text: "3个", Voice: "xiaoyun", NormalizeText: &off}
+	c := *cfg
+	c.NormalizeText = true
+	normalizeTTSRequest(&req, &c)
+	if req.Text != "3个" {
+		t.Fatalf("normalize_text=false overrides config: text = %q", req.Text)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Postprocessor 识别结果的后处理, 如逆文本规范化 (ITN, "一百二十三" → "123") 与标点恢复
+//
+// text 为引擎输出的原始文本, lang 为识别出的语种 (BCP 47), 返回写入 <instance> 的文本。
+type Postprocessor interface {
+	Process(text, lang string) string
+}
+
+// PostprocessorFunc 将函数适配为 Postprocessor
+type PostprocessorFunc func(text, lang string) string
+
+// Process 调用 f
+func (f PostprocessorFunc) Process(text, lang string) string {
+	return f(text, lang)
+}
+
+var (
+	postprocessorsMu sync.RWMutex
+	// postprocessors 按 BCP 47 主语种标签 ("zh"、"en") 索引, 演示环境未注册任何后处理
+	postprocessors = map[string]Postprocessor{}
+)
+
+// RegisterPostprocessor 注册语种 lang (BCP 47 主标签, 如 "zh") 的识别结果后处理, 已存在时替换; p 为 nil 时删除
+func RegisterPostprocessor(lang string, p Postprocessor) {
+	postprocessorsMu.Lock()
+	defer postprocessorsMu.Unlock()
+	if p == nil {
+		delete(postprocessors, strings.ToLower(lang))
+		return
+	}
+	postprocessors[strings.ToLower(lang)] = p
+}
+
+// lookupPostprocessor 返回语种 lang (可带地区, 如 "zh-CN") 的后处理
+func lookupPostprocessor(lang string) (Postprocessor, bool) {
+	primary, _, _ := strings.Cut(strings.ToLower(lang), "-")
+	postprocessorsMu.RLock()
+	defer postprocessorsMu.RUnlock()
+	p, ok := postprocessors[primary]
+	return p, ok
+}
+
+// postprocessNLSML 对每个 <interpretation> 的 <input> 原始文本做后处理, 结果写入 <instance>
+//
+// <input> 保留原始文本, 下游可同时取得两者。<instance> 含子元素 (语法的语义解释) 时不改写。
+// 语种没有注册后处理或结果无法解析时按原样返回。
+func postprocessNLSML(nlsml, lang string) string {
+	p, ok := lookupPostprocessor(lang)
+	if !ok {
+		return nlsml
+	}
+
+	type edit struct {
+		start, end int
+		text       string
+	}
+	var edits []edit
+
+	decoder := xml.NewDecoder(strings.NewReader(nlsml))
+	var stack []string
+	instStart, instEnd := -1, -1 // 当前 <interpretation> 中 <instance> 内容的范围
+	plain := false               // <instance> 只含文本
+	var input strings.Builder
+	hasInput := false
+	for {
+		pos := int(decoder.InputOffset())
+		tok, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nlsml
+		}
+		parent := ""
+		if len(stack) > 0 {
+			parent = stack[len(stack)-1]
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case t.Name.Local == "interpretation":
+				instStart, instEnd, plain, hasInput = -1, -1, false, false
+				input.Reset()
+			case t.Name.Local == "instance" && parent == "interpretation":
+				instStart, plain = int(decoder.InputOffset()), true
+			case t.Name.Local == "input" && parent == "interpretation":
+				hasInput = true
+			case parent == "instance":
+				plain = false
+			}
+			stack = append(stack, t.Name.Local)
+		case xml.CharData:
+			if parent == "input" && len(stack) >= 2 && stack[len(stack)-2] == "interpretation" {
+				input.Write(t)
+			}
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			switch t.Name.Local {
+			case "instance":
+				if instStart >= 0 && instEnd < 0 {
+					instEnd = pos
+				}
+			case "interpretation":
+				raw := strings.TrimSpace(input.String())
+				if hasInput && plain && instStart >= 0 && instEnd >= instStart && raw != "" {
+					edits = append(edits, edit{instStart, instEnd, xmlEscape(p.Process(raw, lang))})
+				}
+				instStart, instEnd = -1, -1
+			}
+		}
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, e := range edits {
+		b.WriteString(nlsml[last:e.start])
+		b.WriteString(e.text)
+		last = e.end
+	}
+	b.WriteString(nlsml[last:])
+	return b.String()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TTSProfile 命名的合成参数预设, 如 "ivr-female-slow"
+//
+// 零值字段表示预设不指定, 沿用请求或默认值。
+type TTSProfile struct {
+	Voice  string  `yaml:"voice"`
+	Speed  float64 `yaml:"speed"`
+	Pitch  float64 `yaml:"pitch"`
+	Volume float64 `yaml:"volume"`
+}
+
+// applyTTSProfile 用 req.Profile 在配置 c 中对应的预设填充请求中未设置的字段, 请求中显式设置的字段优先
+func applyTTSProfile(req *TTSRequest, c *Config) *ErrorResponse {
+	if req.Profile == "" {
+		return nil
+	}
+	p, ok := c.Profiles[req.Profile]
+	if !ok {
+		return &ErrorResponse{
+			Status:  "error",
+			Code:    "PROFILE_NOT_FOUND",
+			Message: fmt.Sprintf("Profile '%s' not found", req.Profile),
+		}
+	}
+	if isDefaultVoice(req.Voice) && p.Voice != "" {
+		req.Voice = p.Voice
+	}
+	if req.Speed == 0 {
+		req.Speed = p.Speed
+	}
+	if req.Pitch == 0 {
+		req.Pitch = p.Pitch
+	}
+	if req.Volume == 0 {
+		req.Volume = p.Volume
+	}
+	return nil
+}
+
+// checkProfiles 启动或重新加载时校验配置 c 中预设的音色与参数范围
+func checkProfiles(c *Config) error {
+	for _, name := range profileNames(c.Profiles) {
+		p := c.Profiles[name]
+		if p.Voice != "" && !isDefaultVoice(p.Voice) {
+			if _, ok := lookupVoice(p.Voice); !ok {
+				return fmt.Errorf("profile '%s': voice '%s' not found", name, p.Voice)
+			}
+		}
+		req := TTSRequest{Speed: p.Speed, Pitch: p.Pitch, Volume: p.Volume}
+		if errResp := checkTTSParams(req, c); errResp != nil {
+			return fmt.Errorf("profile '%s': %s", name, errResp.Message)
+		}
+	}
+	return nil
+}
+
+// profileNames 返回预设名称, 按字母顺序
+func profileNames(profiles map[string]TTSProfile) []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// MAX_SEGMENTS 拼接播放单个请求的片段数上限
+const MAX_SEGMENTS = 100
+
+// TTSSegment 拼接播放的片段, text (合成) 与 prompt (录音 ID) 恰设置其一
+type TTSSegment struct {
+	Text   string `json:"text"`
+	Prompt string `json:"prompt"`
+}
+
+// errPromptNotFound prompt_dir 中没有该录音
+var errPromptNotFound = errors.New("prompt not found")
+
+// isValidPromptID 录音 ID 只能包含字母、数字、"-" 与 "_", 避免跳出 prompt_dir
+func isValidPromptID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// promptPath 返回录音 id 的文件路径 (<dir>/<id>.wav), 未配置 prompt_dir 或 ID 无效时返回 false
+func promptPath(dir, id string) (string, bool) {
+	if dir == "" || !isValidPromptID(id) {
+		return "", false
+	}
+	return filepath.Join(dir, id+".wav"), true
+}
+
+// promptExists 判断录音文件是否存在
+func promptExists(dir, id string) bool {
+	path, ok := promptPath(dir, id)
+	if !ok {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// loadPrompt 读取录音 id, 返回采样与采样率; 文件须为 16-bit PCM 单声道 WAV
+//
+// 每次播放时从磁盘读取, 替换文件后立即生效 (启用合成缓存时已缓存的请求除外)。
+func loadPrompt(dir, id string) ([]int16, int, error) {
+	path, ok := promptPath(dir, id)
+	if !ok {
+		return nil, 0, errPromptNotFound
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, errPromptNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	pcm, rate, isWAV, err := parseWAV(data)
+	if err != nil {
+		return nil, 0, fmt.Errorf("prompt '%s': %v", id, err)
+	}
+	if !isWAV || rate <= 0 {
+		return nil, 0, fmt.Errorf("prompt '%s': not a WAV file", id)
+	}
+	return pcmSamples(pcm), rate, nil
+}
+
+// textRunes 请求中待合成文本的字符数, 拼接播放时为各 text 片段之和
+func textRunes(req TTSRequest) int {
+	n := utf8.RuneCountInString(req.Text)
+	for _, seg := range req.Segments {
+		n += utf8.RuneCountInString(seg.Text)
+	}
+	return n
+}
+
+// checkSegments 校验拼接播放的片段, 通过时返回 nil
+//
+// segments 不能与 text 同时设置; 每段恰有 text 或 prompt 之一, 录音须在 c.PromptDir 中。
+func checkSegments(req TTSRequest, c *Config) *ErrorResponse {
+	if req.Text != "" {
+		return &ErrorResponse{Status: "error", Code: "INVALID_REQUEST", Message: "text conflicts with segments"}
+	}
+	if len(req.Segments) > MAX_SEGMENTS {
+		return &ErrorResponse{
+			Status:  "error",
+			Code:    "INVALID_REQUEST",
+			Message: fmt.Sprintf("too many segments (%d > %d)", len(req.Segments), MAX_SEGMENTS),
+		}
+	}
+	for i, seg := range req.Segments {
+		switch {
+		case seg.Prompt != "" && seg.Text != "":
+			return &ErrorResponse{
+				Status:  "error",
+				Code:    "INVALID_REQUEST",
+				Message: fmt.Sprintf("segment %d has both text and prompt", i),
+			}
+		case seg.Prompt != "":
+			if !promptExists(c.PromptDir, seg.Prompt) {
+				return &ErrorResponse{
+					Status:  "error",
+					Code:    "PROMPT_NOT_FOUND",
+					Message: fmt.Sprintf("Prompt '%s' not found", seg.Prompt),
+				}
+			}
+		case isBlankText(seg.Text):
+			return &ErrorResponse{
+				Status:  "error",
+				Code:    "TEXT_EMPTY",
+				Message: fmt.Sprintf("Segment %d text is empty", i),
+			}
+		}
+	}
+	return nil
+}
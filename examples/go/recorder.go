@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MAX_RECORD_BYTES 单个连接录音的 PCM 字节数上限, 超过后不再记录 (约 52 分钟的 16kHz 音频)
+const MAX_RECORD_BYTES = 100 * 1024 * 1024
+
+// recordCleanupMu 串行化录音目录的清理
+var recordCleanupMu sync.Mutex
+
+// audioRecorder 累积 ASR 连接上收到的 PCM, 连接结束时写为 WAV 供复现识别问题
+//
+// 采样率变化 (之后的 start 使用不同的 sample_rate) 时先写出已累积的音频, 再开始新文件。
+// 只在读循环中访问, 不加锁。
+type audioRecorder struct {
+	dir       string
+	maxFiles  int
+	maxAge    time.Duration
+	sessionID string
+	logger    *slog.Logger
+
+	rate      int
+	started   time.Time
+	pcm       bytes.Buffer
+	total     int
+	truncated bool
+}
+
+// newAudioRecorder 开启 record_audio 且未开启 privacy_mode 时返回录音器, 否则返回 nil
+func newAudioRecorder(c *Config, sessionID string, logger *slog.Logger) *audioRecorder {
+	if !c.RecordAudio || c.PrivacyMode {
+		return nil
+	}
+	return &audioRecorder{
+		dir:       c.RecordDir,
+		maxFiles:  c.RecordMaxFiles,
+		maxAge:    c.RecordMaxAge,
+		sessionID: sessionID,
+		logger:    logger,
+	}
+}
+
+// write 记录一段采样率为 rate 的 16-bit PCM, r 为 nil 时忽略
+func (r *audioRecorder) write(pcm []byte, rate int) {
+	if r == nil || len(pcm) == 0 {
+		return
+	}
+	if r.pcm.Len() > 0 && rate != r.rate {
+		r.flush()
+	}
+	if r.pcm.Len() == 0 {
+		r.rate, r.started = rate, time.Now()
+	}
+	if r.total+len(pcm) > MAX_RECORD_BYTES {
+		if !r.truncated {
+			r.truncated = true
+			r.logger.Warn("ASR 录音超过上限, 之后的音频不再记录", "limit", MAX_RECORD_BYTES)
+		}
+		return
+	}
+	r.total += len(pcm)
+	r.pcm.Write(pcm)
+}
+
+// close 在连接结束时写出剩余的录音, r 为 nil 时忽略
+func (r *audioRecorder) close() {
+	if r != nil {
+		r.flush()
+	}
+}
+
+// flush 将已累积的音频写为 <session_id>-<开始时间>.wav, 之后按保留策略清理目录
+func (r *audioRecorder) flush() {
+	if r.pcm.Len() == 0 {
+		return
+	}
+	defer r.pcm.Reset()
+
+	name := fmt.Sprintf("%s-%s.wav", r.sessionID, r.started.UTC().Format("20060102T150405.000Z"))
+	path := filepath.Join(r.dir, name)
+	data := append(wavHeader(r.pcm.Len(), r.rate, 1, EncodingPCM16), r.pcm.Bytes()...)
+	if err := os.MkdirAll(r.dir, 0o750); err != nil {
+		r.logger.Warn("ASR 录音写入失败", "path", path, "error", err)
+		return
+	}
+	if err := os.WriteFile(path, data, 0o640); err != nil {
+		r.logger.Warn("ASR 录音写入失败", "path", path, "error", err)
+		return
+	}
+	r.logger.Info("ASR 录音已保存", "path", path, "bytes", r.pcm.Len(), "sample_rate", r.rate)
+	cleanupRecordings(r.dir, r.maxFiles, r.maxAge, r.logger)
+}
+
+// cleanupRecordings 删除 dir 中超过 maxAge 的录音, 之后只保留最新的 maxFiles 个; 0 表示不限制
+func cleanupRecordings(dir string, maxFiles int, maxAge time.Duration, logger *slog.Logger) {
+	if maxFiles <= 0 && maxAge <= 0 {
+		return
+	}
+	recordCleanupMu.Lock()
+	defer recordCleanupMu.Unlock()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		logger.Warn("ASR 录音清理失败", "dir", dir, "error", err)
+		return
+	}
+	type recording struct {
+		path    string
+		modTime time.Time
+	}
+	var files []recording
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !strings.HasSuffix(e.Name(), ".wav") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, recording{filepath.Join(dir, e.Name()), info.ModTime()})
+	}
+	// 从新到旧排列
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.After(files[j].modTime) })
+
+	removed := 0
+	for i, f := range files {
+		expired := maxAge > 0 && time.Since(f.modTime) > maxAge
+		if !expired && (maxFiles <= 0 || i < maxFiles) {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil {
+			logger.Warn("ASR 录音清理失败", "path", f.path, "error", err)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		logger.Info("ASR 录音已清理", "dir", dir, "removed", removed)
+	}
+}
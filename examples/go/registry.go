@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// connEntry 登记的连接
+type connEntry struct {
+	stats *connStats
+	drain func() // 阻塞直到连接上进行中的任务结束, 可为 nil
+}
+
+// connRegistry 活动 WebSocket 连接表, 用于优雅关闭与 /stats
+type connRegistry struct {
+	mu      sync.Mutex
+	conns   map[*websocket.Conn]connEntry
+	closing bool
+	wg      sync.WaitGroup
+}
+
+func newConnRegistry() *connRegistry {
+	return &connRegistry{conns: make(map[*websocket.Conn]connEntry)}
+}
+
+// add 登记连接, 正在关闭时返回 false
+func (r *connRegistry) add(conn *websocket.Conn, stats *connStats, drain func()) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closing {
+		return false
+	}
+	r.conns[conn] = connEntry{stats: stats, drain: drain}
+	r.wg.Add(1)
+	activeConnections.WithLabelValues(stats.endpoint).Inc()
+	return true
+}
+
+// isClosing 是否已开始关闭
+func (r *connRegistry) isClosing() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closing
+}
+
+// remove 在处理函数退出时注销连接
+func (r *connRegistry) remove(conn *websocket.Conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if entry, ok := r.conns[conn]; ok {
+		delete(r.conns, conn)
+		r.wg.Done()
+		activeConnections.WithLabelValues(entry.stats.endpoint).Dec()
+	}
+}
+
+// count 当前活动连接数
+func (r *connRegistry) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.conns)
+}
+
+// stats 各活动连接的统计快照
+func (r *connRegistry) stats() []SessionStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]SessionStats, 0, len(r.conns))
+	for _, entry := range r.conns {
+		list = append(list, entry.stats.snapshot())
+	}
+	return list
+}
+
+// shutdown 等待各连接上进行中的任务结束后发送 Close 帧, 并等待处理函数退出
+//
+// ctx 到期后强制关闭剩余连接。
+func (r *connRegistry) shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	r.closing = true
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, CLOSE_REASON_SHUTDOWN)
+	for conn, entry := range r.conns {
+		go func(conn *websocket.Conn, drain func()) {
+			if drain != nil {
+				drain()
+			}
+			conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		}(conn, entry.drain)
+	}
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		r.mu.Lock()
+		for conn := range r.conns {
+			conn.Close()
+		}
+		r.mu.Unlock()
+		return ctx.Err()
+	}
+}
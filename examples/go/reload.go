@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// staticConfigFields 只在启动时生效的配置项 (yaml 名称), 重新加载时保留原值并在 restart_required 中列出
+//
+// 监听地址与 TLS、引擎与缓存、会话保留、连接数限制 (计数在限制器中)、Upgrader 的来源/压缩/子协议/缓冲,
+// 以及可能被自定义实现替换的鉴权器均在启动时构建。
+var staticConfigFields = map[string]bool{
+	"host": true, "port": true,
+	"tls_cert": true, "tls_key": true, "tls_cert_pem": true, "tls_key_pem": true,
+	"log_format": true, "session_ttl": true,
+	"tts_engine": true, "grpc_tts_target": true, "asr_engine": true, "tts_cache_size": true,
+	"tts_routes": true, "asr_routes": true,
+	"max_connections": true, "max_connections_per_ip": true,
+	"allowed_origins": true, "allow_all": true, "enable_compression": true, "subprotocols": true,
+	"read_buffer_size": true, "write_buffer_size": true, "write_buffer_pool": true,
+	"auth_tokens": true, "debug_mode": true,
+}
+
+// reloadMu 串行化重新加载, 避免并发请求基于同一份旧配置比较
+var reloadMu sync.Mutex
+
+// ReloadResponse POST /admin/reload 的响应
+type ReloadResponse struct {
+	Status          string   `json:"status"`
+	Changed         []string `json:"changed"`                    // 已生效的配置项
+	RestartRequired []string `json:"restart_required,omitempty"` // 有变化但需重启才生效的配置项
+}
+
+// reloadConfig 重新加载 path 处的配置文件 (及环境变量) 并替换当前配置
+//
+// 新配置按启动时的规则校验, 失败时保留原配置; 只在启动时生效的字段沿用原值。
+func reloadConfig(path string) (ReloadResponse, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	next, err := LoadConfig(path)
+	if err != nil {
+		return ReloadResponse{}, err
+	}
+	if _, ok := lookupVoice(next.DefaultVoice); !ok {
+		return ReloadResponse{}, fmt.Errorf("default_voice '%s' not found", next.DefaultVoice)
+	}
+	if err := checkProfiles(next); err != nil {
+		return ReloadResponse{}, err
+	}
+
+	prev := currentConfig()
+	resp := ReloadResponse{Status: "reloaded", Changed: []string{}}
+	pv, nv := reflect.ValueOf(prev).Elem(), reflect.ValueOf(next).Elem()
+	for i := 0; i < pv.NumField(); i++ {
+		if reflect.DeepEqual(pv.Field(i).Interface(), nv.Field(i).Interface()) {
+			continue
+		}
+		name := pv.Type().Field(i).Tag.Get("yaml")
+		if staticConfigFields[name] {
+			nv.Field(i).Set(pv.Field(i))
+			resp.RestartRequired = append(resp.RestartRequired, name)
+			continue
+		}
+		resp.Changed = append(resp.Changed, name)
+	}
+
+	if next.TTSRateLimit != prev.TTSRateLimit || next.TTSRateBurst != prev.TTSRateBurst ||
+		next.TTSRatePerUser != prev.TTSRatePerUser {
+		ttsRateLimiter.configure(next.TTSRateLimit, next.TTSRateBurst, next.TTSRatePerUser)
+	}
+	activeConfig.Store(next)
+	slog.Info("配置已重新加载", "changed", resp.Changed, "restart_required", resp.RestartRequired)
+	return resp, nil
+}
+
+// handleAdminReload 返回 POST /admin/reload 的处理函数, 重新读取 path 处的配置文件
+//
+// 之后建立的连接使用新配置, 活动连接沿用建立时的配置。
+func handleAdminReload(path string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeHTTPError(w, http.StatusMethodNotAllowed, "INVALID_REQUEST", "Method not allowed")
+			return
+		}
+		if !authenticateAdmin(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="websocket-server"`)
+			writeHTTPError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Missing or invalid token")
+			return
+		}
+
+		resp, err := reloadConfig(path)
+		if err != nil {
+			slog.Warn("重新加载配置失败", "path", path, "error", err)
+			writeHTTPError(w, http.StatusUnprocessableEntity, "CONFIG_INVALID", err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// writeTestConfig 将 yaml 写入临时配置文件并返回路径
+func writeTestConfig(t *testing.T, yaml string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReloadConfigAppliesReloadableFields(t *testing.T) {
+	setTestConfig(t, nil)
+	prevLimiter := ttsRateLimiter
+	ttsRateLimiter = newRateLimiter(0, 0, false)
+	t.Cleanup(func() { ttsRateLimiter = prevLimiter })
+
+	path := writeTestConfig(t, "port: 9999\nmax_text_runes: 123\ntts_rate_limit: 4\n")
+	resp, err := reloadConfig(path)
+	if err != nil {
+		t.Fatalf("reloadConfig: %v", err)
+	}
+	if resp.Status != "reloaded" {
+		t.Fatalf("status = %q", resp.Status)
+	}
+	for _, name := range []string{"max_text_runes", "tts_rate_limit"} {
+		if !slices.Contains(resp.Changed, name) {
+			t.Errorf("changed = %v, missing %s", resp.Changed, name)
+		}
+	}
+	if !slices.Equal(resp.RestartRequired, []string{"port"}) {
+		t.Errorf("restart_required = %v, want [port]", resp.RestartRequired)
+	}
+
+	cfg := currentConfig()
+	if cfg.MaxTextRunes != 123 || cfg.TTSRateLimit != 4 {
+		t.Errorf("reloadable fields not applied: max_text_runes %d, tts_rate_limit %g", cfg.MaxTextRunes, cfg.TTSRateLimit)
+	}
+	if cfg.Port != DefaultConfig().Port {
+		t.Errorf("port = %d, want startup value %d", cfg.Port, DefaultConfig().Port)
+	}
+	if b := ttsRateLimiter.bucket(""); b == nil || b.rate != 4 {
+		t.Errorf("rate limiter not reconfigured: %+v", b)
+	}
+
+	// 相同内容再次加载没有变化
+	resp, err = reloadConfig(path)
+	if err != nil {
+		t.Fatalf("second reloadConfig: %v", err)
+	}
+	if len(resp.Changed) != 0 || !slices.Equal(resp.RestartRequired, []string{"port"}) {
+		t.Errorf("second reload = %+v, want no changes", resp)
+	}
+}
+
+func TestReloadConfigRejectsInvalid(t *testing.T) {
+	for name, yaml := range map[string]string{
+		"unknown voice": "max_text_runes: 123\ndefault_voice: no-such-voice\n",
+		"malformed":     "max_text_runes: [\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			setTestConfig(t, nil)
+			prev := currentConfig()
+			if _, err := reloadConfig(writeTestConfig(t, yaml)); err == nil {
+				t.Fatal("reloadConfig accepted an invalid config")
+			}
+			if currentConfig() != prev {
+				t.Fatal("invalid config replaced the current config")
+			}
+		})
+	}
+	if _, err := reloadConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Fatal("reloadConfig accepted a missing file")
+	}
+}
+
+func TestAdminReloadHandler(t *testing.T) {
+	setTestConfig(t, func(c *Config) { c.AdminToken = "secret" })
+	good := writeTestConfig(t, "admin_token: secret\nmax_text_runes: 123\n")
+	bad := writeTestConfig(t, "admin_token: secret\ndefault_voice: no-such-voice\n")
+
+	tests := []struct {
+		name   string
+		method string
+		token  string
+		path   string
+		status int
+		code   string
+	}{
+		{"get", http.MethodGet, "secret", good, http.StatusMethodNotAllowed, "INVALID_REQUEST"},
+		{"no token", http.MethodPost, "", good, http.StatusUnauthorized, "UNAUTHORIZED"},
+		{"wrong token", http.MethodPost, "nope", good, http.StatusUnauthorized, "UNAUTHORIZED"},
+		{"invalid config", http.MethodPost, "secret", bad, http.StatusUnprocessableEntity, "CONFIG_INVALID"},
+		{"reload", http.MethodPost, "secret", good, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/admin/reload", nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			handleAdminReload(tt.path)(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %q: %v", w.Body, err)
+			}
+			if tt.code != "" && body["code"] != tt.code {
+				t.Fatalf("code = %v, want %s", body["code"], tt.code)
+			}
+		})
+	}
+	if got := currentConfig().MaxTextRunes; got != 123 {
+		t.Fatalf("max_text_runes = %d after reload, want 123", got)
+	}
+}
+
+func TestConnectionKeepsConfigAfterReload(t *testing.T) {
+	setTestConfig(t, func(c *Config) { c.DefaultSampleRate = 8000 })
+	conn := dialTestWS(t, handleTTS)
+	// 连接建立后替换配置: 该连接的合成仍按建立时的默认采样率
+	setTestConfig(t, func(c *Config) { c.DefaultSampleRate = 16000 })
+
+	realtime := false
+	writeJSONMessage(t, conn, TTSRequest{Action: "tts", Text: "你", Realtime: &realtime})
+	for {
+		messageType, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if messageType != websocket.BinaryMessage {
+			continue
+		}
+		if want := 8000 * DEFAULT_FRAME_MS / 1000 * 2; len(message) != want {
+			t.Fatalf("frame = %d bytes, want %d (8kHz from the connection's config)", len(message), want)
+		}
+		return
+	}
+}
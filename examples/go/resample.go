@@ -0,0 +1,31 @@
+package main
+
+// resample 线性插值将采样从 from Hz 转换到 to Hz
+//
+// 输出长度为 len(samples)*to/from (四舍五入)。
+func resample(samples []int16, from, to int) []int16 {
+	return appendResampled(nil, samples, from, to)
+}
+
+// appendResampled 将 samples 从 from Hz 重采样到 to Hz 后追加到 dst, 返回扩展后的切片
+func appendResampled(dst, samples []int16, from, to int) []int16 {
+	if from == to || len(samples) == 0 {
+		return append(dst, samples...)
+	}
+
+	n := (len(samples)*to + from/2) / from
+	last := len(samples) - 1
+	step := float64(from) / float64(to)
+	for i := 0; i < n; i++ {
+		pos := float64(i) * step
+		idx := int(pos)
+		if idx >= last {
+			dst = append(dst, samples[last])
+			continue
+		}
+		frac := pos - float64(idx)
+		v := float64(samples[idx])*(1-frac) + float64(samples[idx+1])*frac
+		dst = append(dst, int16(v))
+	}
+	return dst
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestResampleLength(t *testing.T) {
+	tests := []struct {
+		n, from, to, want int
+	}{
+		{160, 8000, 16000, 320},
+		{320, 16000, 8000, 160},
+		{160, 8000, 48000, 960},
+		{441, 44100, 16000, 160},
+		{160, 16000, 22050, 221}, // 220.5 四舍五入
+		{3, 16000, 8000, 2},      // 1.5 四舍五入
+		{0, 8000, 16000, 0},
+	}
+	for _, tt := range tests {
+		if got := len(resample(make([]int16, tt.n), tt.from, tt.to)); got != tt.want {
+			t.Errorf("len(resample(%d samples, %d, %d)) = %d, want %d", tt.n, tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestResampleUpsample(t *testing.T) {
+	in := []int16{0, 100, -100, 1000}
+	got := resample(in, 8000, 16000)
+	want := []int16{0, 50, 100, 0, -100, 450, 1000, 1000}
+	if len(got) != len(want) {
+		t.Fatalf("resample = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("resample = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestResampleDownsample(t *testing.T) {
+	in := []int16{1, 2, 3, 4, 5, 6}
+	got := resample(in, 16000, 8000)
+	want := []int16{1, 3, 5}
+	if len(got) != len(want) {
+		t.Fatalf("resample = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("resample = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestResampleSameRate(t *testing.T) {
+	in := []int16{1, -2, 3}
+	got := resample(in, 16000, 16000)
+	if len(got) != 3 || got[0] != 1 || got[1] != -2 || got[2] != 3 {
+		t.Fatalf("resample = %v, want %v", got, in)
+	}
+	got[0] = 9
+	if in[0] != 1 {
+		t.Fatal("resample at the same rate aliases its input")
+	}
+}
+
+func TestResamplePreservesTone(t *testing.T) {
+	// 8kHz 的 440Hz 正弦波升到 16kHz 后, 各采样应接近同一时刻的理想值
+	const from, to, freq = 8000, 16000, 440.0
+	in := make([]int16, from/10)
+	for i := range in {
+		in[i] = int16(10000 * math.Sin(2*math.Pi*freq*float64(i)/from))
+	}
+	out := resample(in, from, to)
+	for i := 0; i < len(out)-2; i++ {
+		ideal := 10000 * math.Sin(2*math.Pi*freq*float64(i)/to)
+		if diff := math.Abs(float64(out[i]) - ideal); diff > 300 {
+			t.Fatalf("sample %d = %d, want about %.0f", i, out[i], ideal)
+		}
+	}
+}
+
+func TestAppendResampledKeepsPrefix(t *testing.T) {
+	dst := []int16{7, 8}
+	got := appendResampled(dst, []int16{0, 100}, 8000, 16000)
+	if len(got) != 6 || got[0] != 7 || got[1] != 8 || got[3] != 50 {
+		t.Fatalf("appendResampled = %v", got)
+	}
+}
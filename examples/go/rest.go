@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ttsHTTPStatus 校验错误码对应的 HTTP 状态码
+var ttsHTTPStatus = map[string]int{
+	"INVALID_REQUEST":                   http.StatusBadRequest,
+	"TEXT_EMPTY":                        http.StatusBadRequest,
+	"TEXT_TOO_LONG":                     http.StatusRequestEntityTooLarge,
+	"UNSUPPORTED_ENCODING":              http.StatusUnprocessableEntity,
+	"PARAMETER_OUT_OF_RANGE":            http.StatusUnprocessableEntity,
+	"VOICE_NOT_FOUND":                   http.StatusUnprocessableEntity,
+	"SAMPLE_RATE_UNSUPPORTED_FOR_VOICE": http.StatusUnprocessableEntity,
+	"PROFILE_NOT_FOUND":                 http.StatusUnprocessableEntity,
+	"PROMPT_NOT_FOUND":                  http.StatusUnprocessableEntity,
+	"QUOTA_EXCEEDED":                    http.StatusTooManyRequests,
+	"SYNTHESIS_TIMEOUT":                 http.StatusGatewayTimeout,
+	"BACKEND_UNAVAILABLE":               http.StatusBadGateway,
+	"SYNTHESIS_FAILED":                  http.StatusInternalServerError,
+}
+
+// handleTTSSynthesize 非 WebSocket 的 TTS 接口: POST JSON 请求体, 返回完整音频
+//
+// 默认返回 WAV, ?format=raw 时返回不带文件头的原始音频。
+func handleTTSSynthesize(w http.ResponseWriter, r *http.Request) {
+	cfg := currentConfig()
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeHTTPError(w, http.StatusMethodNotAllowed, "INVALID_REQUEST", "Method not allowed")
+		return
+	}
+	if connections.isClosing() {
+		writeHTTPError(w, http.StatusServiceUnavailable, "SHUTTING_DOWN", "Server shutting down")
+		return
+	}
+	user, ok := authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="websocket-server"`)
+		writeHTTPError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Missing or invalid token")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "wav" && format != "raw" {
+		writeHTTPError(w, http.StatusBadRequest, "INVALID_REQUEST",
+			fmt.Sprintf("Unsupported format '%s'", format))
+		return
+	}
+
+	if cfg.MaxMessageSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxMessageSize)
+	}
+	var req TTSRequest
+	if errResp := decodeJSON(r.Body, &req); errResp != nil {
+		writeHTTPErrorResponse(w, http.StatusBadRequest, *errResp)
+		return
+	}
+
+	sessionID := req.SessionID
+	if sessionID == "" {
+		sessionID = newSessionID()
+	}
+	logger := slog.With("endpoint", "tts_http", "session_id", sessionID, "remote", clientIP(r))
+
+	if errResp := applyTTSProfile(&req, cfg); errResp != nil {
+		writeHTTPError(w, ttsHTTPStatus[errResp.Code], errResp.Code, errResp.Message)
+		return
+	}
+	if errResp := validateTTSRequest(req, *cfg); errResp != nil {
+		writeHTTPError(w, ttsHTTPStatus[errResp.Code], errResp.Code, errResp.Message)
+		return
+	}
+	chars := textRunes(req)
+	if !usage.addChars(user, chars, cfg.QuotaMonthlyChars) {
+		logger.Warn("TTS 超出每月字符额度", "chars", chars, "quota", cfg.QuotaMonthlyChars)
+		errResp := quotaExceeded("character")
+		writeHTTPError(w, ttsHTTPStatus[errResp.Code], errResp.Code, errResp.Message)
+		return
+	}
+	normalizeTTSRequest(&req, cfg)
+	if req.Endian == EndianBig && format != "raw" {
+		// WAV (RIFF) 只能存放 Little-Endian 的 PCM
+		writeHTTPError(w, http.StatusBadRequest, "INVALID_REQUEST", "Endian 'big' requires format=raw")
+		return
+	}
+	applyTTSDefaults(&req, cfg)
+	if req.Realtime == nil {
+		// 一次性返回完整音频, 默认不按实时节奏合成
+		realtime := false
+		req.Realtime = &realtime
+	}
+	ttsRequestsTotal.Inc()
+
+	engine := ttsEngineFrom(r.Context())
+	ctx, cancel := withSynthesisTimeout(withConfig(withLogger(r.Context(), logger), cfg), engine, req)
+	defer cancel()
+
+	// HTTP 响应一次性返回, 不发送 audio_start 与时间标记等事件
+	var audio bytes.Buffer
+	err := timeoutCause(ctx, runSynthesizer(ctx, engine, req,
+		func(frame []byte) { audio.Write(frame) }, nil))
+	if err != nil {
+		if errResp := synthesisError(err, cfg); errResp != nil {
+			logger.Warn("TTS 合成失败", "code", errResp.Code, "error", err)
+			setRetryAfter(w, errResp.RetryAfterMs)
+			writeHTTPError(w, ttsHTTPStatus[errResp.Code], errResp.Code, errResp.Message)
+		}
+		// 客户端已断开
+		return
+	}
+
+	var body []byte
+	if format == "raw" {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		body = audio.Bytes()
+	} else {
+		w.Header().Set("Content-Type", "audio/wav")
+		body = append(wavHeader(audio.Len(), req.SampleRate, req.Channels, req.Encoding), audio.Bytes()...)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	n, _ := w.Write(body)
+	usage.addAudioSent(user, n)
+}
+
+// handleASRRecognize 非 WebSocket 的 ASR 接口: POST 音频作为请求体, 返回 NLSML
+//
+// 请求体为 16-bit PCM 或 WAV; 采样率取自 WAV 头、?sample_rate= 或
+// X-Sample-Rate 头, 均未提供时使用默认采样率。
+func handleASRRecognize(w http.ResponseWriter, r *http.Request) {
+	cfg := currentConfig()
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeHTTPError(w, http.StatusMethodNotAllowed, "INVALID_REQUEST", "Method not allowed")
+		return
+	}
+	if connections.isClosing() {
+		writeHTTPError(w, http.StatusServiceUnavailable, "SHUTTING_DOWN", "Server shutting down")
+		return
+	}
+	user, ok := authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="websocket-server"`)
+		writeHTTPError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Missing or invalid token")
+		return
+	}
+
+	query := r.URL.Query()
+	sampleRate := cfg.DefaultSampleRate
+	v := query.Get("sample_rate")
+	if v == "" {
+		v = r.Header.Get("X-Sample-Rate")
+	}
+	if v != "" {
+		rate, err := strconv.Atoi(v)
+		if err != nil {
+			writeHTTPError(w, http.StatusBadRequest, "INVALID_REQUEST",
+				fmt.Sprintf("Invalid sample rate '%s'", v))
+			return
+		}
+		sampleRate = rate
+	}
+	alternatives := 1
+	if v := query.Get("alternatives"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeHTTPError(w, http.StatusBadRequest, "INVALID_REQUEST",
+				fmt.Sprintf("Invalid alternatives '%s'", v))
+			return
+		}
+		alternatives = n
+	}
+
+	// 与流式接口相同的音频上限, WAV 头计入在内
+	if cfg.MaxAudioBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, int64(cfg.MaxAudioBytes))
+	}
+	audio, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeHTTPError(w, http.StatusRequestEntityTooLarge, "AUDIO_TOO_LONG",
+				fmt.Sprintf("Audio exceeds %d bytes", cfg.MaxAudioBytes))
+			return
+		}
+		writeHTTPError(w, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read body")
+		return
+	}
+
+	pcm, rate, isWAV, err := parseWAV(audio)
+	if err != nil {
+		writeHTTPError(w, http.StatusUnprocessableEntity, "UNSUPPORTED_AUDIO_FORMAT", err.Error())
+		return
+	}
+	if isWAV {
+		audio, sampleRate = pcm, rate
+	}
+	if len(audio) == 0 {
+		writeHTTPError(w, http.StatusBadRequest, "AUDIO_EMPTY", "Audio is empty")
+		return
+	}
+	if !isSupportedASRSampleRate(sampleRate) {
+		writeHTTPError(w, http.StatusUnprocessableEntity, "SAMPLE_RATE_UNSUPPORTED",
+			fmt.Sprintf("Unsupported sample rate %d", sampleRate))
+		return
+	}
+
+	logger := slog.With("endpoint", "asr_http", "session_id", newSessionID(), "remote", clientIP(r))
+	logger.Info("ASR 识别", "bytes", len(audio),
+		"duration_s", float64(len(audio))/float64(sampleRate*2)) // 16-bit
+
+	if !usage.addAudioReceived(user, len(audio), cfg.QuotaMonthlyASRBytes) {
+		logger.Warn("ASR 超出每月音频额度", "bytes", len(audio), "quota", cfg.QuotaMonthlyASRBytes)
+		errResp := quotaExceeded("audio")
+		writeHTTPError(w, http.StatusTooManyRequests, errResp.Code, errResp.Message)
+		return
+	}
+
+	asrRequestsTotal.Inc()
+	languages := asrLanguages("", strings.Split(query.Get("language"), ","), cfg.DefaultLanguage)
+	result, language, err := runRecognizer(asrEngineFrom(r.Context()), audio, sampleRate, alternatives, nil, languages, cfg)
+	if err != nil {
+		logger.Warn("ASR 识别失败", "error", err)
+		errResp := recognitionError(err)
+		status := http.StatusInternalServerError
+		if errResp.Code == "BACKEND_UNAVAILABLE" {
+			status = http.StatusBadGateway
+		}
+		setRetryAfter(w, errResp.RetryAfterMs)
+		writeHTTPError(w, status, errResp.Code, errResp.Message)
+		return
+	}
+
+	result = formatNLSML(withLanguage(result, language), cfg.NLSMLFormat)
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Length", strconv.Itoa(len(result)))
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, result)
+}
+
+// writeHTTPError 以 JSON 返回错误响应并计数
+// setRetryAfter 错误带 retry_after_ms 时设置 Retry-After 头 (秒, 向上取整)
+func setRetryAfter(w http.ResponseWriter, retryAfterMs int64) {
+	if retryAfterMs > 0 {
+		w.Header().Set("Retry-After", strconv.FormatInt((retryAfterMs+999)/1000, 10))
+	}
+}
+
+func writeHTTPError(w http.ResponseWriter, status int, code, message string) {
+	writeHTTPErrorResponse(w, status, ErrorResponse{Status: "error", Code: code, Message: message})
+}
+
+// writeHTTPErrorResponse 以 JSON 返回带附加字段的错误并计数
+func writeHTTPErrorResponse(w http.ResponseWriter, status int, resp ErrorResponse) {
+	errorsTotal.WithLabelValues(resp.Code).Inc()
+	writeJSON(w, status, resp)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// TTSRoute 按路径路由的 TTS 引擎, 字段含义同 tts_engine / grpc_tts_target
+type TTSRoute struct {
+	Engine        string `yaml:"engine"`
+	GRPCTTSTarget string `yaml:"grpc_tts_target"`
+}
+
+// ASRRoute 按路径路由的 ASR 引擎, 字段含义同 asr_engine
+type ASRRoute struct {
+	Engine string `yaml:"engine"`
+}
+
+// 路由名称不能与固定的 HTTP 接口冲突
+var reservedRouteNames = map[string]bool{"synthesize": true, "recognize": true}
+
+// ttsRoutes/asrRoutes 路由名称到引擎实例, main 中按 tts_routes / asr_routes 创建, 之后只读
+var (
+	ttsRoutes = map[string]Synthesizer{}
+	asrRoutes = map[string]Recognizer{}
+)
+
+// checkRoutes 校验配置 c 中的路由名称
+func checkRoutes(c *Config) error {
+	for name := range c.TTSRoutes {
+		if err := checkRouteName(name); err != nil {
+			return fmt.Errorf("tts_routes: %v", err)
+		}
+	}
+	for name := range c.ASRRoutes {
+		if err := checkRouteName(name); err != nil {
+			return fmt.Errorf("asr_routes: %v", err)
+		}
+	}
+	return nil
+}
+
+// checkRouteName 路由名称只能包含字母、数字、"-" 与 "_", 且不能为保留名称
+func checkRouteName(name string) error {
+	if name == "" || reservedRouteNames[name] {
+		return fmt.Errorf("invalid route name '%s'", name)
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return fmt.Errorf("invalid route name '%s'", name)
+		}
+	}
+	return nil
+}
+
+// buildRoutes 按配置 c 创建各路由的引擎, 与默认引擎一样按 tts_cache_size 包装缓存
+func buildRoutes(c *Config) error {
+	for _, name := range routeNames(c.TTSRoutes) {
+		route := c.TTSRoutes[name]
+		rc := *c
+		rc.TTSEngine, rc.GRPCTTSTarget = route.Engine, route.GRPCTTSTarget
+		engine, err := newSynthesizer(&rc)
+		if err != nil {
+			return fmt.Errorf("tts_routes '%s': %v", name, err)
+		}
+		registerBreaker("tts/"+name, engine)
+		if c.TTSCacheSize > 0 {
+			engine = newCachingSynthesizer(engine, c.TTSCacheSize)
+		}
+		ttsRoutes[name] = engine
+	}
+	for _, name := range routeNames(c.ASRRoutes) {
+		rc := *c
+		rc.ASREngine = c.ASRRoutes[name].Engine
+		recognizer, err := newRecognizer(&rc)
+		if err != nil {
+			return fmt.Errorf("asr_routes '%s': %v", name, err)
+		}
+		registerBreaker("asr/"+name, recognizer)
+		asrRoutes[name] = recognizer
+	}
+	return nil
+}
+
+// routeNames 返回路由名称, 按字母顺序
+func routeNames[T any](routes map[string]T) []string {
+	names := make([]string, 0, len(routes))
+	for name := range routes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// splitRoute 将 prefix 之后的路径拆为路由名称与剩余部分, 如 "/tts/a/synthesize" -> ("a", "synthesize")
+func splitRoute(path, prefix string) (string, string) {
+	name, rest, _ := strings.Cut(strings.TrimPrefix(path, prefix), "/")
+	return name, rest
+}
+
+type ttsEngineKey struct{}
+
+type asrEngineKey struct{}
+
+// ttsEngineFrom 取 ctx 中按路由选择的 TTS 引擎, 没有时返回默认引擎
+func ttsEngineFrom(ctx context.Context) Synthesizer {
+	if engine, ok := ctx.Value(ttsEngineKey{}).(Synthesizer); ok {
+		return engine
+	}
+	return ttsEngine
+}
+
+// asrEngineFrom 取 ctx 中按路由选择的 ASR 引擎, 没有时返回默认引擎
+func asrEngineFrom(ctx context.Context) Recognizer {
+	if engine, ok := ctx.Value(asrEngineKey{}).(Recognizer); ok {
+		return engine
+	}
+	return asrEngine
+}
+
+// handleTTSRoute /tts/<name> (WebSocket) 与 /tts/<name>/synthesize 使用 tts_routes 中名为 name 的引擎
+func handleTTSRoute(w http.ResponseWriter, r *http.Request) {
+	name, rest := splitRoute(r.URL.Path, "/tts/")
+	engine, ok := ttsRoutes[name]
+	if !ok || (rest != "" && rest != "synthesize") {
+		writeHTTPError(w, http.StatusNotFound, "ENGINE_NOT_FOUND",
+			fmt.Sprintf("TTS engine route '%s' not found", strings.TrimPrefix(r.URL.Path, "/tts/")))
+		return
+	}
+	setRouteLabel(w, strings.TrimSuffix("/tts/"+name+"/"+rest, "/"))
+	r = r.WithContext(context.WithValue(r.Context(), ttsEngineKey{}, engine))
+	if rest == "" {
+		handleTTS(w, r)
+		return
+	}
+	handleTTSSynthesize(w, r)
+}
+
+// handleASRRoute /asr/<name> (WebSocket) 与 /asr/<name>/recognize 使用 asr_routes 中名为 name 的引擎
+func handleASRRoute(w http.ResponseWriter, r *http.Request) {
+	name, rest := splitRoute(r.URL.Path, "/asr/")
+	recognizer, ok := asrRoutes[name]
+	if !ok || (rest != "" && rest != "recognize") {
+		writeHTTPError(w, http.StatusNotFound, "ENGINE_NOT_FOUND",
+			fmt.Sprintf("ASR engine route '%s' not found", strings.TrimPrefix(r.URL.Path, "/asr/")))
+		return
+	}
+	setRouteLabel(w, strings.TrimSuffix("/asr/"+name+"/"+rest, "/"))
+	r = r.WithContext(context.WithValue(r.Context(), asrEngineKey{}, recognizer))
+	if rest == "" {
+		handleASR(w, r)
+		return
+	}
+	handleASRRecognize(w, r)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// MAX_DETACHED_SESSIONS 同时保留的断线会话数上限, 超过后新断开的会话直接丢弃
+const MAX_DETACHED_SESSIONS = 1000
+
+// SessionManager 保留断线会话的状态, 供携带相同 session_id 重连的客户端恢复
+//
+// 生命周期:
+//   - 连接进行中: 状态只在连接处理函数内, 管理器不持有
+//   - 断开且有未完成的识别/合成: park 存入管理器, 有效期 ttl
+//   - 重连并恢复: resume 取出并从管理器删除, 同一会话只能被恢复一次
+//   - 超过 ttl 未恢复: 后台 sweeper 删除
+//
+// ttl 为 0 时不保留任何会话。
+type SessionManager struct {
+	ttl time.Duration
+
+	mu  sync.Mutex
+	asr map[string]*asrSession
+	tts map[string]*ttsSession
+}
+
+// asrSession 断线时未识别的音频
+type asrSession struct {
+	user       string
+	audio      []byte
+	sampleRate int
+	grammars   *grammarSet
+	expires    time.Time
+}
+
+// ttsSession 断线时未合成完的请求及已发送的帧数
+type ttsSession struct {
+	user    string
+	req     TTSRequest
+	frames  int
+	expires time.Time
+}
+
+func newSessionManager(ttl time.Duration) *SessionManager {
+	return &SessionManager{
+		ttl: ttl,
+		asr: make(map[string]*asrSession),
+		tts: make(map[string]*ttsSession),
+	}
+}
+
+// enabled 是否保留断线会话
+func (m *SessionManager) enabled() bool {
+	return m.ttl > 0
+}
+
+// full 断线会话数已达上限, 调用方须持有 mu
+func (m *SessionManager) full() bool {
+	return len(m.asr)+len(m.tts) >= MAX_DETACHED_SESSIONS
+}
+
+// parkASR 保留断线的 ASR 会话, 未启用或已达上限时返回 false
+func (m *SessionManager) parkASR(id string, s *asrSession) bool {
+	if !m.enabled() || id == "" {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.asr[id]; !exists && m.full() {
+		return false
+	}
+	s.expires = time.Now().Add(m.ttl)
+	m.asr[id] = s
+	return true
+}
+
+// resumeASR 取出 user 保留的 ASR 会话, 取出后即从管理器删除
+func (m *SessionManager) resumeASR(id, user string) (*asrSession, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.asr[id]
+	if !ok || s.user != user || time.Now().After(s.expires) {
+		return nil, false
+	}
+	delete(m.asr, id)
+	return s, true
+}
+
+// parkTTS 保留断线的 TTS 会话, 未启用或已达上限时返回 false
+func (m *SessionManager) parkTTS(id string, s *ttsSession) bool {
+	if !m.enabled() || id == "" {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.tts[id]; !exists && m.full() {
+		return false
+	}
+	s.expires = time.Now().Add(m.ttl)
+	m.tts[id] = s
+	return true
+}
+
+// resumeTTS 取出 user 保留的 TTS 会话, 取出后即从管理器删除
+func (m *SessionManager) resumeTTS(id, user string) (*ttsSession, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.tts[id]
+	if !ok || s.user != user || time.Now().After(s.expires) {
+		return nil, false
+	}
+	delete(m.tts, id)
+	return s, true
+}
+
+// sweep 删除 now 时已过期的会话, 返回删除数
+func (m *SessionManager) sweep(now time.Time) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for id, s := range m.asr {
+		if now.After(s.expires) {
+			delete(m.asr, id)
+			n++
+		}
+	}
+	for id, s := range m.tts {
+		if now.After(s.expires) {
+			delete(m.tts, id)
+			n++
+		}
+	}
+	return n
+}
+
+// startSweeper 启动后台协程, 每 ttl/2 清理一次过期会话
+//
+// 返回的函数用于停止清理协程。
+func (m *SessionManager) startSweeper() func() {
+	if !m.enabled() {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(m.ttl / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				if n := m.sweep(now); n > 0 {
+					slog.Info("清理过期会话", "count", n)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// LIMITER_THRESHOLD limiter_threshold 的默认值 (满幅的比例, 约 -0.9 dBFS)
+const LIMITER_THRESHOLD = 0.9
+
+// limit 原地对 samples 做软限幅: 幅度不超过 threshold × 满幅的采样不变,
+// 超出部分按 tanh 曲线压缩到 threshold 与满幅之间, 曲线在阈值处连续且斜率为 1, 结果不会溢出 int16
+func limit(samples []int16, threshold float64) {
+	knee := threshold * math.MaxInt16
+	headroom := math.MaxInt16 - knee
+	if headroom <= 0 {
+		return
+	}
+	for i, s := range samples {
+		v := math.Abs(float64(s))
+		if v <= knee {
+			continue
+		}
+		v = knee + headroom*math.Tanh((v-knee)/headroom)
+		if s < 0 {
+			v = -v
+		}
+		samples[i] = int16(math.Round(v))
+	}
+}
+
+// exceedsThreshold 判断 samples 中是否有幅度超过 threshold × 满幅的采样
+func exceedsThreshold(samples []int16, threshold float64) bool {
+	knee := threshold * math.MaxInt16
+	for _, s := range samples {
+		if math.Abs(float64(s)) > knee {
+			return true
+		}
+	}
+	return false
+}
+
+// limitSendFrame c 启用 limiter 时返回对每帧做软限幅后再调用 sendFrame 的函数, 否则原样返回 sendFrame
+//
+// 帧为按 req.Encoding / req.Endian 编码的音频 (双声道时为交错采样); 需要限幅的帧解码、限幅后
+// 重新编码到新的缓冲, 不修改引擎的帧, 使缓存中的音频保持原样。
+func limitSendFrame(req TTSRequest, c *Config, sendFrame func([]byte)) func([]byte) {
+	if !c.Limiter {
+		return sendFrame
+	}
+	threshold := c.LimiterThreshold
+	return func(frame []byte) {
+		samples := decodeFrameSamples(frame, req.Encoding, req.Endian)
+		if !exceedsThreshold(samples, threshold) {
+			sendFrame(frame)
+			return
+		}
+		limit(samples, threshold)
+		out := appendEncoded(make([]byte, 0, len(frame)), samples, req.Encoding, req.Endian)
+		if len(out) < len(frame) {
+			// pcm16 帧末尾不足一个采样的字节原样保留
+			out = append(out, frame[len(out):]...)
+		}
+		sendFrame(out)
+	}
+}
+
+// decodeFrameSamples 将按 encoding / endian 编码的帧解码为 16-bit 采样
+func decodeFrameSamples(frame []byte, encoding, endian string) []int16 {
+	switch encoding {
+	case EncodingULaw, EncodingALaw:
+		decode := ulawToPCM
+		if encoding == EncodingALaw {
+			decode = alawToPCM
+		}
+		samples := make([]int16, len(frame))
+		for i, b := range frame {
+			samples[i] = decode(b)
+		}
+		return samples
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if endian == EndianBig {
+		order = binary.BigEndian
+	}
+	samples := make([]int16, len(frame)/2)
+	for i := range samples {
+		samples[i] = int16(order.Uint16(frame[2*i:]))
+	}
+	return samples
+}
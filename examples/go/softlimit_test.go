@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestLimitBelowThresholdUnchanged(t *testing.T) {
+	knee := int16(29490) // 0.9 × 满幅
+	samples := []int16{0, 100, -100, knee, -knee}
+	want := append([]int16(nil), samples...)
+	limit(samples, 0.9)
+	for i := range samples {
+		if samples[i] != want[i] {
+			t.Fatalf("limit changed sample %d below threshold: %d -> %d", i, want[i], samples[i])
+		}
+	}
+}
+
+func TestLimitAttenuatesPeaksSmoothly(t *testing.T) {
+	var in []int16
+	for v := math.MinInt16; v <= math.MaxInt16; v++ {
+		in = append(in, int16(v))
+	}
+	out := append([]int16(nil), in...)
+	limit(out, 0.9)
+
+	knee := 0.9 * math.MaxInt16
+	for i := range out {
+		x, y := float64(in[i]), float64(out[i])
+		if math.Abs(x) > knee {
+			// 超过阈值的采样不会被放大, 离阈值较远时明显压缩; 结果不低于阈值, 也不会到达满幅
+			if math.Abs(y) > math.Abs(x) || (math.Abs(x) > knee+1000 && math.Abs(y) >= math.Abs(x)) {
+				t.Fatalf("sample %d not attenuated: %d", in[i], out[i])
+			}
+			if math.Abs(y) < knee-1 || math.Abs(y) >= math.MaxInt16 {
+				t.Fatalf("sample %d limited to %d, want within (%g, %d)", in[i], out[i], knee, math.MaxInt16)
+			}
+		}
+		// 单调且相邻输入的输出至多相差 1, 曲线没有跳变
+		if i > 0 && (out[i] < out[i-1] || out[i]-out[i-1] > 1) {
+			t.Fatalf("limit not smooth at %d: %d -> %d", in[i], out[i-1], out[i])
+		}
+	}
+	if out[0] != -out[len(out)-1] {
+		t.Fatalf("limit not symmetric: %d vs %d", out[0], out[len(out)-1])
+	}
+}
+
+func TestLimitSendFrameEncodings(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Limiter = true
+	for _, tt := range []struct{ encoding, endian string }{
+		{EncodingPCM16, ""}, {EncodingPCM16, EndianBig}, {EncodingULaw, ""}, {EncodingALaw, ""},
+	} {
+		req := TTSRequest{Encoding: tt.encoding, Endian: tt.endian}
+		frame := appendEncoded(nil, []int16{1000, math.MaxInt16, math.MinInt16}, tt.encoding, tt.endian)
+		in := decodeFrameSamples(frame, tt.encoding, tt.endian)
+		var got []int16
+		limitSendFrame(req, cfg, func(b []byte) { got = decodeFrameSamples(b, tt.encoding, tt.endian) })(frame)
+		if len(got) != len(in) || got[0] != in[0] {
+			t.Fatalf("%s/%s: limited frame %v from %v, quiet sample must be unchanged", tt.encoding, tt.endian, got, in)
+		}
+		for i := 1; i < len(in); i++ {
+			if abs16(got[i]) > abs16(in[i]) {
+				t.Fatalf("%s/%s: peak %d amplified to %d", tt.encoding, tt.endian, in[i], got[i])
+			}
+		}
+		if tt.encoding == EncodingPCM16 && (got[1] >= math.MaxInt16 || got[2] <= -math.MaxInt16) {
+			t.Fatalf("%s/%s: peaks not attenuated: %v", tt.encoding, tt.endian, got)
+		}
+	}
+
+	// 没有超过阈值的帧原样发送
+	quiet := appendEncoded(nil, []int16{1, 2, 3}, EncodingPCM16, "")
+	limitSendFrame(TTSRequest{}, cfg, func(b []byte) {
+		if &b[0] != &quiet[0] {
+			t.Fatal("quiet frame was copied")
+		}
+	})(quiet)
+}
+
+func TestLimitSendFrameDisabled(t *testing.T) {
+	frame := appendEncoded(nil, []int16{math.MaxInt16}, EncodingPCM16, "")
+	limitSendFrame(TTSRequest{}, DefaultConfig(), func(b []byte) {
+		if got := decodeFrameSamples(b, EncodingPCM16, "")[0]; got != math.MaxInt16 {
+			t.Fatalf("limiter disabled but sample changed to %d", got)
+		}
+	})(frame)
+}
+
+// peakSynthesizer 输出一帧满幅 pcm16 采样的测试引擎
+type peakSynthesizer struct{ calls int }
+
+func (p *peakSynthesizer) Synthesize(req TTSRequest, sendFrame func([]byte), onComplete func()) {
+	p.calls++
+	sendFrame(appendEncoded(nil, []int16{math.MaxInt16, math.MinInt16}, EncodingPCM16, ""))
+	onComplete()
+}
+
+func TestLimiterAppliedOnceWithCache(t *testing.T) {
+	setTestConfig(t, func(c *Config) { c.Limiter = true })
+	want := []int16{math.MaxInt16, math.MinInt16}
+	limit(want, LIMITER_THRESHOLD)
+
+	inner := &peakSynthesizer{}
+	engine := newCachingSynthesizer(inner, 4)
+	realtime := false
+	req := TTSRequest{Text: "峰值", Realtime: &realtime}
+	for i := 0; i < 2; i++ {
+		var got []int16
+		err := runSynthesizer(context.Background(), engine, req,
+			func(b []byte) { got = append(got, decodeFrameSamples(b, EncodingPCM16, "")...) }, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+			t.Fatalf("call %d: got %v, want %v (limited once)", i, got, want)
+		}
+	}
+	if inner.calls != 1 {
+		t.Fatalf("inner engine called %d times, want 1 (second call from cache)", inner.calls)
+	}
+
+	// 缓存保存引擎的原始输出
+	keyReq := req
+	applyTTSDefaults(&keyReq, currentConfig())
+	items, ok := engine.cache.get(ttsCacheKey(keyReq, currentConfig()))
+	if !ok || len(items) != 1 {
+		t.Fatalf("cache entry = %v, %v", items, ok)
+	}
+	if raw := decodeFrameSamples(items[0].frame, EncodingPCM16, ""); raw[0] != math.MaxInt16 || raw[1] != math.MinInt16 {
+		t.Fatalf("cached frame %v, want raw engine output", raw)
+	}
+}
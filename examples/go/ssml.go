@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ssmlSegment SSML 解析后的合成片段
+//
+// 文本片段携带该段生效的语速/音调/音量及其中出现的词典条目; 停顿片段只有 BreakMs;
+// 标记片段只有 Mark (<mark name=..> 的名称), 不占时长; 录音片段 (拼接播放的 prompt)
+// 只有 Audio, 为已重采样到引擎原生采样率的采样。
+type ssmlSegment struct {
+	Text    string
+	BreakMs int
+	Mark    string
+	Audio   []int16
+	Speed   float64
+	Pitch   float64
+	Volume  float64
+	Lexicon []LexiconEntry
+}
+
+// isSSML 判断文本是否为 SSML 标记 (以 <speak> 根元素开头, "<speaker>" 之类的普通文本不算)
+func isSSML(text string) bool {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(text), "<speak")
+	if !ok || rest == "" {
+		return false
+	}
+	switch rest[0] {
+	case '>', '/', ' ', '\t', '\n', '\r':
+		return true
+	}
+	return false
+}
+
+// ssmlProsody 当前生效的韵律参数
+type ssmlProsody struct {
+	speed  float64
+	pitch  float64
+	volume float64
+}
+
+// parseSSML 将 SSML 解析为片段列表
+//
+// 支持 <break>、<mark>、<emphasis>、<prosody rate=.. pitch=..>，
+// 其他标签仅保留其中的文本。
+func parseSSML(text string, speed, pitch, volume float64) ([]ssmlSegment, error) {
+	decoder := xml.NewDecoder(strings.NewReader(strings.TrimSpace(text)))
+	decoder.Strict = true
+
+	stack := []ssmlProsody{{speed: speed, pitch: pitch, volume: volume}}
+	var segments []ssmlSegment
+	seenSpeak := false
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		cur := stack[len(stack)-1]
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if !seenSpeak {
+				if t.Name.Local != "speak" {
+					return nil, fmt.Errorf("root element must be <speak>, got <%s>", t.Name.Local)
+				}
+				seenSpeak = true
+			}
+
+			next := cur
+			switch t.Name.Local {
+			case "break":
+				ms, err := parseBreak(t.Attr)
+				if err != nil {
+					return nil, err
+				}
+				segments = append(segments, ssmlSegment{BreakMs: ms})
+			case "mark":
+				name := ssmlAttr(t.Attr, "name")
+				if name == "" {
+					return nil, fmt.Errorf("mark without name")
+				}
+				segments = append(segments, ssmlSegment{Mark: name})
+			case "emphasis":
+				level := ssmlAttr(t.Attr, "level")
+				factor, ok := emphasisVolume[level]
+				if !ok {
+					return nil, fmt.Errorf("invalid emphasis level '%s'", level)
+				}
+				next.volume = cur.volume * factor
+			case "prosody":
+				if v := ssmlAttr(t.Attr, "rate"); v != "" {
+					rate, err := parseProsodyValue(v, prosodyRates)
+					if err != nil {
+						return nil, fmt.Errorf("invalid prosody rate: %v", err)
+					}
+					next.speed = cur.speed * rate
+				}
+				if v := ssmlAttr(t.Attr, "pitch"); v != "" {
+					p, err := parseProsodyValue(v, prosodyPitches)
+					if err != nil {
+						return nil, fmt.Errorf("invalid prosody pitch: %v", err)
+					}
+					next.pitch = cur.pitch * p
+				}
+			}
+			stack = append(stack, next)
+
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+
+		case xml.CharData:
+			s := strings.TrimSpace(string(t))
+			if s == "" {
+				continue
+			}
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("text outside <speak>")
+			}
+			segments = append(segments, ssmlSegment{
+				Text:   s,
+				Speed:  cur.speed,
+				Pitch:  cur.pitch,
+				Volume: cur.volume,
+			})
+		}
+	}
+
+	if !seenSpeak {
+		return nil, fmt.Errorf("missing <speak> element")
+	}
+	return segments, nil
+}
+
+// ssmlAttr 获取属性值
+func ssmlAttr(attrs []xml.Attr, name string) string {
+	for _, a := range attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// breakStrengths <break strength=..> 对应的停顿时长 (ms)
+var breakStrengths = map[string]int{
+	"none":     0,
+	"x-weak":   100,
+	"weak":     200,
+	"medium":   400,
+	"strong":   700,
+	"x-strong": 1000,
+}
+
+// emphasisVolume <emphasis level=..> 对应的音量系数
+var emphasisVolume = map[string]float64{
+	"":         1.2, // 默认 moderate
+	"moderate": 1.2,
+	"strong":   1.5,
+	"reduced":  0.8,
+	"none":     1.0,
+}
+
+// prosodyRates <prosody rate=..> 关键字对应的语速系数
+var prosodyRates = map[string]float64{
+	"x-slow":  0.5,
+	"slow":    0.75,
+	"medium":  1.0,
+	"default": 1.0,
+	"fast":    1.25,
+	"x-fast":  1.5,
+}
+
+// prosodyPitches <prosody pitch=..> 关键字对应的音调系数
+var prosodyPitches = map[string]float64{
+	"x-low":   0.5,
+	"low":     0.75,
+	"medium":  1.0,
+	"default": 1.0,
+	"high":    1.25,
+	"x-high":  1.5,
+}
+
+// parseBreak 解析 <break> 的停顿时长, time 优先于 strength
+func parseBreak(attrs []xml.Attr) (int, error) {
+	if v := ssmlAttr(attrs, "time"); v != "" {
+		var unit float64
+		var num string
+		switch {
+		case strings.HasSuffix(v, "ms"):
+			unit, num = 1, strings.TrimSuffix(v, "ms")
+		case strings.HasSuffix(v, "s"):
+			unit, num = 1000, strings.TrimSuffix(v, "s")
+		default:
+			return 0, fmt.Errorf("invalid break time '%s'", v)
+		}
+		f, err := strconv.ParseFloat(num, 64)
+		if err != nil || f < 0 {
+			return 0, fmt.Errorf("invalid break time '%s'", v)
+		}
+		return int(f * unit), nil
+	}
+
+	strength := ssmlAttr(attrs, "strength")
+	if strength == "" {
+		strength = "medium"
+	}
+	ms, ok := breakStrengths[strength]
+	if !ok {
+		return 0, fmt.Errorf("invalid break strength '%s'", strength)
+	}
+	return ms, nil
+}
+
+// parseProsodyValue 解析韵律属性, 返回相对系数
+//
+// 支持关键字、百分比 ("80%")、相对百分比 ("+10%"/"-20%") 和数值倍率 ("1.2")。
+func parseProsodyValue(v string, keywords map[string]float64) (float64, error) {
+	if f, ok := keywords[v]; ok {
+		return f, nil
+	}
+
+	var factor float64
+	if strings.HasSuffix(v, "%") {
+		num := strings.TrimSuffix(v, "%")
+		f, err := strconv.ParseFloat(num, 64)
+		if err != nil {
+			return 0, fmt.Errorf("'%s'", v)
+		}
+		if strings.HasPrefix(num, "+") || strings.HasPrefix(num, "-") {
+			factor = 1 + f/100
+		} else {
+			factor = f / 100
+		}
+	} else {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, fmt.Errorf("'%s'", v)
+		}
+		factor = f
+	}
+
+	if factor <= 0 {
+		return 0, fmt.Errorf("'%s'", v)
+	}
+	return factor, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestIsSSML(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"<speak>你好</speak>", true},
+		{"  \n<speak version=\"1.0\">你好</speak>", true},
+		{"<speak\txml:lang=\"zh-CN\">你好</speak>", true},
+		{"<speak/>", true},
+		{"<speaker>张三</speaker> 说你好", false},
+		{"<speak", false},
+		{"<speaking>", false},
+		{"你好 <speak>", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isSSML(tt.text); got != tt.want {
+			t.Errorf("isSSML(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSSMLMarksOrderAndOffsets(t *testing.T) {
+	setTestConfig(t, nil)
+	engine := &TTSEngine{CharDurationMs: 100}
+	realtime := false
+	req := TTSRequest{
+		Text: `<speak><mark name="start"/>你好<mark name="mid"/><break time="30ms"/>` +
+			`<mark name="a"/><mark name="b"/>再见<mark name="end"/></speak>`,
+		Voice: "xiaoyun", SampleRate: 8000, Realtime: &realtime,
+	}
+
+	type markAt struct {
+		mark SSMLMark
+		sent int // 标记发送前已发出的采样数
+	}
+	var marks []markAt
+	sent := 0
+	ctx := withLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	err := engine.SynthesizeContext(ctx, req, func(frame []byte) {
+		sent += len(frame) / 2
+	}, func(event interface{}) {
+		if m, ok := event.(SSMLMark); ok {
+			marks = append(marks, markAt{m, sent})
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 每字 800 个采样 (100ms), 停顿 240 个采样 (30ms)
+	want := []struct {
+		name   string
+		sample int
+	}{
+		{"start", 0}, {"mid", 1600}, {"a", 1840}, {"b", 1840}, {"end", 3440},
+	}
+	if len(marks) != len(want) {
+		t.Fatalf("got %d marks %+v, want %d", len(marks), marks, len(want))
+	}
+	frameSamples := 8000 * DEFAULT_FRAME_MS / 1000
+	for i, w := range want {
+		m := marks[i]
+		if m.mark.Type != "mark" || m.mark.Name != w.name || m.mark.OffsetMs != w.sample*1000/8000 {
+			t.Fatalf("mark %d = %+v, want %s at %dms", i, m.mark, w.name, w.sample*1000/8000)
+		}
+		// 在包含其位置的帧之前发送: 已发出的采样不超过标记位置, 且不早于该帧的起点
+		if m.sent > w.sample || (m.sent+frameSamples <= w.sample && w.sample < sent) {
+			t.Fatalf("mark %s at sample %d sent after %d samples", w.name, w.sample, m.sent)
+		}
+	}
+	if sent != 3440 {
+		t.Fatalf("sent %d samples, want 3440", sent)
+	}
+	if marks[len(marks)-1].sent != sent {
+		t.Fatalf("end mark sent after %d samples, want after the last frame (%d)", marks[len(marks)-1].sent, sent)
+	}
+}
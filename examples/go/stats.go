@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// 连接状态, 由 /stats 报告
+const (
+	StateIdle         = "idle"
+	StateSynthesizing = "synthesizing"
+	StateRecognizing  = "recognizing"
+)
+
+// connStats 单个连接的调试统计, 计数与状态可在任意协程中更新
+type connStats struct {
+	endpoint  string
+	sessionID string
+	remote    string
+	user      string
+	since     time.Time
+
+	bytesSent     atomic.Int64
+	bytesReceived atomic.Int64
+	queueDepth    atomic.Int64 // 流式合成排队未合成的文本段数
+	state         atomic.Value // string
+	usage         usageCounters
+}
+
+func newConnStats(endpoint, sessionID, remote, user string) *connStats {
+	s := &connStats{endpoint: endpoint, sessionID: sessionID, remote: remote, user: user, since: time.Now()}
+	s.state.Store(StateIdle)
+	return s
+}
+
+// setState 更新连接状态
+func (s *connStats) setState(state string) {
+	s.state.Store(state)
+}
+
+// SessionStats /stats 中的一个活动连接
+type SessionStats struct {
+	Endpoint       string    `json:"endpoint"`
+	SessionID      string    `json:"session_id"` // 与该连接日志中的 conn_id / session_id 一致
+	Remote         string    `json:"remote"`
+	User           string    `json:"user,omitempty"`
+	ConnectedSince time.Time `json:"connected_since"`
+	BytesSent      int64     `json:"bytes_sent"`
+	BytesReceived  int64     `json:"bytes_received"`
+	State          string    `json:"state"`
+	QueueDepth     int64     `json:"queue_depth"` // 流式合成排队的文本段数, ASR 连接始终为 0
+
+	// 计费用量: 接受合成的字符数、发出的 TTS 音频字节数与接受识别的 ASR 音频字节数
+	CharsSynthesized   int64 `json:"chars_synthesized"`
+	AudioBytesSent     int64 `json:"audio_bytes_sent"`
+	AudioBytesReceived int64 `json:"audio_bytes_received"`
+}
+
+// snapshot 返回统计的当前快照
+func (s *connStats) snapshot() SessionStats {
+	return SessionStats{
+		Endpoint:       s.endpoint,
+		SessionID:      s.sessionID,
+		Remote:         s.remote,
+		User:           s.user,
+		ConnectedSince: s.since,
+		BytesSent:      s.bytesSent.Load(),
+		BytesReceived:  s.bytesReceived.Load(),
+		State:          s.state.Load().(string),
+		QueueDepth:     s.queueDepth.Load(),
+
+		CharsSynthesized:   s.usage.chars.Load(),
+		AudioBytesSent:     s.usage.audioBytesSent.Load(),
+		AudioBytesReceived: s.usage.audioBytesRecv.Load(),
+	}
+}
+
+// StatsResponse /stats 响应结构
+type StatsResponse struct {
+	Sessions []SessionStats `json:"sessions"`
+	Users    []UserUsage    `json:"users"`    // 各用户当月的累计用量
+	Breakers []BreakerStats `json:"breakers"` // 各引擎的熔断器状态
+}
+
+// authenticateAdmin 校验调试接口: 配置了 admin_token 时只接受该令牌, 否则与主接口鉴权相同;
+// 两者都未配置时只接受来自本机回环地址的请求, /stats 与 /admin/reload 不对外开放
+func authenticateAdmin(r *http.Request) bool {
+	cfg := currentConfig()
+	if cfg.AdminToken == "" {
+		if authenticator == nil {
+			return isLoopbackRequest(r)
+		}
+		_, ok := authenticate(r)
+		return ok
+	}
+	token := requestToken(r)
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) == 1
+}
+
+// isLoopbackRequest 判断请求是否直接来自本机回环地址 (不参考 X-Forwarded-For 等代理头)
+func isLoopbackRequest(r *http.Request) bool {
+	ip := net.ParseIP(clientIP(r))
+	return ip != nil && ip.IsLoopback()
+}
+
+// handleStats 返回各活动连接的统计, 按连接时间排序; 只读, 可频繁轮询
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeHTTPError(w, http.StatusMethodNotAllowed, "INVALID_REQUEST", "Method not allowed")
+		return
+	}
+	if !authenticateAdmin(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="websocket-server"`)
+		writeHTTPError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Missing or invalid token")
+		return
+	}
+
+	sessions := connections.stats()
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].ConnectedSince.Before(sessions[j].ConnectedSince)
+	})
+	writeJSON(w, http.StatusOK, StatsResponse{Sessions: sessions, Users: usage.snapshot(), Breakers: breakerStats()})
+}
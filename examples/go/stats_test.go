@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// statsRequest 以 remoteAddr 为来源请求 /stats, token 非空时携带 Bearer 令牌
+func statsRequest(remoteAddr, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/stats", nil)
+	r.RemoteAddr = remoteAddr
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handleStats(w, r)
+	return w
+}
+
+func TestAdminEndpointsWithoutAuthAreLoopbackOnly(t *testing.T) {
+	setTestConfig(t, nil)
+	prev := authenticator
+	authenticator = nil
+	defer func() { authenticator = prev }()
+
+	for _, addr := range []string{"127.0.0.1:4321", "[::1]:4321"} {
+		if w := statsRequest(addr, ""); w.Code != http.StatusOK {
+			t.Errorf("/stats from %s = %d, want 200", addr, w.Code)
+		}
+	}
+	for _, addr := range []string{"192.0.2.10:4321", "10.0.0.1:80"} {
+		if w := statsRequest(addr, ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("/stats from %s = %d, want 401", addr, w.Code)
+		}
+	}
+
+	// 代理头不能伪造本机来源
+	r := httptest.NewRequest(http.MethodPost, "/admin/reload", nil)
+	r.RemoteAddr = "192.0.2.10:4321"
+	r.Header.Set("X-Forwarded-For", "127.0.0.1")
+	w := httptest.NewRecorder()
+	handleAdminReload("/nonexistent.yaml")(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("/admin/reload from remote client = %d, want 401", w.Code)
+	}
+}
+
+func TestAdminTokenRequired(t *testing.T) {
+	setTestConfig(t, func(c *Config) { c.AdminToken = "admin-secret" })
+	prev := authenticator
+	authenticator = staticTokens([]string{"user-token"})
+	defer func() { authenticator = prev }()
+
+	tests := []struct {
+		addr, token string
+		want        int
+	}{
+		{"192.0.2.10:4321", "admin-secret", http.StatusOK},
+		{"192.0.2.10:4321", "user-token", http.StatusUnauthorized},
+		{"192.0.2.10:4321", "", http.StatusUnauthorized},
+		{"127.0.0.1:4321", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if w := statsRequest(tt.addr, tt.token); w.Code != tt.want {
+			t.Errorf("/stats from %s with token %q = %d, want %d", tt.addr, tt.token, w.Code, tt.want)
+		}
+	}
+}
+
+func TestAdminFallsBackToMainAuth(t *testing.T) {
+	setTestConfig(t, nil)
+	prev := authenticator
+	authenticator = staticTokens([]string{"user-token"})
+	defer func() { authenticator = prev }()
+
+	if w := statsRequest("192.0.2.10:4321", "user-token"); w.Code != http.StatusOK {
+		t.Fatalf("/stats with main token = %d, want 200", w.Code)
+	}
+	if w := statsRequest("127.0.0.1:4321", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("/stats from loopback without token = %d, want 401 when auth_tokens is set", w.Code)
+	}
+
+	w := statsRequest("192.0.2.10:4321", "user-token")
+	var resp StatsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode /stats: %v", err)
+	}
+	if resp.Sessions == nil || resp.Breakers == nil {
+		t.Fatalf("/stats response %s missing sessions or breakers", w.Body.String())
+	}
+}
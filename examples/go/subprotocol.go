@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gorilla/websocket"
+)
+
+// acceptsSubprotocol 判断能否为客户端协商子协议
+//
+// 客户端在 Sec-WebSocket-Protocol 中提供了子协议、服务端也配置了 subprotocols 却没有
+// 交集时返回 false, 由调用方在升级前拒绝; 未提供子协议的客户端 (如 UniMRCP 插件)
+// 或未配置 subprotocols 时始终允许, 不协商子协议。
+func acceptsSubprotocol(r *http.Request, c *Config) bool {
+	offered := websocket.Subprotocols(r)
+	if len(offered) == 0 || len(c.Subprotocols) == 0 {
+		return true
+	}
+	for _, p := range offered {
+		if slices.Contains(c.Subprotocols, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectSubprotocol 子协议协商失败时返回 400
+func rejectSubprotocol(w http.ResponseWriter) {
+	http.Error(w, "unsupported subprotocol", http.StatusBadRequest)
+}
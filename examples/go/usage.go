@@ -0,0 +1,179 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// 按鉴权身份统计的用量指标, 未启用鉴权时 user 标签为空
+var (
+	usageCharsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "usage_tts_chars_total",
+		Help: "Total characters accepted for TTS synthesis, by user.",
+	}, []string{"user"})
+
+	usageAudioBytesSentTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "usage_tts_audio_bytes_total",
+		Help: "Total bytes of TTS audio delivered to clients, by user.",
+	}, []string{"user"})
+
+	usageAudioBytesReceivedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "usage_asr_audio_bytes_total",
+		Help: "Total bytes of ASR audio accepted from clients, by user.",
+	}, []string{"user"})
+)
+
+// usageCounters 计费用量, 可在任意协程中并发更新
+type usageCounters struct {
+	chars          atomic.Int64 // 接受合成的字符数
+	audioBytesSent atomic.Int64 // 发出的 TTS 音频字节数
+	audioBytesRecv atomic.Int64 // 接受识别的 ASR 音频字节数
+}
+
+// addWithin 在不超过 limit 时为 v 加上 n; limit 为 0 表示不限制。并发调用时不会超额
+func addWithin(v *atomic.Int64, n, limit int64) bool {
+	for {
+		cur := v.Load()
+		if limit > 0 && cur+n > limit {
+			return false
+		}
+		if v.CompareAndSwap(cur, cur+n) {
+			return true
+		}
+	}
+}
+
+// userUsage 一个用户在某个自然月 (UTC) 的累计用量
+type userUsage struct {
+	usageCounters
+	month string
+}
+
+// usageMeter 按用户汇总当月用量, 跨月时从 0 重新计数; 只保存在内存中, 重启后清零
+type usageMeter struct {
+	mu    sync.Mutex
+	users map[string]*userUsage
+}
+
+// usage 全局用量统计, 每月额度据此判断
+var usage = &usageMeter{users: make(map[string]*userUsage)}
+
+// usageMonth 当前计费月份, 如 "2026-10"
+func usageMonth() string {
+	return time.Now().UTC().Format("2006-01")
+}
+
+// get 返回用户当月的用量, 跨月时替换为新的计数
+func (m *usageMeter) get(user string) *userUsage {
+	month := usageMonth()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[user]
+	if !ok || u.month != month {
+		u = &userUsage{month: month}
+		m.users[user] = u
+	}
+	return u
+}
+
+// addChars 计入 n 个合成字符, 超出每月额度 quota 时不计入并返回 false; quota 为 0 表示不限制
+func (m *usageMeter) addChars(user string, n int, quota int64) bool {
+	if !addWithin(&m.get(user).chars, int64(n), quota) {
+		return false
+	}
+	usageCharsTotal.WithLabelValues(user).Add(float64(n))
+	return true
+}
+
+// refundChars 退回已计入但未能排队合成的字符
+func (m *usageMeter) refundChars(user string, n int) {
+	// Prometheus 计数器只增不减, 只退回当月用量
+	m.get(user).chars.Add(-int64(n))
+}
+
+// addAudioSent 计入发出的 TTS 音频字节
+func (m *usageMeter) addAudioSent(user string, n int) {
+	m.get(user).audioBytesSent.Add(int64(n))
+	usageAudioBytesSentTotal.WithLabelValues(user).Add(float64(n))
+}
+
+// addAudioReceived 计入 n 字节 ASR 音频, 超出每月额度 quota 时不计入并返回 false
+func (m *usageMeter) addAudioReceived(user string, n int, quota int64) bool {
+	if !addWithin(&m.get(user).audioBytesRecv, int64(n), quota) {
+		return false
+	}
+	usageAudioBytesReceivedTotal.WithLabelValues(user).Add(float64(n))
+	return true
+}
+
+// UserUsage /stats 中一个用户当月的累计用量
+type UserUsage struct {
+	User               string `json:"user"`
+	Month              string `json:"month"`
+	CharsSynthesized   int64  `json:"chars_synthesized"`
+	AudioBytesSent     int64  `json:"audio_bytes_sent"`
+	AudioBytesReceived int64  `json:"audio_bytes_received"`
+}
+
+// snapshot 返回各用户当月用量, 按用户排序; 上月的记录不再报告
+func (m *usageMeter) snapshot() []UserUsage {
+	month := usageMonth()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]UserUsage, 0, len(m.users))
+	for user, u := range m.users {
+		if u.month != month {
+			continue
+		}
+		list = append(list, UserUsage{
+			User:               user,
+			Month:              u.month,
+			CharsSynthesized:   u.chars.Load(),
+			AudioBytesSent:     u.audioBytesSent.Load(),
+			AudioBytesReceived: u.audioBytesRecv.Load(),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].User < list[j].User })
+	return list
+}
+
+// chargeChars 为连接计入合成字符 (会话与用户用量), 超出用户每月额度时返回 false
+func (s *connStats) chargeChars(n int, quota int64) bool {
+	if !usage.addChars(s.user, n, quota) {
+		return false
+	}
+	s.usage.chars.Add(int64(n))
+	return true
+}
+
+// refundChars 退回 chargeChars 计入的字符
+func (s *connStats) refundChars(n int) {
+	usage.refundChars(s.user, n)
+	s.usage.chars.Add(-int64(n))
+}
+
+// addAudioSent 为连接计入发出的 TTS 音频字节
+func (s *connStats) addAudioSent(n int) {
+	usage.addAudioSent(s.user, n)
+	s.usage.audioBytesSent.Add(int64(n))
+}
+
+// chargeAudioReceived 为连接计入 ASR 音频字节, 超出用户每月额度时返回 false
+func (s *connStats) chargeAudioReceived(n int, quota int64) bool {
+	if !usage.addAudioReceived(s.user, n, quota) {
+		return false
+	}
+	s.usage.audioBytesRecv.Add(int64(n))
+	return true
+}
+
+// quotaExceeded 超出每月额度时的错误响应
+func quotaExceeded(kind string) ErrorResponse {
+	return ErrorResponse{Status: "error", Code: "QUOTA_EXCEEDED",
+		Message: "Monthly " + kind + " quota exceeded"}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+	"time"
+)
+
+// VAD 默认参数
+const (
+	defaultSilenceThreshold = 500.0 // RMS, 16-bit 采样幅度
+	defaultSilenceMs        = 800
+)
+
+// vadDetector 基于能量的尾部静音检测
+//
+// 按 20ms 分块计算 RMS, 检测到语音后若连续静音达到 silenceMs 则判定为端点。
+// 未检测到语音前的静音不计入。
+type vadDetector struct {
+	threshold      float64
+	silenceSamples int
+	chunkSamples   int
+
+	inSpeech bool
+	silence  int // 当前连续静音采样数
+	pending  []byte
+}
+
+func newVADDetector(sampleRate int, threshold float64, silenceMs int) *vadDetector {
+	if threshold <= 0 {
+		threshold = defaultSilenceThreshold
+	}
+	if silenceMs <= 0 {
+		silenceMs = defaultSilenceMs
+	}
+	return &vadDetector{
+		threshold:      threshold,
+		silenceSamples: sampleRate * silenceMs / 1000,
+		chunkSamples:   sampleRate / 50,
+	}
+}
+
+// process 处理一段 16-bit PCM, 到达端点时返回 true
+func (v *vadDetector) process(pcm []byte) bool {
+	_, endpoint := v.processEvents(pcm)
+	return endpoint
+}
+
+// processEvents 处理一段 16-bit PCM, 返回本段中是否首次检测到语音及是否到达端点
+func (v *vadDetector) processEvents(pcm []byte) (started, endpoint bool) {
+	v.pending = append(v.pending, pcm...)
+	chunkBytes := v.chunkSamples * 2
+
+	for len(v.pending) >= chunkBytes {
+		chunk := v.pending[:chunkBytes]
+		v.pending = v.pending[chunkBytes:]
+
+		if pcmRMS(chunk) >= v.threshold {
+			if !v.inSpeech {
+				started = true
+			}
+			v.inSpeech = true
+			v.silence = 0
+			continue
+		}
+		if v.inSpeech {
+			v.silence += v.chunkSamples
+			if v.silence >= v.silenceSamples {
+				endpoint = true
+			}
+		}
+	}
+	return started, endpoint
+}
+
+// reset 在一次识别结束后重置状态
+func (v *vadDetector) reset() {
+	v.inSpeech = false
+	v.silence = 0
+	v.pending = v.pending[:0]
+}
+
+// pcmRMS 计算 16-bit Little-Endian PCM 的均方根
+func pcmRMS(pcm []byte) float64 {
+	n := len(pcm) / 2
+	if n == 0 {
+		return 0
+	}
+	var sum float64
+	for i := 0; i < n; i++ {
+		s := float64(int16(binary.LittleEndian.Uint16(pcm[i*2:])))
+		sum += s * s
+	}
+	return math.Sqrt(sum / float64(n))
+}
+
+// noInputTimer 识别开始后 timeout 内未检测到语音时调用 onTimeout
+type noInputTimer struct {
+	threshold float64
+
+	mu     sync.Mutex
+	timer  *time.Timer
+	fired  bool
+	active bool
+}
+
+func newNoInputTimer(timeout time.Duration, threshold float64, onTimeout func()) *noInputTimer {
+	if threshold <= 0 {
+		threshold = defaultSilenceThreshold
+	}
+	t := &noInputTimer{threshold: threshold, active: true}
+	t.timer = time.AfterFunc(timeout, func() {
+		t.mu.Lock()
+		if !t.active {
+			t.mu.Unlock()
+			return
+		}
+		t.active = false
+		t.fired = true
+		t.mu.Unlock()
+		onTimeout()
+	})
+	return t
+}
+
+// process 检查音频能量, 超过阈值时停止计时
+func (t *noInputTimer) process(pcm []byte) {
+	if pcmRMS(pcm) >= t.threshold {
+		t.stop()
+	}
+}
+
+// stop 停止计时, 已触发时无影响
+func (t *noInputTimer) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active = false
+	t.timer.Stop()
+}
+
+// hasFired 是否已因超时返回了 no-input
+func (t *noInputTimer) hasFired() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.fired
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+)
+
+// VOICE_DEFAULT_ALIAS 等同于未指定音色, UniMRCP 插件未设置 Voice-Name 时发送该值
+const VOICE_DEFAULT_ALIAS = "default"
+
+// 请求的采样率不在音色 sample_rates 中时的处理策略
+const (
+	SampleRatePolicyResample = "resample" // 按音色支持的采样率合成后重采样为请求的采样率
+	SampleRatePolicyStrict   = "strict"   // 返回 SAMPLE_RATE_UNSUPPORTED_FOR_VOICE
+)
+
+// Voice 可用音色
+type Voice struct {
+	ID          string `json:"id"`
+	Language    string `json:"language"`
+	Gender      string `json:"gender"`
+	SampleRates []int  `json:"sample_rates"`
+}
+
+var (
+	voicesMu sync.RWMutex
+	// voices 按注册顺序排列, 默认为演示引擎的音色
+	voices = []Voice{
+		{ID: "xiaoyun", Language: "zh-CN", Gender: "female", SampleRates: []int{8000, 16000, 22050, 44100}},
+		{ID: "xiaogang", Language: "zh-CN", Gender: "male", SampleRates: []int{8000, 16000, 22050, 44100}},
+		{ID: "emily", Language: "en-US", Gender: "female", SampleRates: []int{8000, 16000}},
+	}
+)
+
+// RegisterVoice 注册音色, ID 已存在时覆盖
+//
+// 接入真实引擎时按引擎支持的音色在 init 中调用, 或先调用 ResetVoices 清空演示音色。
+func RegisterVoice(v Voice) {
+	voicesMu.Lock()
+	defer voicesMu.Unlock()
+	for i := range voices {
+		if voices[i].ID == v.ID {
+			voices[i] = v
+			return
+		}
+	}
+	voices = append(voices, v)
+}
+
+// ResetVoices 清空已注册的音色
+func ResetVoices() {
+	voicesMu.Lock()
+	defer voicesMu.Unlock()
+	voices = nil
+}
+
+// lookupVoice 按 ID 查找音色
+func lookupVoice(id string) (Voice, bool) {
+	voicesMu.RLock()
+	defer voicesMu.RUnlock()
+	for _, v := range voices {
+		if v.ID == id {
+			return v, true
+		}
+	}
+	return Voice{}, false
+}
+
+// isSupportedSampleRatePolicy 判断 voice_sample_rate_policy 是否受支持
+func isSupportedSampleRatePolicy(policy string) bool {
+	return policy == SampleRatePolicyResample || policy == SampleRatePolicyStrict
+}
+
+// supportsSampleRate 判断音色能否直接以 rate 合成, 未声明 sample_rates 的音色支持任意采样率
+func (v Voice) supportsSampleRate(rate int) bool {
+	if len(v.SampleRates) == 0 {
+		return true
+	}
+	for _, r := range v.SampleRates {
+		if r == rate {
+			return true
+		}
+	}
+	return false
+}
+
+// voiceSampleRate 返回音色 id 合成 rate 采样率的音频时实际使用的采样率
+//
+// 音色支持 rate 或未注册时返回 rate; 否则取不低于 rate 的最低采样率, 都低于 rate 时取最高者,
+// 避免先降采样再升采样损失音质。
+func voiceSampleRate(id string, rate int) int {
+	v, ok := lookupVoice(id)
+	if !ok || v.supportsSampleRate(rate) {
+		return rate
+	}
+	best := 0
+	for _, r := range v.SampleRates {
+		switch {
+		case r >= rate && (best < rate || r < best):
+			best = r
+		case best < rate && r > best:
+			best = r
+		}
+	}
+	return best
+}
+
+// isDefaultVoice 未指定音色 (空或 "default") 时使用配置的 default_voice
+func isDefaultVoice(id string) bool {
+	return id == "" || id == VOICE_DEFAULT_ALIAS
+}
+
+// VoicesResponse GET /voices 的响应
+type VoicesResponse struct {
+	Default string  `json:"default"`
+	Voices  []Voice `json:"voices"`
+}
+
+// handleVoices 返回可用音色列表
+func handleVoices(w http.ResponseWriter, r *http.Request) {
+	cfg := currentConfig()
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeHTTPError(w, http.StatusMethodNotAllowed, "INVALID_REQUEST", "Method not allowed")
+		return
+	}
+	if _, ok := authenticate(r); !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="websocket-server"`)
+		writeHTTPError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Missing or invalid token")
+		return
+	}
+
+	voicesMu.RLock()
+	list := append([]Voice{}, voices...)
+	voicesMu.RUnlock()
+	writeJSON(w, http.StatusOK, VoicesResponse{Default: cfg.DefaultVoice, Voices: list})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// WAV fmt 块中的编码格式
+const (
+	wavFormatPCM  = 1
+	wavFormatALaw = 6
+	wavFormatULaw = 7
+)
+
+// wavHeader 生成 44 字节的 RIFF/WAVE 文件头, dataLen 为音频数据字节数
+func wavHeader(dataLen, sampleRate, channels int, encoding string) []byte {
+	format := wavFormatPCM
+	switch encoding {
+	case EncodingULaw:
+		format = wavFormatULaw
+	case EncodingALaw:
+		format = wavFormatALaw
+	}
+	bits := bitsPerSample(encoding)
+	blockAlign := channels * bits / 8
+
+	h := make([]byte, 44)
+	copy(h[0:], "RIFF")
+	binary.LittleEndian.PutUint32(h[4:], uint32(36+dataLen))
+	copy(h[8:], "WAVE")
+	copy(h[12:], "fmt ")
+	binary.LittleEndian.PutUint32(h[16:], 16)
+	binary.LittleEndian.PutUint16(h[20:], uint16(format))
+	binary.LittleEndian.PutUint16(h[22:], uint16(channels))
+	binary.LittleEndian.PutUint32(h[24:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(h[28:], uint32(sampleRate*blockAlign))
+	binary.LittleEndian.PutUint16(h[32:], uint16(blockAlign))
+	binary.LittleEndian.PutUint16(h[34:], uint16(bits))
+	copy(h[36:], "data")
+	binary.LittleEndian.PutUint32(h[40:], uint32(dataLen))
+	return h
+}
+
+// parseWAV 解析 16-bit PCM 单声道 WAV, 返回 data 块与采样率
+//
+// 数据不是 RIFF/WAVE 时 ok 为 false; 是 WAV 但格式不支持时返回错误。
+func parseWAV(data []byte) (pcm []byte, sampleRate int, ok bool, err error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, 0, false, nil
+	}
+
+	haveFmt := false
+	for p := 12; p+8 <= len(data); {
+		id := string(data[p : p+4])
+		size := int(binary.LittleEndian.Uint32(data[p+4:]))
+		body := data[p+8:]
+		if size > len(body) {
+			size = len(body)
+		}
+		body = body[:size]
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, 0, true, errors.New("invalid WAV fmt chunk")
+			}
+			format := binary.LittleEndian.Uint16(body[0:])
+			channels := binary.LittleEndian.Uint16(body[2:])
+			bits := binary.LittleEndian.Uint16(body[14:])
+			if format != wavFormatPCM || channels != 1 || bits != 16 {
+				return nil, 0, true, fmt.Errorf("unsupported WAV format %d, %d channels, %d bits",
+					format, channels, bits)
+			}
+			sampleRate = int(binary.LittleEndian.Uint32(body[4:]))
+			haveFmt = true
+		case "data":
+			if !haveFmt {
+				return nil, 0, true, errors.New("WAV data chunk before fmt")
+			}
+			return body, sampleRate, true, nil
+		}
+		p += 8 + size + size%2 // 块按偶数字节对齐
+	}
+	return nil, 0, true, errors.New("WAV data chunk not found")
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// outMessage 写队列中的一条消息
+type outMessage struct {
+	messageType int
+	data        []byte
+	onSent      func()        // 写出成功后在写协程中调用, 可为 nil
+	flushed     chan struct{} // 非 nil 时为 flush 标记, 不写出, 到达时关闭
+}
+
+// connWriter 连接的唯一写入方
+//
+// 音频帧、JSON 消息与 Close 帧都投递到有界队列, 由单个写协程按投递顺序写到连接,
+// 调用方无需加锁, 客户端读取过慢时也不会直接阻塞合成或读循环。
+// 队列持续满 timeout 或单次写入超过 timeout 时判定为慢速客户端, 以 SLOW_CONSUMER 关闭连接。
+// 连接上的写操作除 Ping (WriteControl 可并发调用) 外都应经由 connWriter。
+type connWriter struct {
+	conn    *websocket.Conn
+	ch      chan outMessage
+	timeout time.Duration // 0 表示不限制, 队列满时一直等待
+	stats   *connStats    // 写出成功后累加 bytesSent
+	logger  *slog.Logger
+
+	once   sync.Once
+	done   chan struct{} // 队列关闭或判定为慢速客户端后关闭
+	exited chan struct{} // 写协程退出后关闭
+}
+
+// newConnWriter 创建 connWriter 并启动写协程, size 为队列容量 (高水位)
+func newConnWriter(conn *websocket.Conn, size int, timeout time.Duration, stats *connStats,
+	logger *slog.Logger) *connWriter {
+	if size < 1 {
+		size = 1
+	}
+	w := &connWriter{
+		conn:    conn,
+		ch:      make(chan outMessage, size),
+		timeout: timeout,
+		stats:   stats,
+		logger:  logger,
+		done:    make(chan struct{}),
+		exited:  make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// send 投递一条消息, data 在投递后归队列所有
+//
+// 队列满时最多等待 timeout, 超时则关闭连接; ctx 取消或队列已关闭时返回 false。
+func (w *connWriter) send(ctx context.Context, m outMessage) bool {
+	select {
+	case w.ch <- m:
+		return true
+	case <-w.done:
+		return false
+	default:
+	}
+
+	var expired <-chan time.Time
+	if w.timeout > 0 {
+		timer := time.NewTimer(w.timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case w.ch <- m:
+		return true
+	case <-w.done:
+		return false
+	case <-ctx.Done():
+		return false
+	case <-expired:
+		w.slowConsumer("send queue full")
+		return false
+	}
+}
+
+// sendFrame 投递一个二进制音频帧, frame 被复制, 调用方可复用其内存
+func (w *connWriter) sendFrame(ctx context.Context, frame []byte, onSent func()) bool {
+	data := append([]byte(nil), frame...)
+	return w.send(ctx, outMessage{messageType: websocket.BinaryMessage, data: data, onSent: onSent})
+}
+
+// write 投递一条文本或控制消息, 队列满时最多等待 timeout
+func (w *connWriter) write(messageType int, data []byte) bool {
+	return w.send(context.Background(), outMessage{messageType: messageType, data: data})
+}
+
+// writeClose 投递 Close 帧并等待写出, 之后的消息不会再被写出
+func (w *connWriter) writeClose(code int, text string) {
+	if w.write(websocket.CloseMessage, websocket.FormatCloseMessage(code, text)) {
+		w.flush()
+	}
+}
+
+// flush 等待此前投递的消息全部写出, 队列关闭时立即返回
+func (w *connWriter) flush() {
+	flushed := make(chan struct{})
+	if !w.send(context.Background(), outMessage{flushed: flushed}) {
+		return
+	}
+	select {
+	case <-flushed:
+	case <-w.done:
+	}
+}
+
+// close 关闭队列并等待写协程退出, 未写出的消息被丢弃
+func (w *connWriter) close() {
+	w.once.Do(func() { close(w.done) })
+	<-w.exited
+}
+
+// run 写协程: 依次写出队列中的消息, 直到队列关闭或写入失败
+func (w *connWriter) run() {
+	defer close(w.exited)
+	for {
+		select {
+		case <-w.done:
+			return
+		case m := <-w.ch:
+			if m.flushed != nil {
+				close(m.flushed)
+				continue
+			}
+			if w.timeout > 0 {
+				w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+			}
+			// 已协商 permessage-deflate 时只压缩文本消息 (NLSML、JSON), 音频压缩收益低
+			w.conn.EnableWriteCompression(m.messageType == websocket.TextMessage)
+			err := w.conn.WriteMessage(m.messageType, m.data)
+			if w.timeout > 0 {
+				w.conn.SetWriteDeadline(time.Time{})
+			}
+			if err != nil {
+				if isTimeout(err) {
+					w.slowConsumer("write timeout")
+				} else {
+					w.logger.Warn("发送消息失败", "error", err)
+					w.once.Do(func() { close(w.done) })
+				}
+				return
+			}
+			w.stats.bytesSent.Add(int64(len(m.data)))
+			if m.messageType == websocket.BinaryMessage {
+				// 二进制消息均为 TTS 音频帧
+				w.stats.addAudioSent(len(m.data))
+			}
+			if m.onSent != nil {
+				m.onSent()
+			}
+		}
+	}
+}
+
+// slowConsumer 以 SLOW_CONSUMER 关闭连接, 读循环随之退出
+func (w *connWriter) slowConsumer(reason string) {
+	w.once.Do(func() {
+		close(w.done)
+		w.logger.Warn("客户端读取过慢, 关闭连接", "reason", reason, "timeout", w.timeout,
+			"queued", len(w.ch))
+		errorsTotal.WithLabelValues(CLOSE_REASON_SLOW_CONSUMER).Inc()
+		w.conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(CLOSE_SLOW_CONSUMER, CLOSE_REASON_SLOW_CONSUMER),
+			time.Now().Add(time.Second))
+		w.conn.Close()
+	})
+}
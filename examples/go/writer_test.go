@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// serverWriter 建立 WebSocket 连接, 返回服务端连接上的 connWriter 与客户端连接
+func serverWriter(t *testing.T, size int, timeout time.Duration) (*connWriter, *websocket.Conn) {
+	t.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	conn := <-conns
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	w := newConnWriter(conn, size, timeout, newConnStats("test", "", "", ""), logger)
+	t.Cleanup(func() {
+		// 先关闭连接, 使阻塞在写入上的写协程退出
+		conn.Close()
+		w.close()
+	})
+	return w, client
+}
+
+func TestConnWriterDeliversInOrder(t *testing.T) {
+	w, client := serverWriter(t, 4, time.Second)
+	for i := 0; i < 10; i++ {
+		if !w.write(websocket.TextMessage, []byte{'0' + byte(i)}) {
+			t.Fatalf("write %d failed", i)
+		}
+	}
+	w.flush()
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < 10; i++ {
+		_, data, err := client.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != string(rune('0'+i)) {
+			t.Fatalf("message %d = %q", i, data)
+		}
+	}
+}
+
+func TestConnWriterStalledReader(t *testing.T) {
+	// 客户端从不读取: 内核缓冲写满后队列随之写满, 须在 timeout 后判定为慢速客户端而不是一直阻塞
+	const timeout = 200 * time.Millisecond
+	w, client := serverWriter(t, 4, timeout)
+	frame := make([]byte, 64*1024)
+
+	start := time.Now()
+	sent := 0
+	for w.sendFrame(context.Background(), frame, nil) {
+		sent++
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("sendFrame still accepting frames after %d frames", sent)
+		}
+	}
+	select {
+	case <-w.done:
+	default:
+		t.Fatal("writer not closed after sendFrame failed")
+	}
+	if w.sendFrame(context.Background(), frame, nil) {
+		t.Fatal("sendFrame accepted a frame after the slow consumer was dropped")
+	}
+
+	// 服务端已关闭连接: 客户端读完缓冲的数据后应看到连接结束;
+	// 内核缓冲已满时 Close 帧可能来不及写出, 此时为 1006
+	client.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for {
+		if _, _, err := client.ReadMessage(); err != nil {
+			var ce *websocket.CloseError
+			if errors.As(err, &ce) && ce.Code != CLOSE_SLOW_CONSUMER && ce.Code != websocket.CloseAbnormalClosure {
+				t.Fatalf("close code = %d, want %d", ce.Code, CLOSE_SLOW_CONSUMER)
+			}
+			if isTimeout(err) {
+				t.Fatal("connection still open after the slow consumer was dropped")
+			}
+			break
+		}
+	}
+}
+
+func TestConnWriterSendCanceled(t *testing.T) {
+	// 不限时的队列满时, send 随 ctx 取消返回
+	w, _ := serverWriter(t, 1, 0)
+	frame := make([]byte, 64*1024)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	for w.sendFrame(ctx, frame, nil) {
+	}
+	if ctx.Err() == nil {
+		t.Fatal("sendFrame failed before ctx was canceled")
+	}
+}